@@ -4,10 +4,15 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"math"
+	"path/filepath"
 	"time"
 
 	"database-test/internal/database"
 	"database-test/internal/models"
+	"database-test/pkg/faker"
+	"database-test/pkg/money"
+	"database-test/pkg/timedist"
 
 	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
@@ -15,16 +20,76 @@ import (
 
 var (
 	// Flags for data generation
-	userCount        int
-	addressesPerUser int
-	categoryCount    int
-	maxCategoryDepth int
-	productCount     int
-	imagesPerProduct int
-	orderCount       int
-	maxItemsPerOrder int
-	reviewCount      int
-	allFlag          bool
+	userCount           int
+	addressesPerUser    int
+	categoryCount       int
+	maxCategoryDepth    int
+	categoryBranch      float64
+	categoryWeights     []float64
+	categoryShape       string
+	categoryPathMode    string
+	sellerCount         int
+	brandCount          int
+	sellerSkew          float64
+	productCount        int
+	imagesPerProduct    int
+	maxVariants         int
+	placementPolicy     string
+	placementSpread     string
+	promotionCount      int
+	orderCount          int
+	subscriptionCount   int
+	giftCardCount       int
+	loyaltyRate         float64
+	agentCount          int
+	adminCount          int
+	warehouses          int
+	plantedPairs        int
+	relatedMinOrders    int
+	relatedPerProduct   int
+	votesPerReview      float64
+	reviewReplyRate     float64
+	warehouseStaffCount int
+	ticketCount         int
+	abandonedCarts      int
+	cartRecoveryRate    float64
+	churnRate           float64
+	deletionRate        float64
+	erasureRate         float64
+	wishlistCount       int
+	maxItemsPerOrder    int
+	returnRate          float64
+	reviewCount         int
+	searchCount         int
+	unverifiedRatio     float64
+	allFlag             bool
+
+	// Flags for the time window and traffic shape
+	startDate     string
+	endDate       string
+	trafficCurve  string
+	weeklyPattern string
+	calendarName  string
+	yearlyGrowth  float64
+
+	// Flags for generated text
+	textLength string
+
+	// Flags for currencies
+	baseCurrencyCode string
+
+	// Flags for clickstream events
+	eventsOutput    string
+	eventsDir       string
+	productViewRate float64
+	addToCartRate   float64
+	checkoutRate    float64
+	conversionRate  float64
+
+	// Flags for multi-tenant seeding
+	tenantCount    int
+	tenantSizeSkew float64
+	keepTenantRLS  bool
 )
 
 // Command represents the seed command
@@ -60,54 +125,74 @@ You can specify which types of data to generate and how many records to create.`
 			log.Fatalf("Failed to create tables: %v", err)
 		}
 
-		// Start timing
-		startTime := time.Now()
-
-		// Show header
-		pterm.DefaultHeader.WithBackgroundStyle(pterm.NewStyle(pterm.BgLightBlue)).WithMargin(10).Println("E-Commerce Database Seeder")
-		pterm.Println() // Empty line
+		// Once seeded with tenants, every row needs one, so plain runs can't write anymore
+		tenancyEnabled, err := database.TenancyEnabled(db)
+		if err != nil {
+			log.Fatalf("Failed to check for tenancy: %v", err)
+		}
+		if tenancyEnabled && tenantCount == 0 {
+			log.Fatalf("The database was seeded with --tenants; seed it with --tenants again or use a fresh database")
+		}
 
-		// Seed data based on flags
-		if allFlag || userCount > 0 {
-			if err := seedUsers(db, userCount); err != nil {
-				pterm.Error.Println("Failed to seed users:", err)
-				return
+		// Tenants share every table, isolated by row-level security while seeding
+		if tenantCount > 0 {
+			if err := database.EnableTenancy(db); err != nil {
+				log.Fatalf("Failed to enable tenancy: %v", err)
+			}
+			if err := database.EnableRowLevelSecurity(db); err != nil {
+				log.Fatalf("Failed to enable row-level security: %v", err)
 			}
 		}
 
-		if allFlag || (userCount > 0 && addressesPerUser > 0) {
-			if err := seedAddresses(db, userCount, addressesPerUser); err != nil {
-				pterm.Error.Println("Failed to seed addresses:", err)
-				return
-			}
+		// Select how long generated descriptions, reviews and notes are
+		if err := faker.UseTextLength(textLength); err != nil {
+			log.Fatalf("Invalid text length: %v", err)
 		}
 
-		if allFlag || categoryCount > 0 {
-			if err := seedCategories(db, categoryCount, maxCategoryDepth); err != nil {
-				pterm.Error.Println("Failed to seed categories:", err)
-				return
-			}
+		// Products are priced in the base currency, orders in the customer's local currency
+		baseCurrency, err := money.LookupCurrency(baseCurrencyCode)
+		if err != nil {
+			log.Fatalf("Invalid base currency: %v", err)
 		}
 
-		if allFlag || productCount > 0 {
-			if err := seedProducts(db, productCount, imagesPerProduct); err != nil {
-				pterm.Error.Println("Failed to seed products:", err)
-				return
+		// Build the time distribution used for historical timestamps
+		timeline, err := buildTimeline()
+		if err != nil {
+			log.Fatalf("Invalid time window: %v", err)
+		}
+
+		// Events are generated after everything else, so their settings are checked up front
+		if err := models.ValidateEventOutput(eventsOutput); err != nil {
+			log.Fatalf("Invalid events output: %v", err)
+		}
+		if eventsOutput != models.EventOutputNone {
+			if err := flagFunnel().Validate(); err != nil {
+				log.Fatalf("Invalid funnel rates: %v", err)
 			}
 		}
 
-		if allFlag || orderCount > 0 {
-			if err := seedOrders(db, orderCount, maxItemsPerOrder); err != nil {
-				pterm.Error.Println("Failed to seed orders:", err)
-				return
+		// Events partitions are created up front, since tenant connections can't create tables.
+		// Sessions start shortly before the orders they end in, so cover the day before the window.
+		if (allFlag || orderCount > 0) && eventsOutput == models.EventOutputDB {
+			if err := database.CreateEventPartitions(db, timeline.Start.AddDate(0, 0, -1), timeline.End); err != nil {
+				log.Fatalf("Failed to create events partitions: %v", err)
 			}
 		}
 
-		if allFlag || reviewCount > 0 {
-			if err := seedReviews(db, reviewCount); err != nil {
-				pterm.Error.Println("Failed to seed reviews:", err)
+		// Start timing
+		startTime := time.Now()
+
+		// Show header
+		pterm.DefaultHeader.WithBackgroundStyle(pterm.NewStyle(pterm.BgLightBlue)).WithMargin(10).Println("E-Commerce Database Seeder")
+		pterm.Println() // Empty line
+
+		// Seed data based on flags
+		if tenantCount == 0 {
+			if err := seedData(db, flagCounts(), timeline, baseCurrency, eventsDir); err != nil {
 				return
 			}
+		} else if err := seedTenants(config, db, timeline, baseCurrency); err != nil {
+			return
 		}
 
 		// Print summary
@@ -122,26 +207,458 @@ func init() {
 	// Add flags for data generation
 	Command.Flags().IntVar(&userCount, "users", 100, "Number of users to generate")
 	Command.Flags().IntVar(&addressesPerUser, "addresses-per-user", 2, "Number of addresses per user")
+	Command.Flags().Float64Var(&churnRate, "churn-rate", 0.1, "Fraction of users flagged as churned after a long inactivity")
+	Command.Flags().Float64Var(&deletionRate, "account-deletion-rate", 0.05, "Fraction of users who closed their account, soft-deleted with their data kept")
+	Command.Flags().Float64Var(&erasureRate, "gdpr-erasure-rate", 0.02, "Fraction of users erased on request, their personal data replaced with tombstones")
 	Command.Flags().IntVar(&categoryCount, "categories", 30, "Number of categories to generate")
 	Command.Flags().IntVar(&maxCategoryDepth, "category-depth", 3, "Maximum depth of category hierarchy")
+	Command.Flags().Float64Var(&categoryBranch, "category-branching", 3, "Average number of subcategories per category")
+	Command.Flags().Float64SliceVar(&categoryWeights, "category-depth-weights", nil, "Relative number of categories at each depth, overriding the branching factor (e.g. 1,4,12)")
+	Command.Flags().StringVar(&categoryShape, "category-shape", models.CategoryShapeBalanced, "Category tree shape (balanced, skewed)")
+	Command.Flags().StringVar(&categoryPathMode, "category-hierarchy", models.CategoryHierarchyNone, "Extra category hierarchy storage (none, path, closure, both)")
+	Command.Flags().IntVar(&sellerCount, "sellers", 0, "Number of marketplace sellers listing products (0 means the store sells everything itself)")
+	Command.Flags().IntVar(&brandCount, "brands", 40, "Number of brands to generate")
+	Command.Flags().Float64Var(&sellerSkew, "seller-skew", 1.1, "How fast catalog sizes fall off: the kth largest seller lists 1/k^skew as many products as the largest")
+	Command.Flags().IntVar(&warehouses, "warehouses", 5, "Number of warehouses holding stock and fulfilling orders (0 keeps a single stock level per product)")
 	Command.Flags().IntVar(&productCount, "products", 1000, "Number of products to generate")
 	Command.Flags().IntVar(&imagesPerProduct, "images-per-product", 3, "Number of images per product")
+	Command.Flags().IntVar(&maxVariants, "max-variants-per-product", 4, "Maximum number of variants per product")
+	Command.Flags().StringVar(&placementPolicy, "product-placement", models.PlacementAny, "Categories products are placed in (any, leaf, depth-weighted)")
+	Command.Flags().StringVar(&placementSpread, "products-per-category", models.SpreadUniform, "Distribution of product counts over categories (uniform, zipf)")
+	Command.Flags().IntVar(&promotionCount, "promotions", 20, "Number of promotions to generate")
 	Command.Flags().IntVar(&orderCount, "orders", 500, "Number of orders to generate")
+	Command.Flags().IntVar(&subscriptionCount, "subscriptions", 50, "Number of subscriptions generating recurring orders alongside the regular orders")
+	Command.Flags().IntVar(&giftCardCount, "gift-cards", 50, "Number of gift cards redeemed into store credit and spent on orders")
+	Command.Flags().Float64Var(&loyaltyRate, "loyalty-enrollment-rate", 0.6, "Fraction of customers enrolled in the loyalty program")
+	Command.Flags().IntVar(&adminCount, "admins", 3, "Number of admin staff editing prices")
+	Command.Flags().IntVar(&agentCount, "support-agents", 10, "Number of support staff answering tickets, cancelling orders and issuing refunds")
+	Command.Flags().IntVar(&warehouseStaffCount, "warehouse-staff", 8, "Number of warehouse staff processing and shipping orders")
+	Command.Flags().IntVar(&ticketCount, "support-tickets", 100, "Number of support tickets, mostly about problematic orders")
+	Command.Flags().IntVar(&abandonedCarts, "abandoned-carts", 300, "Number of carts abandoned without an order, on top of the carts behind orders")
+	Command.Flags().Float64Var(&cartRecoveryRate, "cart-recovery-rate", 0.15, "Fraction of orders placed from a cart recovered after being abandoned")
+	Command.Flags().IntVar(&wishlistCount, "wishlist-items", 400, "Number of wishlist entries")
+	Command.Flags().IntVar(&plantedPairs, "planted-associations", 5, "Number of product pairs deliberately bought together in orders, as ground truth for related products")
+	Command.Flags().IntVar(&relatedMinOrders, "related-min-orders", 2, "Minimum number of orders two products must share to be related")
+	Command.Flags().IntVar(&relatedPerProduct, "related-per-product", 10, "Maximum number of related products kept per product")
 	Command.Flags().IntVar(&maxItemsPerOrder, "max-items-per-order", 5, "Maximum number of items per order")
+	Command.Flags().Float64Var(&returnRate, "partial-return-rate", 0.08, "Fraction of delivered orders with some items returned")
 	Command.Flags().IntVar(&reviewCount, "reviews", 300, "Number of reviews to generate")
+	Command.Flags().IntVar(&searchCount, "search-queries", 1000, "Number of logged search queries besides those made in event sessions, including misspelled and zero-result ones")
+	Command.Flags().Float64Var(&unverifiedRatio, "unverified-review-ratio", 0, "Fraction of reviews written without a verified purchase")
+	Command.Flags().Float64Var(&votesPerReview, "votes-per-review", 3, "Typical number of helpful votes on a review, more on older and extreme-rating reviews")
+	Command.Flags().Float64Var(&reviewReplyRate, "review-reply-rate", 0.15, "Fraction of reviews the seller replies to, tripled for one and two star reviews")
 	Command.Flags().BoolVar(&allFlag, "all", false, "Generate all types of data")
+
+	// Add flags for the time window and traffic shape
+	Command.Flags().StringVar(&startDate, "start-date", "", "Start of the time window (YYYY-MM-DD, defaults to one year before the end date)")
+	Command.Flags().StringVar(&endDate, "end-date", "", "End of the time window (YYYY-MM-DD, defaults to today)")
+	Command.Flags().StringVar(&trafficCurve, "traffic-curve", "retail", "Intraday traffic curve (flat, retail, office, night-owl)")
+	Command.Flags().StringVar(&weeklyPattern, "weekly-pattern", "retail", "Weekday/weekend traffic pattern (flat, retail, office)")
+	Command.Flags().StringVar(&calendarName, "calendar", "us-retail", "Holiday calendar for traffic spikes (none, us-retail, eu-retail)")
+	Command.Flags().Float64Var(&yearlyGrowth, "yearly-growth", 0.2, "Year-over-year traffic growth (0.2 means 20%)")
+
+	// Add flags for generated text
+	Command.Flags().StringVar(&textLength, "text-length", "medium", "Length of generated descriptions, reviews and notes (short, medium, long)")
+
+	// Add flags for currencies
+	Command.Flags().StringVar(&baseCurrencyCode, "base-currency", "USD", "ISO 4217 currency products are priced in")
+
+	// Add flags for clickstream events
+	Command.Flags().StringVar(&eventsOutput, "events-output", models.EventOutputDB, "Where to write sessions and events (none, db, jsonl)")
+	Command.Flags().StringVar(&eventsDir, "events-dir", "events", "Directory for JSONL sessions and events")
+	Command.Flags().Float64Var(&productViewRate, "product-view-rate", 0.55, "Fraction of sessions viewing a product")
+	Command.Flags().Float64Var(&addToCartRate, "add-to-cart-rate", 0.12, "Fraction of sessions adding to the cart")
+	Command.Flags().Float64Var(&checkoutRate, "checkout-rate", 0.06, "Fraction of sessions starting checkout")
+	Command.Flags().Float64Var(&conversionRate, "conversion-rate", 0.03, "Fraction of sessions ending in a purchase")
+
+	// Add flags for multi-tenant seeding
+	Command.Flags().IntVar(&tenantCount, "tenants", 0, "Number of tenants, each with its own users, catalog and orders (0 seeds a single-tenant schema)")
+	Command.Flags().Float64Var(&tenantSizeSkew, "tenant-size-skew", 1, "How fast tenant sizes fall off: the kth tenant gets 1/k^skew of the requested counts")
+	Command.Flags().BoolVar(&keepTenantRLS, "tenant-rls", true, "Keep the row-level security policies isolating tenants after seeding")
+}
+
+// seedCounts holds how many records of each kind to generate
+type seedCounts struct {
+	users          int
+	categories     int
+	sellers        int
+	brands         int
+	products       int
+	promotions     int
+	orders         int
+	subscriptions  int
+	giftCards      int
+	admins         int
+	agents         int
+	warehouseStaff int
+	tickets        int
+	carts          int
+	wishlist       int
+	reviews        int
+	searches       int
+}
+
+// flagCounts returns the record counts given on the command line
+func flagCounts() seedCounts {
+	return seedCounts{
+		users:          userCount,
+		categories:     categoryCount,
+		sellers:        sellerCount,
+		brands:         brandCount,
+		products:       productCount,
+		promotions:     promotionCount,
+		orders:         orderCount,
+		subscriptions:  subscriptionCount,
+		giftCards:      giftCardCount,
+		admins:         adminCount,
+		agents:         agentCount,
+		warehouseStaff: warehouseStaffCount,
+		tickets:        ticketCount,
+		carts:          abandonedCarts,
+		wishlist:       wishlistCount,
+		reviews:        reviewCount,
+		searches:       searchCount,
+	}
+}
+
+// scale returns the counts multiplied by a factor, keeping at least one of each requested kind
+func (c seedCounts) scale(factor float64) seedCounts {
+	scaled := func(n int) int {
+		if n <= 0 {
+			return n
+		}
+		return max(1, int(math.Round(float64(n)*factor)))
+	}
+	return seedCounts{
+		users:          scaled(c.users),
+		categories:     scaled(c.categories),
+		sellers:        scaled(c.sellers),
+		brands:         scaled(c.brands),
+		products:       scaled(c.products),
+		promotions:     scaled(c.promotions),
+		orders:         scaled(c.orders),
+		subscriptions:  scaled(c.subscriptions),
+		giftCards:      scaled(c.giftCards),
+		admins:         scaled(c.admins),
+		agents:         scaled(c.agents),
+		warehouseStaff: scaled(c.warehouseStaff),
+		tickets:        scaled(c.tickets),
+		carts:          scaled(c.carts),
+		wishlist:       scaled(c.wishlist),
+		reviews:        scaled(c.reviews),
+		searches:       scaled(c.searches),
+	}
+}
+
+// flagFunnel returns the funnel rates given on the command line
+func flagFunnel() models.Funnel {
+	return models.Funnel{
+		ProductView: productViewRate,
+		AddToCart:   addToCartRate,
+		Checkout:    checkoutRate,
+		Purchase:    conversionRate,
+	}
+}
+
+// seedData generates every kind of data requested by the flags, in dependency order.
+// Failures are reported as they happen and stop the seeding.
+func seedData(db *sql.DB, counts seedCounts, timeline *timedist.Distribution, baseCurrency money.Currency, eventsDir string) error {
+	if allFlag || counts.users > 0 {
+		if err := seedUsers(db, counts.users, timeline); err != nil {
+			pterm.Error.Println("Failed to seed users:", err)
+			return err
+		}
+	}
+
+	if allFlag || (counts.users > 0 && addressesPerUser > 0) {
+		if err := seedAddresses(db, counts.users, addressesPerUser); err != nil {
+			pterm.Error.Println("Failed to seed addresses:", err)
+			return err
+		}
+	}
+
+	if allFlag || counts.categories > 0 {
+		tree := models.CategoryTree{
+			MaxDepth:     maxCategoryDepth,
+			Branching:    categoryBranch,
+			DepthWeights: categoryWeights,
+			Shape:        categoryShape,
+			Hierarchy:    categoryPathMode,
+		}
+		if err := seedCategories(db, counts.categories, tree); err != nil {
+			pterm.Error.Println("Failed to seed categories:", err)
+			return err
+		}
+	}
+
+	if allFlag || counts.sellers > 0 {
+		if err := seedSellers(db, counts.sellers, timeline); err != nil {
+			pterm.Error.Println("Failed to seed sellers:", err)
+			return err
+		}
+	}
+
+	if allFlag || counts.brands > 0 {
+		if err := seedBrands(db, counts.brands); err != nil {
+			pterm.Error.Println("Failed to seed brands:", err)
+			return err
+		}
+	}
+
+	if allFlag || counts.products > 0 {
+		placement := models.ProductPlacement{Policy: placementPolicy, Spread: placementSpread}
+		if err := seedProducts(db, counts.products, imagesPerProduct, maxVariants, baseCurrency, placement, sellerSkew); err != nil {
+			pterm.Error.Println("Failed to seed products:", err)
+			return err
+		}
+
+		if err := seedPriceHistory(db, timeline); err != nil {
+			pterm.Error.Println("Failed to seed price history:", err)
+			return err
+		}
+
+		if warehouses > 0 {
+			if err := seedWarehouses(db, warehouses); err != nil {
+				pterm.Error.Println("Failed to seed warehouses:", err)
+				return err
+			}
+		}
+	}
+
+	if allFlag || counts.promotions > 0 {
+		if err := seedPromotions(db, counts.promotions, timeline); err != nil {
+			pterm.Error.Println("Failed to seed promotions:", err)
+			return err
+		}
+	}
+
+	if allFlag || counts.orders > 0 {
+		if err := seedExchangeRates(db, baseCurrency, timeline); err != nil {
+			pterm.Error.Println("Failed to seed exchange rates:", err)
+			return err
+		}
+
+		if plantedPairs > 0 {
+			if err := seedPlantedAssociations(db, plantedPairs); err != nil {
+				pterm.Error.Println("Failed to seed planted associations:", err)
+				return err
+			}
+		}
+
+		if err := seedOrders(db, counts.orders, maxItemsPerOrder, timeline, baseCurrency); err != nil {
+			pterm.Error.Println("Failed to seed orders:", err)
+			return err
+		}
+
+		if counts.subscriptions > 0 {
+			if err := seedSubscriptions(db, counts.subscriptions, timeline, baseCurrency); err != nil {
+				pterm.Error.Println("Failed to seed subscriptions:", err)
+				return err
+			}
+		}
+
+		if warehouses > 0 {
+			if err := seedFulfillment(db); err != nil {
+				pterm.Error.Println("Failed to seed fulfillment:", err)
+				return err
+			}
+		}
+
+		if err := seedRelatedProducts(db, relatedMinOrders, relatedPerProduct); err != nil {
+			pterm.Error.Println("Failed to seed related products:", err)
+			return err
+		}
+
+		if err := seedReturns(db, returnRate, timeline); err != nil {
+			pterm.Error.Println("Failed to seed returns:", err)
+			return err
+		}
+
+		if counts.giftCards > 0 {
+			if err := seedGiftCards(db, counts.giftCards, timeline, baseCurrency); err != nil {
+				pterm.Error.Println("Failed to seed gift cards:", err)
+				return err
+			}
+		}
+
+		if err := seedStoreCredit(db); err != nil {
+			pterm.Error.Println("Failed to seed store credit:", err)
+			return err
+		}
+
+		if loyaltyRate > 0 {
+			if err := seedLoyalty(db, loyaltyRate, timeline); err != nil {
+				pterm.Error.Println("Failed to seed loyalty program:", err)
+				return err
+			}
+		}
+
+		staff := map[string]int{
+			models.StaffAdmin:     counts.admins,
+			models.StaffSupport:   counts.agents,
+			models.StaffWarehouse: counts.warehouseStaff,
+		}
+		if err := seedStaff(db, staff, timeline); err != nil {
+			pterm.Error.Println("Failed to seed staff:", err)
+			return err
+		}
+
+		if counts.tickets > 0 {
+			if err := seedSupport(db, counts.tickets, timeline); err != nil {
+				pterm.Error.Println("Failed to seed support tickets:", err)
+				return err
+			}
+		}
+
+		if err := seedCarts(db, counts.carts, cartRecoveryRate, timeline); err != nil {
+			pterm.Error.Println("Failed to seed carts:", err)
+			return err
+		}
+
+		if counts.wishlist > 0 {
+			if err := seedWishlists(db, counts.wishlist, timeline); err != nil {
+				pterm.Error.Println("Failed to seed wishlists:", err)
+				return err
+			}
+		}
+
+		if err := seedAuditLog(db, timeline); err != nil {
+			pterm.Error.Println("Failed to seed audit log:", err)
+			return err
+		}
+	}
+
+	if (allFlag || counts.orders > 0) && eventsOutput != models.EventOutputNone {
+		if err := seedEvents(db, flagFunnel(), timeline, eventsDir); err != nil {
+			pterm.Error.Println("Failed to seed events:", err)
+			return err
+		}
+	}
+
+	if allFlag || counts.reviews > 0 {
+		// Engagement only goes to the reviews written in this run
+		lastReviewID, err := models.GetLastReviewID(db)
+		if err != nil {
+			pterm.Error.Println("Failed to get the last review:", err)
+			return err
+		}
+		if err := seedReviews(db, counts.reviews, unverifiedRatio, timeline); err != nil {
+			pterm.Error.Println("Failed to seed reviews:", err)
+			return err
+		}
+
+		engagement := models.ReviewEngagement{VotesPerReview: votesPerReview, ReplyRate: reviewReplyRate}
+		if err := seedReviewEngagement(db, engagement, lastReviewID, timeline); err != nil {
+			pterm.Error.Println("Failed to seed review engagement:", err)
+			return err
+		}
+	}
+
+	if allFlag || counts.searches > 0 {
+		if err := seedSearchQueries(db, counts.searches, timeline); err != nil {
+			pterm.Error.Println("Failed to seed search queries:", err)
+			return err
+		}
+	}
+
+	// Accounts are closed last, after every other record of the user exists
+	if allFlag || counts.users > 0 {
+		lifecycle := models.AccountLifecycle{
+			ChurnRate:    churnRate,
+			DeletionRate: deletionRate,
+			ErasureRate:  erasureRate,
+		}
+		if err := seedAccountDeletions(db, lifecycle, timeline); err != nil {
+			pterm.Error.Println("Failed to seed account deletions:", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// buildTimeline creates the time distribution from the time window and traffic flags
+func buildTimeline() (*timedist.Distribution, error) {
+	config := timedist.DefaultConfig()
+	config.HourlyCurve = trafficCurve
+	config.WeeklyPattern = weeklyPattern
+	config.Calendar = calendarName
+	config.YearlyGrowth = yearlyGrowth
+
+	if endDate != "" {
+		end, err := time.Parse(time.DateOnly, endDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end date: %w", err)
+		}
+		config.End = end
+		config.Start = end.AddDate(-1, 0, 0)
+	}
+	if startDate != "" {
+		start, err := time.Parse(time.DateOnly, startDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start date: %w", err)
+		}
+		config.Start = start
+	}
+
+	return timedist.New(config)
 }
 
 // Helper functions to seed different types of data
 
-func seedUsers(db *sql.DB, count int) error {
+// seedTenants creates the tenants and seeds each of them through its own connection, scaled
+// to the tenant's size. Tenant connections are subject to row-level security, so everything
+// a tenant's data references is read from the same tenant.
+func seedTenants(config database.Config, adminDB *sql.DB, timeline *timedist.Distribution, baseCurrency money.Currency) error {
+	pterm.DefaultSection.Println("Seeding Tenants")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Generating tenants...").
+		Start()
+
+	tenants, err := models.GenerateTenants(adminDB, tenantCount, tenantSizeSkew)
+	if err != nil {
+		spinner.Fail("Failed to generate tenants")
+		pterm.Error.Println("Failed to seed tenants:", err)
+		return err
+	}
+	spinner.Success("Successfully generated " + pterm.Green(fmt.Sprintf("%d", len(tenants))) + " tenants")
+
+	for _, tenant := range tenants {
+		pterm.DefaultHeader.Printf("Tenant %d: %s (%s plan, %.0f%% size)", tenant.ID, tenant.Name, tenant.Plan, tenant.Scale*100)
+
+		tenantConfig := config
+		tenantConfig.Options = database.TenantOptions(tenant.ID)
+		db, err := database.Connect(tenantConfig)
+		if err != nil {
+			pterm.Error.Println("Failed to connect as tenant:", err)
+			return err
+		}
+
+		err = seedData(db, flagCounts().scale(tenant.Scale), timeline, baseCurrency, filepath.Join(eventsDir, tenant.Slug))
+		db.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if !keepTenantRLS {
+		if err := database.DisableRowLevelSecurity(adminDB); err != nil {
+			pterm.Error.Println("Failed to disable row-level security:", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func seedUsers(db *sql.DB, count int, timeline *timedist.Distribution) error {
 	pterm.DefaultSection.Println("Seeding Users")
 	spinner, _ := pterm.DefaultSpinner.
 		WithShowTimer(true).
 		WithText("Generating users...").
 		Start()
 
-	err := models.GenerateUsers(db, count)
+	err := models.GenerateUsers(db, count, timeline)
 
 	if err != nil {
 		spinner.Fail("Failed to generate users")
@@ -171,14 +688,14 @@ func seedAddresses(db *sql.DB, userCount, addressesPerUser int) error {
 	return nil
 }
 
-func seedCategories(db *sql.DB, count, maxDepth int) error {
+func seedCategories(db *sql.DB, count int, tree models.CategoryTree) error {
 	pterm.DefaultSection.Println("Seeding Categories")
 	spinner, _ := pterm.DefaultSpinner.
 		WithShowTimer(true).
 		WithText("Generating categories...").
 		Start()
 
-	err := models.GenerateCategories(db, count, maxDepth)
+	err := models.GenerateCategories(db, count, tree)
 
 	if err != nil {
 		spinner.Fail("Failed to generate categories")
@@ -189,14 +706,53 @@ func seedCategories(db *sql.DB, count, maxDepth int) error {
 	return nil
 }
 
-func seedProducts(db *sql.DB, count, imagesPerProduct int) error {
+func seedSellers(db *sql.DB, count int, timeline *timedist.Distribution) error {
+	pterm.DefaultSection.Println("Seeding Sellers")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Generating sellers...").
+		Start()
+
+	err := models.GenerateSellers(db, count, timeline)
+
+	if err != nil {
+		spinner.Fail("Failed to generate sellers")
+		return err
+	}
+
+	spinner.Success("Successfully generated " + pterm.Green(fmt.Sprintf("%d", count)) + " sellers")
+	return nil
+}
+
+func seedBrands(db *sql.DB, count int) error {
+	pterm.DefaultSection.Println("Seeding Brands")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Generating brands...").
+		Start()
+
+	err := models.GenerateBrands(db, count)
+
+	if err != nil {
+		spinner.Fail("Failed to generate brands")
+		return err
+	}
+
+	spinner.Success("Successfully generated " + pterm.Green(fmt.Sprintf("%d", count)) + " brands")
+	return nil
+}
+
+func seedProducts(db *sql.DB, count, imagesPerProduct, maxVariants int, baseCurrency money.Currency, placement models.ProductPlacement, sellerSkew float64) error {
 	pterm.DefaultSection.Println("Seeding Products")
 	spinner, _ := pterm.DefaultSpinner.
 		WithShowTimer(true).
 		WithText("Generating products...").
 		Start()
 
-	err := models.GenerateProducts(db, count, imagesPerProduct)
+	err := models.GenerateProducts(db, count, imagesPerProduct, maxVariants, baseCurrency, placement, sellerSkew)
+	if err == nil {
+		err = models.UpdateSearchVectors(db)
+	}
 
 	if err != nil {
 		spinner.Fail("Failed to generate products")
@@ -208,14 +764,143 @@ func seedProducts(db *sql.DB, count, imagesPerProduct int) error {
 	return nil
 }
 
-func seedOrders(db *sql.DB, count, maxItemsPerOrder int) error {
+func seedPriceHistory(db *sql.DB, timeline *timedist.Distribution) error {
+	pterm.DefaultSection.Println("Seeding Price History")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Generating price history...").
+		Start()
+
+	err := models.GeneratePriceHistory(db, timeline)
+
+	if err != nil {
+		spinner.Fail("Failed to generate price history")
+		return err
+	}
+
+	spinner.Success("Successfully generated price history")
+	return nil
+}
+
+func seedWarehouses(db *sql.DB, count int) error {
+	pterm.DefaultSection.Println("Seeding Warehouses")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Generating warehouses and stock levels...").
+		Start()
+
+	err := models.GenerateWarehouses(db, count)
+	if err == nil {
+		err = models.GenerateWarehouseStock(db)
+	}
+
+	if err != nil {
+		spinner.Fail("Failed to generate warehouses")
+		return err
+	}
+
+	spinner.Success("Successfully generated " + pterm.Green(fmt.Sprintf("%d", count)) + " warehouses with stock")
+	return nil
+}
+
+func seedFulfillment(db *sql.DB) error {
+	pterm.DefaultSection.Println("Seeding Fulfillment")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Assigning order items to warehouses...").
+		Start()
+
+	err := models.AssignFulfillment(db)
+
+	if err != nil {
+		spinner.Fail("Failed to assign fulfillment")
+		return err
+	}
+
+	spinner.Success("Successfully assigned order items to the nearest warehouses with stock")
+	return nil
+}
+
+func seedPlantedAssociations(db *sql.DB, count int) error {
+	pterm.DefaultSection.Println("Seeding Planted Associations")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Picking products bought together...").
+		Start()
+
+	err := models.GeneratePlantedAssociations(db, count)
+
+	if err != nil {
+		spinner.Fail("Failed to plant associations")
+		return err
+	}
+
+	spinner.Success("Successfully planted " + pterm.Green(fmt.Sprintf("%d", count)) + " product associations")
+	return nil
+}
+
+func seedRelatedProducts(db *sql.DB, minOrders, perProduct int) error {
+	pterm.DefaultSection.Println("Seeding Related Products")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Computing products bought together...").
+		Start()
+
+	err := models.GenerateRelatedProducts(db, minOrders, perProduct)
+
+	if err != nil {
+		spinner.Fail("Failed to compute related products")
+		return err
+	}
+
+	spinner.Success("Successfully computed related products from order co-occurrence")
+	return nil
+}
+
+func seedPromotions(db *sql.DB, count int, timeline *timedist.Distribution) error {
+	pterm.DefaultSection.Println("Seeding Promotions")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Generating promotions...").
+		Start()
+
+	err := models.GeneratePromotions(db, count, timeline)
+
+	if err != nil {
+		spinner.Fail("Failed to generate promotions")
+		return err
+	}
+
+	spinner.Success("Successfully generated " + pterm.Green(fmt.Sprintf("%d", count)) + " promotions")
+	return nil
+}
+
+func seedExchangeRates(db *sql.DB, baseCurrency money.Currency, timeline *timedist.Distribution) error {
+	pterm.DefaultSection.Println("Seeding Exchange Rates")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Generating exchange rates...").
+		Start()
+
+	err := models.GenerateExchangeRates(db, baseCurrency, timeline)
+
+	if err != nil {
+		spinner.Fail("Failed to generate exchange rates")
+		return err
+	}
+
+	spinner.Success("Successfully generated daily " + pterm.Green(baseCurrency.Code) + " exchange rates")
+	return nil
+}
+
+func seedOrders(db *sql.DB, count, maxItemsPerOrder int, timeline *timedist.Distribution, baseCurrency money.Currency) error {
 	pterm.DefaultSection.Println("Seeding Orders")
 	spinner, _ := pterm.DefaultSpinner.
 		WithShowTimer(true).
 		WithText("Generating orders...").
 		Start()
 
-	err := models.GenerateOrders(db, count, maxItemsPerOrder)
+	err := models.GenerateOrders(db, count, maxItemsPerOrder, timeline, baseCurrency)
 
 	if err != nil {
 		spinner.Fail("Failed to generate orders")
@@ -226,14 +911,284 @@ func seedOrders(db *sql.DB, count, maxItemsPerOrder int) error {
 	return nil
 }
 
-func seedReviews(db *sql.DB, count int) error {
+func seedSubscriptions(db *sql.DB, count int, timeline *timedist.Distribution, baseCurrency money.Currency) error {
+	pterm.DefaultSection.Println("Seeding Subscriptions")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Generating subscriptions and recurring orders...").
+		Start()
+
+	err := models.GenerateSubscriptions(db, count, timeline, baseCurrency)
+
+	if err != nil {
+		spinner.Fail("Failed to generate subscriptions")
+		return err
+	}
+
+	spinner.Success("Successfully generated " + pterm.Green(fmt.Sprintf("%d", count)) + " subscriptions")
+	return nil
+}
+
+func seedReturns(db *sql.DB, partialReturnRate float64, timeline *timedist.Distribution) error {
+	pterm.DefaultSection.Println("Seeding Returns")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Generating returns and refunds...").
+		Start()
+
+	err := models.GenerateReturns(db, partialReturnRate, timeline)
+
+	if err != nil {
+		spinner.Fail("Failed to generate returns")
+		return err
+	}
+
+	spinner.Success("Successfully generated returns and refunds")
+	return nil
+}
+
+func seedGiftCards(db *sql.DB, count int, timeline *timedist.Distribution, baseCurrency money.Currency) error {
+	pterm.DefaultSection.Println("Seeding Gift Cards")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Generating gift cards...").
+		Start()
+
+	err := models.GenerateGiftCards(db, count, timeline, baseCurrency)
+
+	if err != nil {
+		spinner.Fail("Failed to generate gift cards")
+		return err
+	}
+
+	spinner.Success("Successfully generated " + pterm.Green(fmt.Sprintf("%d", count)) + " gift cards")
+	return nil
+}
+
+func seedStoreCredit(db *sql.DB) error {
+	pterm.DefaultSection.Println("Seeding Store Credit and Payments")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Building the store credit ledger and order payments...").
+		Start()
+
+	err := models.GenerateStoreCredit(db)
+
+	if err != nil {
+		spinner.Fail("Failed to generate store credit")
+		return err
+	}
+
+	spinner.Success("Successfully generated the store credit ledger and order payments")
+	return nil
+}
+
+func seedLoyalty(db *sql.DB, enrollmentRate float64, timeline *timedist.Distribution) error {
+	pterm.DefaultSection.Println("Seeding Loyalty Program")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Generating loyalty accounts and points...").
+		Start()
+
+	err := models.GenerateLoyalty(db, enrollmentRate, timeline)
+
+	if err != nil {
+		spinner.Fail("Failed to generate loyalty program")
+		return err
+	}
+
+	spinner.Success("Successfully generated loyalty accounts, points and tier history")
+	return nil
+}
+
+func seedStaff(db *sql.DB, counts map[string]int, timeline *timedist.Distribution) error {
+	pterm.DefaultSection.Println("Seeding Staff")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Generating staff...").
+		Start()
+
+	total := 0
+	for _, role := range []string{models.StaffAdmin, models.StaffSupport, models.StaffWarehouse} {
+		if err := models.GenerateStaff(db, role, counts[role], timeline); err != nil {
+			spinner.Fail("Failed to generate staff")
+			return err
+		}
+		total += counts[role]
+	}
+
+	spinner.Success("Successfully generated " + pterm.Green(fmt.Sprintf("%d", total)) + " staff members")
+	return nil
+}
+
+func seedSupport(db *sql.DB, ticketCount int, timeline *timedist.Distribution) error {
+	pterm.DefaultSection.Println("Seeding Support Tickets")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Generating support tickets...").
+		Start()
+
+	err := models.GenerateSupportTickets(db, ticketCount, timeline)
+
+	if err != nil {
+		spinner.Fail("Failed to generate support tickets")
+		return err
+	}
+
+	spinner.Success("Successfully generated " + pterm.Green(fmt.Sprintf("%d", ticketCount)) + " tickets")
+	return nil
+}
+
+func seedAuditLog(db *sql.DB, timeline *timedist.Distribution) error {
+	pterm.DefaultSection.Println("Seeding Audit Log")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Recording staff actions...").
+		Start()
+
+	err := models.GenerateAuditLog(db, timeline)
+
+	if err != nil {
+		spinner.Fail("Failed to generate audit log")
+		return err
+	}
+
+	spinner.Success("Successfully recorded staff actions in the audit log")
+	return nil
+}
+
+func seedReviewEngagement(db *sql.DB, engagement models.ReviewEngagement, afterID int, timeline *timedist.Distribution) error {
+	pterm.DefaultSection.Println("Seeding Review Engagement")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Generating review votes, replies and photos...").
+		Start()
+
+	err := models.GenerateReviewEngagement(db, engagement, afterID, timeline)
+
+	if err != nil {
+		spinner.Fail("Failed to generate review engagement")
+		return err
+	}
+
+	spinner.Success("Successfully generated review votes, replies and photos")
+	return nil
+}
+
+func seedSearchQueries(db *sql.DB, count int, timeline *timedist.Distribution) error {
+	pterm.DefaultSection.Println("Seeding Search Queries")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Generating search queries...").
+		Start()
+
+	err := models.GenerateSearchQueries(db, count, timeline)
+
+	if err != nil {
+		spinner.Fail("Failed to generate search queries")
+		return err
+	}
+
+	spinner.Success("Successfully generated " + pterm.Green(fmt.Sprintf("%d", count)) + " search queries")
+	return nil
+}
+
+func seedAccountDeletions(db *sql.DB, lifecycle models.AccountLifecycle, timeline *timedist.Distribution) error {
+	pterm.DefaultSection.Println("Seeding Account Deletions")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Churning, deleting and erasing accounts...").
+		Start()
+
+	err := models.GenerateAccountDeletions(db, lifecycle, timeline)
+
+	if err != nil {
+		spinner.Fail("Failed to close accounts")
+		return err
+	}
+
+	spinner.Success("Successfully churned, deleted and erased accounts")
+	return nil
+}
+
+func seedCarts(db *sql.DB, abandonedCount int, recoveryRate float64, timeline *timedist.Distribution) error {
+	pterm.DefaultSection.Println("Seeding Carts")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Generating carts...").
+		Start()
+
+	err := models.GenerateCarts(db, abandonedCount, recoveryRate, timeline)
+
+	if err != nil {
+		spinner.Fail("Failed to generate carts")
+		return err
+	}
+
+	spinner.Success("Successfully generated carts for orders and " + pterm.Green(fmt.Sprintf("%d", abandonedCount)) + " abandoned carts")
+	return nil
+}
+
+func seedWishlists(db *sql.DB, count int, timeline *timedist.Distribution) error {
+	pterm.DefaultSection.Println("Seeding Wishlists")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Generating wishlist items...").
+		Start()
+
+	// A third of saved products end up being ordered
+	err := models.GenerateWishlists(db, count, 0.3, timeline)
+
+	if err != nil {
+		spinner.Fail("Failed to generate wishlists")
+		return err
+	}
+
+	spinner.Success("Successfully generated " + pterm.Green(fmt.Sprintf("%d", count)) + " wishlist items")
+	return nil
+}
+
+func seedEvents(db *sql.DB, funnel models.Funnel, timeline *timedist.Distribution, eventsDir string) error {
+	pterm.DefaultSection.Println("Seeding Events")
+	spinner, _ := pterm.DefaultSpinner.
+		WithShowTimer(true).
+		WithText("Generating sessions and events...").
+		Start()
+
+	var sink models.EventSink
+	var err error
+	switch eventsOutput {
+	case models.EventOutputDB:
+		sink, err = models.NewDBEventSink(db)
+	case models.EventOutputJSONL:
+		sink, err = models.NewJSONLEventSink(eventsDir)
+	default:
+		err = fmt.Errorf("unknown events output %q (available: none, db, jsonl)", eventsOutput)
+	}
+	if err == nil {
+		err = models.GenerateEvents(db, sink, funnel, timeline)
+		if closeErr := sink.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	if err != nil {
+		spinner.Fail("Failed to generate events")
+		return err
+	}
+
+	spinner.Success("Successfully generated sessions and events into " + pterm.Green(eventsOutput))
+	return nil
+}
+
+func seedReviews(db *sql.DB, count int, unverifiedRatio float64, timeline *timedist.Distribution) error {
 	pterm.DefaultSection.Println("Seeding Reviews")
 	spinner, _ := pterm.DefaultSpinner.
 		WithShowTimer(true).
 		WithText("Generating reviews...").
 		Start()
 
-	err := models.GenerateReviews(db, count)
+	err := models.GenerateReviews(db, count, unverifiedRatio, timeline)
 
 	if err != nil {
 		spinner.Fail("Failed to generate reviews")
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"time"
 
 	_ "github.com/lib/pq"
 )
@@ -16,6 +17,7 @@ type Config struct {
 	Password string
 	DBName   string
 	SSLMode  string
+	Options  string // Runtime parameters set on every connection, such as "-c app.tenant_id=1"
 }
 
 // DefaultConfig returns the default database configuration from docker-compose.yml
@@ -36,6 +38,9 @@ func Connect(config Config) (*sql.DB, error) {
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		config.Host, config.Port, config.User, config.Password, config.DBName, config.SSLMode,
 	)
+	if config.Options != "" {
+		connStr += fmt.Sprintf(" options='%s'", config.Options)
+	}
 
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
@@ -61,8 +66,18 @@ func CreateTables(db *sql.DB) error {
 			first_name VARCHAR(100) NOT NULL,
 			last_name VARCHAR(100) NOT NULL,
 			phone VARCHAR(20),
+			status VARCHAR(20) NOT NULL DEFAULT 'Active',
+			deleted_at TIMESTAMP,
 			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			CHECK (deleted_at IS NULL OR deleted_at >= created_at)
+		)`,
+
+		// User segments table, recording the persona each user was generated with
+		`CREATE TABLE IF NOT EXISTS user_segments (
+			user_id INT PRIMARY KEY REFERENCES users(id),
+			segment VARCHAR(50) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
 		)`,
 
 		// Addresses table
@@ -75,7 +90,10 @@ func CreateTables(db *sql.DB) error {
 			state VARCHAR(100) NOT NULL,
 			postal_code VARCHAR(20) NOT NULL,
 			country VARCHAR(100) NOT NULL,
+			latitude NUMERIC(9, 6),
+			longitude NUMERIC(9, 6),
 			is_default BOOLEAN NOT NULL DEFAULT FALSE,
+			deleted_at TIMESTAMP,
 			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
 			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
 		)`,
@@ -86,6 +104,37 @@ func CreateTables(db *sql.DB) error {
 			name VARCHAR(100) NOT NULL,
 			description TEXT,
 			parent_id INT REFERENCES categories(id),
+			depth INT NOT NULL DEFAULT 1,
+			path TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			UNIQUE NULLS NOT DISTINCT (parent_id, name)
+		)`,
+
+		// Category closure table, holding every ancestor-descendant pair
+		`CREATE TABLE IF NOT EXISTS category_closure (
+			ancestor_id INT NOT NULL REFERENCES categories(id),
+			descendant_id INT NOT NULL REFERENCES categories(id),
+			depth INT NOT NULL,
+			PRIMARY KEY (ancestor_id, descendant_id)
+		)`,
+
+		// Sellers table, the merchants listing products on the marketplace
+		`CREATE TABLE IF NOT EXISTS sellers (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			email VARCHAR(255) UNIQUE NOT NULL,
+			country CHAR(2) NOT NULL,
+			rating NUMERIC(3, 2) NOT NULL CHECK (rating BETWEEN 1 AND 5),
+			commission_percent NUMERIC(5, 2) NOT NULL CHECK (commission_percent >= 0 AND commission_percent < 100),
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+
+		// Brands table
+		`CREATE TABLE IF NOT EXISTS brands (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(100) UNIQUE NOT NULL,
 			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
 			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
 		)`,
@@ -96,11 +145,29 @@ func CreateTables(db *sql.DB) error {
 			name VARCHAR(255) NOT NULL,
 			description TEXT NOT NULL,
 			price DECIMAL(10, 2) NOT NULL,
+			currency CHAR(3) NOT NULL DEFAULT 'USD',
 			stock_quantity INT NOT NULL,
 			category_id INT NOT NULL REFERENCES categories(id),
+			seller_id INT REFERENCES sellers(id),
+			brand_id INT REFERENCES brands(id),
 			sku VARCHAR(50) UNIQUE NOT NULL,
 			weight DECIMAL(8, 2),
 			dimensions VARCHAR(50),
+			attributes JSONB NOT NULL DEFAULT '{}',
+			search_vector TSVECTOR,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+
+		// Product variants table, one row per purchasable option combination
+		`CREATE TABLE IF NOT EXISTS product_variants (
+			id SERIAL PRIMARY KEY,
+			product_id INT NOT NULL REFERENCES products(id),
+			sku VARCHAR(60) UNIQUE NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			options JSONB NOT NULL DEFAULT '{}',
+			price_delta DECIMAL(10, 2) NOT NULL DEFAULT 0,
+			stock_quantity INT NOT NULL,
 			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
 			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
 		)`,
@@ -115,20 +182,113 @@ func CreateTables(db *sql.DB) error {
 			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
 		)`,
 
+		// Product price history table, one row per period at a list price
+		`CREATE TABLE IF NOT EXISTS product_price_history (
+			id SERIAL PRIMARY KEY,
+			product_id INT NOT NULL REFERENCES products(id),
+			price DECIMAL(10, 2) NOT NULL,
+			currency CHAR(3) NOT NULL DEFAULT 'USD',
+			valid_from TIMESTAMP NOT NULL,
+			valid_to TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			CHECK (valid_to IS NULL OR valid_to > valid_from)
+		)`,
+
+		// Warehouses table, the fulfillment centers stock is held in
+		`CREATE TABLE IF NOT EXISTS warehouses (
+			id SERIAL PRIMARY KEY,
+			code VARCHAR(10) UNIQUE NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			city VARCHAR(100) NOT NULL,
+			country VARCHAR(100) NOT NULL,
+			latitude NUMERIC(9, 6) NOT NULL,
+			longitude NUMERIC(9, 6) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+
+		// Warehouse stock table, how much of each product or variant every warehouse holds
+		`CREATE TABLE IF NOT EXISTS warehouse_stock (
+			id SERIAL PRIMARY KEY,
+			warehouse_id INT NOT NULL REFERENCES warehouses(id),
+			product_id INT NOT NULL REFERENCES products(id),
+			variant_id INT REFERENCES product_variants(id),
+			quantity INT NOT NULL CHECK (quantity >= 0),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			UNIQUE NULLS NOT DISTINCT (warehouse_id, product_id, variant_id)
+		)`,
+
+		// Promotions table, discounting a category subtree or the whole catalog
+		`CREATE TABLE IF NOT EXISTS promotions (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			discount_percent NUMERIC(5, 2) NOT NULL CHECK (discount_percent > 0 AND discount_percent < 100),
+			category_id INT REFERENCES categories(id),
+			starts_at TIMESTAMP NOT NULL,
+			ends_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			CHECK (ends_at > starts_at)
+		)`,
+
+		// Subscriptions table, products delivered on a recurring schedule
+		`CREATE TABLE IF NOT EXISTS subscriptions (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id),
+			product_id INT NOT NULL REFERENCES products(id),
+			variant_id INT REFERENCES product_variants(id),
+			quantity INT NOT NULL CHECK (quantity > 0),
+			plan VARCHAR(50) NOT NULL,
+			billing_interval VARCHAR(20) NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			shipping_address_id INT NOT NULL REFERENCES addresses(id),
+			payment_method VARCHAR(50) NOT NULL,
+			next_billing_date DATE,
+			started_at TIMESTAMP NOT NULL,
+			cancelled_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			CHECK (cancelled_at IS NULL OR cancelled_at >= started_at)
+		)`,
+
 		// Orders table
 		`CREATE TABLE IF NOT EXISTS orders (
 			id SERIAL PRIMARY KEY,
 			user_id INT NOT NULL REFERENCES users(id),
+			subscription_id INT REFERENCES subscriptions(id),
 			status VARCHAR(50) NOT NULL,
-			total_amount DECIMAL(10, 2) NOT NULL,
+			currency CHAR(3) NOT NULL DEFAULT 'USD',
+			exchange_rate NUMERIC(18, 8) NOT NULL DEFAULT 1,
+			subtotal DECIMAL(14, 2) NOT NULL,
+			discount_amount DECIMAL(14, 2) NOT NULL DEFAULT 0,
+			discount_code VARCHAR(50),
+			shipping_cost DECIMAL(14, 2) NOT NULL DEFAULT 0,
+			tax_amount DECIMAL(14, 2) NOT NULL DEFAULT 0,
+			total_amount DECIMAL(14, 2) NOT NULL,
 			shipping_address_id INT NOT NULL REFERENCES addresses(id),
 			billing_address_id INT NOT NULL REFERENCES addresses(id),
 			payment_method VARCHAR(50) NOT NULL,
 			shipping_method VARCHAR(50) NOT NULL,
 			tracking_number VARCHAR(100),
 			notes TEXT,
+			delivered_at TIMESTAMP,
 			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			CHECK (total_amount = subtotal - discount_amount + shipping_cost + tax_amount)
+		)`,
+
+		// Shipments table, one parcel per seller fulfilling part of an order
+		`CREATE TABLE IF NOT EXISTS shipments (
+			id SERIAL PRIMARY KEY,
+			order_id INT NOT NULL REFERENCES orders(id),
+			seller_id INT REFERENCES sellers(id),
+			carrier VARCHAR(50) NOT NULL,
+			tracking_number VARCHAR(100) NOT NULL,
+			status VARCHAR(50) NOT NULL,
+			shipped_at TIMESTAMP NOT NULL,
+			delivered_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			CHECK (delivered_at IS NULL OR delivered_at >= shipped_at)
 		)`,
 
 		// Order items table
@@ -136,12 +296,295 @@ func CreateTables(db *sql.DB) error {
 			id SERIAL PRIMARY KEY,
 			order_id INT NOT NULL REFERENCES orders(id),
 			product_id INT NOT NULL REFERENCES products(id),
+			variant_id INT REFERENCES product_variants(id),
+			promotion_id INT REFERENCES promotions(id),
+			shipment_id INT REFERENCES shipments(id),
+			warehouse_id INT REFERENCES warehouses(id),
 			quantity INT NOT NULL,
-			price_per_unit DECIMAL(10, 2) NOT NULL,
+			price_per_unit DECIMAL(14, 2) NOT NULL,
 			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
 			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
 		)`,
 
+		// Subscription events table, the history of each subscription
+		`CREATE TABLE IF NOT EXISTS subscription_events (
+			id SERIAL PRIMARY KEY,
+			subscription_id INT NOT NULL REFERENCES subscriptions(id),
+			event_type VARCHAR(30) NOT NULL,
+			order_id INT REFERENCES orders(id),
+			occurred_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+
+		// Returns table, one per order sent back
+		`CREATE TABLE IF NOT EXISTS returns (
+			id SERIAL PRIMARY KEY,
+			order_id INT NOT NULL REFERENCES orders(id),
+			status VARCHAR(50) NOT NULL,
+			reason VARCHAR(100) NOT NULL,
+			requested_at TIMESTAMP NOT NULL,
+			received_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			CHECK (received_at IS NULL OR received_at >= requested_at)
+		)`,
+
+		// Return items table
+		`CREATE TABLE IF NOT EXISTS return_items (
+			id SERIAL PRIMARY KEY,
+			return_id INT NOT NULL REFERENCES returns(id),
+			order_item_id INT NOT NULL REFERENCES order_items(id),
+			quantity INT NOT NULL CHECK (quantity > 0),
+			condition VARCHAR(50) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			UNIQUE(return_id, order_item_id)
+		)`,
+
+		// Refunds table, in the currency of the order
+		`CREATE TABLE IF NOT EXISTS refunds (
+			id SERIAL PRIMARY KEY,
+			order_id INT NOT NULL REFERENCES orders(id),
+			return_id INT REFERENCES returns(id),
+			amount DECIMAL(14, 2) NOT NULL CHECK (amount >= 0),
+			currency CHAR(3) NOT NULL,
+			method VARCHAR(50) NOT NULL,
+			processed_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+
+		// Gift cards table, redeemed into store credit
+		`CREATE TABLE IF NOT EXISTS gift_cards (
+			id SERIAL PRIMARY KEY,
+			code VARCHAR(20) UNIQUE NOT NULL,
+			initial_balance DECIMAL(14, 2) NOT NULL CHECK (initial_balance > 0),
+			currency CHAR(3) NOT NULL,
+			purchaser_user_id INT REFERENCES users(id),
+			redeemed_by_user_id INT REFERENCES users(id),
+			issued_at TIMESTAMP NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			redeemed_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			CHECK (redeemed_at IS NULL OR redeemed_at BETWEEN issued_at AND expires_at)
+		)`,
+
+		// Store credit accounts table, one per customer and currency
+		`CREATE TABLE IF NOT EXISTS store_credit_accounts (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id),
+			currency CHAR(3) NOT NULL,
+			balance DECIMAL(14, 2) NOT NULL DEFAULT 0 CHECK (balance >= 0),
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			UNIQUE (user_id, currency)
+		)`,
+
+		// Store credit ledger table, every credit and debit on an account
+		`CREATE TABLE IF NOT EXISTS store_credit_ledger (
+			id SERIAL PRIMARY KEY,
+			account_id INT NOT NULL REFERENCES store_credit_accounts(id),
+			entry_type VARCHAR(30) NOT NULL,
+			amount DECIMAL(14, 2) NOT NULL CHECK (amount <> 0),
+			balance_after DECIMAL(14, 2) NOT NULL CHECK (balance_after >= 0),
+			gift_card_id INT REFERENCES gift_cards(id),
+			order_id INT REFERENCES orders(id),
+			refund_id INT REFERENCES refunds(id),
+			occurred_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+
+		// Order payments table, splitting an order's total between payment methods
+		`CREATE TABLE IF NOT EXISTS order_payments (
+			id SERIAL PRIMARY KEY,
+			order_id INT NOT NULL REFERENCES orders(id),
+			method VARCHAR(50) NOT NULL,
+			amount DECIMAL(14, 2) NOT NULL CHECK (amount > 0),
+			ledger_entry_id INT REFERENCES store_credit_ledger(id),
+			paid_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+
+		// Loyalty accounts table, one per enrolled customer
+		`CREATE TABLE IF NOT EXISTS loyalty_accounts (
+			id SERIAL PRIMARY KEY,
+			user_id INT UNIQUE NOT NULL REFERENCES users(id),
+			tier VARCHAR(20) NOT NULL,
+			points_balance INT NOT NULL DEFAULT 0 CHECK (points_balance >= 0),
+			lifetime_points INT NOT NULL DEFAULT 0,
+			enrolled_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+
+		// Loyalty transactions table, points earned on and redeemed against orders
+		`CREATE TABLE IF NOT EXISTS loyalty_transactions (
+			id SERIAL PRIMARY KEY,
+			account_id INT NOT NULL REFERENCES loyalty_accounts(id),
+			transaction_type VARCHAR(20) NOT NULL,
+			points INT NOT NULL CHECK (points <> 0),
+			balance_after INT NOT NULL CHECK (balance_after >= 0),
+			order_id INT REFERENCES orders(id),
+			occurred_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+
+		// Loyalty tier changes table, the tier history of each account
+		`CREATE TABLE IF NOT EXISTS loyalty_tier_changes (
+			id SERIAL PRIMARY KEY,
+			account_id INT NOT NULL REFERENCES loyalty_accounts(id),
+			from_tier VARCHAR(20),
+			to_tier VARCHAR(20) NOT NULL,
+			changed_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+
+		// Support agents became staff with a role. Databases seeded before that have their
+		// agents table renamed, so tickets and messages keep pointing at the same people.
+		`DO $$
+		DECLARE
+			con RECORD;
+		BEGIN
+			IF to_regclass('support_agents') IS NOT NULL AND to_regclass('staff') IS NULL THEN
+				FOR con IN SELECT conname FROM pg_constraint WHERE conrelid = 'support_agents'::regclass LOOP
+					EXECUTE format('ALTER TABLE support_agents RENAME CONSTRAINT %I TO %I',
+						con.conname, replace(con.conname, 'support_agents', 'staff'));
+				END LOOP;
+				ALTER TABLE support_agents RENAME TO staff;
+				ALTER SEQUENCE IF EXISTS support_agents_id_seq RENAME TO staff_id_seq;
+				ALTER TABLE staff ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'support'
+					CHECK (role IN ('admin', 'support', 'warehouse'));
+				ALTER TABLE staff ALTER COLUMN role DROP DEFAULT;
+			END IF;
+		END $$`,
+
+		// Staff table, employees with back office access
+		`CREATE TABLE IF NOT EXISTS staff (
+			id SERIAL PRIMARY KEY,
+			first_name VARCHAR(100) NOT NULL,
+			last_name VARCHAR(100) NOT NULL,
+			email VARCHAR(255) UNIQUE NOT NULL,
+			role VARCHAR(20) NOT NULL CHECK (role IN ('admin', 'support', 'warehouse')),
+			team VARCHAR(50) NOT NULL,
+			hired_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+
+		// Support tickets table, often about an order
+		`CREATE TABLE IF NOT EXISTS support_tickets (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id),
+			order_id INT REFERENCES orders(id),
+			subject VARCHAR(255) NOT NULL,
+			category VARCHAR(50) NOT NULL,
+			priority VARCHAR(20) NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			channel VARCHAR(20) NOT NULL,
+			assigned_agent_id INT REFERENCES staff(id),
+			opened_at TIMESTAMP NOT NULL,
+			first_response_at TIMESTAMP,
+			resolved_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			CHECK (first_response_at IS NULL OR first_response_at >= opened_at),
+			CHECK (resolved_at IS NULL OR resolved_at >= opened_at)
+		)`,
+
+		// Ticket messages table, the conversation on each ticket
+		`CREATE TABLE IF NOT EXISTS ticket_messages (
+			id SERIAL PRIMARY KEY,
+			ticket_id INT NOT NULL REFERENCES support_tickets(id),
+			author_type VARCHAR(20) NOT NULL,
+			agent_id INT REFERENCES staff(id),
+			body TEXT NOT NULL,
+			sent_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+
+		// Carts table, converted into an order or abandoned
+		`CREATE TABLE IF NOT EXISTS carts (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id),
+			status VARCHAR(20) NOT NULL,
+			order_id INT UNIQUE REFERENCES orders(id),
+			abandoned_at TIMESTAMP,
+			recovery_email_sent_at TIMESTAMP,
+			converted_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			CHECK (abandoned_at IS NULL OR abandoned_at >= created_at),
+			CHECK (converted_at IS NULL OR converted_at >= created_at)
+		)`,
+
+		// Cart items table
+		`CREATE TABLE IF NOT EXISTS cart_items (
+			id SERIAL PRIMARY KEY,
+			cart_id INT NOT NULL REFERENCES carts(id),
+			product_id INT NOT NULL REFERENCES products(id),
+			variant_id INT REFERENCES product_variants(id),
+			quantity INT NOT NULL CHECK (quantity > 0),
+			added_at TIMESTAMP NOT NULL
+		)`,
+
+		// Wishlist items table, products saved for later
+		`CREATE TABLE IF NOT EXISTS wishlist_items (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id),
+			product_id INT NOT NULL REFERENCES products(id),
+			added_at TIMESTAMP NOT NULL,
+			purchased_order_id INT REFERENCES orders(id),
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			UNIQUE (user_id, product_id)
+		)`,
+
+		// Planted associations table, product pairs deliberately bought together in generated
+		// orders as ground truth for recommendations
+		`CREATE TABLE IF NOT EXISTS planted_associations (
+			id SERIAL PRIMARY KEY,
+			anchor_product_id INT NOT NULL REFERENCES products(id),
+			partner_product_id INT NOT NULL REFERENCES products(id),
+			rate NUMERIC(4, 3) NOT NULL CHECK (rate > 0 AND rate <= 1),
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			UNIQUE (anchor_product_id, partner_product_id),
+			CHECK (anchor_product_id <> partner_product_id)
+		)`,
+
+		// Related products table, products frequently bought together computed from orders
+		`CREATE TABLE IF NOT EXISTS related_products (
+			id SERIAL PRIMARY KEY,
+			product_id INT NOT NULL REFERENCES products(id),
+			related_product_id INT NOT NULL REFERENCES products(id),
+			co_purchase_count INT NOT NULL CHECK (co_purchase_count > 0),
+			confidence NUMERIC(6, 4) NOT NULL,
+			lift NUMERIC(12, 4) NOT NULL,
+			rank INT NOT NULL CHECK (rank > 0),
+			planted BOOLEAN NOT NULL DEFAULT FALSE,
+			computed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			UNIQUE (product_id, related_product_id)
+		)`,
+
+		// Audit log table, the actions staff took on other records
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id BIGSERIAL PRIMARY KEY,
+			staff_id INT NOT NULL REFERENCES staff(id),
+			action VARCHAR(50) NOT NULL,
+			entity_type VARCHAR(50) NOT NULL,
+			entity_id INT NOT NULL,
+			old_values JSONB,
+			new_values JSONB NOT NULL,
+			occurred_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+
+		// Exchange rates table, with daily rates from a base currency
+		`CREATE TABLE IF NOT EXISTS exchange_rates (
+			id SERIAL PRIMARY KEY,
+			rate_date DATE NOT NULL,
+			base_currency CHAR(3) NOT NULL,
+			quote_currency CHAR(3) NOT NULL,
+			rate NUMERIC(18, 8) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			CONSTRAINT exchange_rates_day_key UNIQUE (rate_date, base_currency, quote_currency)
+		)`,
+
 		// Reviews table
 		`CREATE TABLE IF NOT EXISTS reviews (
 			id SERIAL PRIMARY KEY,
@@ -150,9 +593,161 @@ func CreateTables(db *sql.DB) error {
 			rating INT NOT NULL CHECK (rating BETWEEN 1 AND 5),
 			title VARCHAR(255) NOT NULL,
 			content TEXT NOT NULL,
+			order_id INT REFERENCES orders(id),
+			verified_purchase BOOLEAN NOT NULL DEFAULT FALSE,
 			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			UNIQUE (product_id, user_id)
 		)`,
+
+		// Review votes table, other users finding a review helpful or not
+		`CREATE TABLE IF NOT EXISTS review_votes (
+			id SERIAL PRIMARY KEY,
+			review_id INT NOT NULL REFERENCES reviews(id),
+			user_id INT NOT NULL REFERENCES users(id),
+			helpful BOOLEAN NOT NULL,
+			voted_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			UNIQUE (review_id, user_id)
+		)`,
+
+		// Review replies table, the seller answering a review. The seller is NULL for
+		// products the store sells itself.
+		`CREATE TABLE IF NOT EXISTS review_replies (
+			id SERIAL PRIMARY KEY,
+			review_id INT NOT NULL REFERENCES reviews(id),
+			seller_id INT REFERENCES sellers(id),
+			body TEXT NOT NULL,
+			replied_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+
+		// Review images table, photos uploaded with a review
+		`CREATE TABLE IF NOT EXISTS review_images (
+			id SERIAL PRIMARY KEY,
+			review_id INT NOT NULL REFERENCES reviews(id),
+			image_url VARCHAR(255) NOT NULL,
+			position INT NOT NULL CHECK (position > 0),
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			UNIQUE (review_id, position)
+		)`,
+
+		// Search queries table, what shoppers searched for and how many products matched
+		`CREATE TABLE IF NOT EXISTS search_queries (
+			id BIGSERIAL PRIMARY KEY,
+			user_id INT REFERENCES users(id),
+			query VARCHAR(255) NOT NULL,
+			result_count INT NOT NULL CHECK (result_count >= 0),
+			clicked_product_id INT REFERENCES products(id),
+			searched_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+
+		// Sessions table, one per visit to the store
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id BIGSERIAL PRIMARY KEY,
+			user_id INT REFERENCES users(id),
+			device VARCHAR(20) NOT NULL,
+			channel VARCHAR(50) NOT NULL,
+			landing_page VARCHAR(255) NOT NULL,
+			order_id INT REFERENCES orders(id),
+			started_at TIMESTAMP NOT NULL,
+			ended_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+
+		// Events table, partitioned by month. Like most analytics tables it has no foreign
+		// keys so events stay cheap to ingest; partitions are created by CreateEventPartitions.
+		`CREATE TABLE IF NOT EXISTS events (
+			id BIGSERIAL,
+			session_id BIGINT NOT NULL,
+			user_id INT,
+			event_type VARCHAR(30) NOT NULL,
+			page VARCHAR(255) NOT NULL,
+			product_id INT,
+			search_query VARCHAR(255),
+			order_id INT,
+			properties JSONB NOT NULL DEFAULT '{}',
+			occurred_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (id, occurred_at)
+		) PARTITION BY RANGE (occurred_at)`,
+
+		// Columns and constraints added to tables after they were first created, migrating
+		// databases seeded with an earlier schema
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS delivered_at TIMESTAMP`,
+		`ALTER TABLE reviews ADD COLUMN IF NOT EXISTS order_id INT REFERENCES orders(id)`,
+		`ALTER TABLE reviews ADD COLUMN IF NOT EXISTS verified_purchase BOOLEAN NOT NULL DEFAULT FALSE`,
+		addUniqueConstraint("reviews", "reviews_product_id_user_id_key", "UNIQUE (product_id, user_id)", "product_id, user_id"),
+		// Orders placed before totals were broken down count their whole total as subtotal
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS subtotal DECIMAL(14, 2)`,
+		`UPDATE orders SET subtotal = total_amount WHERE subtotal IS NULL`,
+		`ALTER TABLE orders ALTER COLUMN subtotal SET NOT NULL`,
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS discount_amount DECIMAL(14, 2) NOT NULL DEFAULT 0`,
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS discount_code VARCHAR(50)`,
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_cost DECIMAL(14, 2) NOT NULL DEFAULT 0`,
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS tax_amount DECIMAL(14, 2) NOT NULL DEFAULT 0`,
+		addConstraint("orders", "orders_check", "CHECK (total_amount = subtotal - discount_amount + shipping_cost + tax_amount)"),
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD'`,
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD'`,
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS exchange_rate NUMERIC(18, 8) NOT NULL DEFAULT 1`,
+		widenDecimal("orders", "total_amount", 14, 2),
+		widenDecimal("order_items", "price_per_unit", 14, 2),
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}'`,
+		`ALTER TABLE order_items ADD COLUMN IF NOT EXISTS variant_id INT REFERENCES product_variants(id)`,
+		// Categories created before depths were stored get theirs from the tree
+		`DO $$ BEGIN
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+				WHERE table_schema = current_schema() AND table_name = 'categories' AND column_name = 'depth') THEN
+				ALTER TABLE categories ADD COLUMN depth INT NOT NULL DEFAULT 1;
+				WITH RECURSIVE tree AS (
+					SELECT id, 1 AS depth FROM categories WHERE parent_id IS NULL
+					UNION ALL
+					SELECT c.id, t.depth + 1 FROM categories c JOIN tree t ON c.parent_id = t.id
+				)
+				UPDATE categories c SET depth = t.depth FROM tree t WHERE t.id = c.id;
+			END IF;
+		END $$`,
+		`ALTER TABLE categories ADD COLUMN IF NOT EXISTS path TEXT`,
+		addUniqueConstraint("categories", "categories_parent_id_name_key", "UNIQUE NULLS NOT DISTINCT (parent_id, name)", "parent_id, name"),
+		`ALTER TABLE order_items ADD COLUMN IF NOT EXISTS promotion_id INT REFERENCES promotions(id)`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS seller_id INT REFERENCES sellers(id)`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS brand_id INT REFERENCES brands(id)`,
+		`ALTER TABLE order_items ADD COLUMN IF NOT EXISTS shipment_id INT REFERENCES shipments(id)`,
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS subscription_id INT REFERENCES subscriptions(id)`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'Active'`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP`,
+		addConstraint("users", "users_check", "CHECK (deleted_at IS NULL OR deleted_at >= created_at)"),
+		`ALTER TABLE addresses ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP`,
+		`ALTER TABLE addresses ADD COLUMN IF NOT EXISTS latitude NUMERIC(9, 6)`,
+		`ALTER TABLE addresses ADD COLUMN IF NOT EXISTS longitude NUMERIC(9, 6)`,
+		`ALTER TABLE order_items ADD COLUMN IF NOT EXISTS warehouse_id INT REFERENCES warehouses(id)`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector TSVECTOR`,
+
+		// Index product attributes for containment queries
+		`CREATE INDEX IF NOT EXISTS products_attributes_idx ON products USING GIN (attributes)`,
+		`CREATE INDEX IF NOT EXISTS categories_path_idx ON categories (path text_pattern_ops)`,
+		`CREATE INDEX IF NOT EXISTS category_closure_descendant_idx ON category_closure (descendant_id)`,
+		`CREATE INDEX IF NOT EXISTS product_price_history_product_idx ON product_price_history (product_id, valid_from)`,
+		`CREATE INDEX IF NOT EXISTS products_seller_idx ON products (seller_id)`,
+		`CREATE INDEX IF NOT EXISTS shipments_order_idx ON shipments (order_id)`,
+		`CREATE INDEX IF NOT EXISTS orders_subscription_idx ON orders (subscription_id)`,
+		`CREATE INDEX IF NOT EXISTS subscription_events_subscription_idx ON subscription_events (subscription_id, occurred_at)`,
+		`CREATE INDEX IF NOT EXISTS store_credit_ledger_account_idx ON store_credit_ledger (account_id, occurred_at)`,
+		`CREATE INDEX IF NOT EXISTS order_payments_order_idx ON order_payments (order_id)`,
+		`CREATE INDEX IF NOT EXISTS loyalty_transactions_account_idx ON loyalty_transactions (account_id, occurred_at)`,
+		`CREATE INDEX IF NOT EXISTS support_tickets_order_idx ON support_tickets (order_id)`,
+		`CREATE INDEX IF NOT EXISTS ticket_messages_ticket_idx ON ticket_messages (ticket_id, sent_at)`,
+		`CREATE INDEX IF NOT EXISTS products_search_idx ON products USING GIN (search_vector)`,
+		`CREATE INDEX IF NOT EXISTS search_queries_zero_results_idx ON search_queries (searched_at) WHERE result_count = 0`,
+		`CREATE INDEX IF NOT EXISTS review_replies_review_idx ON review_replies (review_id)`,
+		`CREATE INDEX IF NOT EXISTS related_products_rank_idx ON related_products (product_id, rank)`,
+		`CREATE INDEX IF NOT EXISTS warehouse_stock_product_idx ON warehouse_stock (product_id, variant_id)`,
+		`CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity_type, entity_id)`,
+		`CREATE INDEX IF NOT EXISTS users_active_idx ON users (id) WHERE deleted_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS cart_items_cart_idx ON cart_items (cart_id)`,
+		`CREATE INDEX IF NOT EXISTS carts_status_idx ON carts (status, abandoned_at)`,
+		`CREATE INDEX IF NOT EXISTS sessions_order_idx ON sessions (order_id)`,
+		`CREATE INDEX IF NOT EXISTS events_session_idx ON events (session_id)`,
 	}
 
 	for _, query := range queries {
@@ -165,3 +760,55 @@ func CreateTables(db *sql.DB) error {
 	log.Println("All tables created successfully")
 	return nil
 }
+
+// addConstraint returns a statement adding a constraint to an existing table unless a
+// constraint of that name is already there. Constraints are matched by name, so ones
+// EnableTenancy has since scoped to tenants are left alone.
+func addConstraint(table, name, definition string) string {
+	return fmt.Sprintf(`DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = '%s') THEN
+			ALTER TABLE %s ADD CONSTRAINT %s %s;
+		END IF;
+	END $$`, name, table, name, definition)
+}
+
+// widenDecimal returns a statement raising the precision of an existing decimal column,
+// leaving columns that are already at least that wide untouched
+func widenDecimal(table, column string, precision, scale int) string {
+	return fmt.Sprintf(`DO $$ BEGIN
+		IF (SELECT numeric_precision FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = '%s' AND column_name = '%s') < %d THEN
+			ALTER TABLE %s ALTER COLUMN %s TYPE DECIMAL(%d, %d);
+		END IF;
+	END $$`, table, column, precision, table, column, precision, scale)
+}
+
+// addUniqueConstraint returns a statement adding a unique constraint on the columns like
+// addConstraint, skipping tables whose rows already hold duplicates, as rows generated
+// before the constraint was introduced may
+func addUniqueConstraint(table, name, definition, columns string) string {
+	return fmt.Sprintf(`DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = '%s')
+			AND NOT EXISTS (SELECT 1 FROM %s GROUP BY %s HAVING COUNT(*) > 1) THEN
+			ALTER TABLE %s ADD CONSTRAINT %s %s;
+		END IF;
+	END $$`, name, table, columns, table, name, definition)
+}
+
+// CreateEventPartitions creates the monthly partitions of the events table covering the
+// time range, skipping partitions that already exist
+func CreateEventPartitions(db *sql.DB, from, to time.Time) error {
+	month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for !month.After(to) {
+		next := month.AddDate(0, 1, 0)
+		query := fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS events_%s PARTITION OF events FOR VALUES FROM ('%s') TO ('%s')",
+			month.Format("2006_01"), month.Format(time.DateOnly), next.Format(time.DateOnly),
+		)
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to create events partition: %w\nQuery: %s", err, query)
+		}
+		month = next
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// TenantRole is the role tenant connections switch to. Unlike the superuser seeding the
+// schema, it is subject to row-level security, so each tenant only sees its own rows.
+const TenantRole = "dbseeder_tenant"
+
+// tenantPolicy is the name of the row-level security policy isolating tenants
+const tenantPolicy = "tenant_isolation"
+
+// foreignKeyPattern matches single-column foreign key definitions from pg_get_constraintdef
+var foreignKeyPattern = regexp.MustCompile(`^FOREIGN KEY \((\w+)\) REFERENCES ([\w.]+)\((\w+)\)(.*)$`)
+
+// TenantOptions returns the connection options scoping a connection to a tenant
+func TenantOptions(tenantID int) string {
+	return fmt.Sprintf("-c app.tenant_id=%d -c role=%s", tenantID, TenantRole)
+}
+
+// EnableTenancy makes every table created by CreateTables multi-tenant: a tenants table is
+// created, and every other table gets a tenant_id column defaulting to the tenant of the
+// connection. Unique constraints become unique per tenant and foreign keys include the
+// tenant, so no foreign key can cross tenants. It also creates the role tenant connections
+// use. Tables must be empty the first time tenancy is enabled, and an error says which
+// one isn't.
+func EnableTenancy(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS tenants (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(100) NOT NULL,
+		slug VARCHAR(100) UNIQUE NOT NULL,
+		plan VARCHAR(50) NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create tenants table: %w", err)
+	}
+
+	tables, err := tenantTables(db)
+	if err != nil {
+		return err
+	}
+
+	// Rows seeded without tenants belong to none, so they can't be given one
+	table, err := untenantedTableWithRows(db, tables)
+	if err != nil {
+		return err
+	}
+	if table != "" {
+		return fmt.Errorf("table %s already holds rows seeded without tenants; seed tenants into an empty database", table)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range tables {
+		// The default is only set once the column exists, since it can't be evaluated
+		// without a tenant; existing rows would have no tenant and fail the NOT NULL
+		queries := []string{
+			fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS tenant_id INT REFERENCES tenants(id)", table),
+			fmt.Sprintf("ALTER TABLE %s ALTER COLUMN tenant_id SET DEFAULT current_setting('app.tenant_id')::int", table),
+			fmt.Sprintf("ALTER TABLE %s ALTER COLUMN tenant_id SET NOT NULL", table),
+		}
+		for _, query := range queries {
+			if _, err := tx.Exec(query); err != nil {
+				return fmt.Errorf("failed to add tenant column to %s: %w", table, err)
+			}
+		}
+	}
+
+	if err := scopeUniqueConstraints(tx); err != nil {
+		return err
+	}
+	if err := scopeForeignKeys(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tenancy changes: %w", err)
+	}
+
+	if err := createTenantRole(db); err != nil {
+		return err
+	}
+
+	log.Printf("Enabled tenancy on %d tables", len(tables))
+	return nil
+}
+
+// tenantTables returns every table holding tenant data, leaving out partitions, which
+// inherit their columns and policies from the partitioned table
+func tenantTables(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT c.relname
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = current_schema()
+			AND c.relkind IN ('r', 'p')
+			AND NOT c.relispartition
+			AND c.relname <> 'tenants'
+		ORDER BY c.relname
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, fmt.Errorf("failed to scan table name: %w", err)
+		}
+		tables = append(tables, table)
+	}
+
+	return tables, nil
+}
+
+// TenancyEnabled reports whether EnableTenancy has run on the database. Its tables then
+// need the tenant of the connection for every row, so only tenant seeding can write to them.
+func TenancyEnabled(db *sql.DB) (bool, error) {
+	var enabled bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'tenant_id'
+		)
+	`).Scan(&enabled)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for tenancy: %w", err)
+	}
+	return enabled, nil
+}
+
+// untenantedTableWithRows returns the first of the tables that has rows but no tenant_id
+// column yet, or an empty string when there is none
+func untenantedTableWithRows(db *sql.DB, tables []string) (string, error) {
+	for _, table := range tables {
+		var hasRows bool
+		err := db.QueryRow(fmt.Sprintf(`
+			SELECT NOT EXISTS (
+				SELECT 1 FROM information_schema.columns
+				WHERE table_schema = current_schema() AND table_name = '%s' AND column_name = 'tenant_id'
+			) AND EXISTS (SELECT 1 FROM %s)
+		`, table, table)).Scan(&hasRows)
+		if err != nil {
+			return "", fmt.Errorf("failed to check %s for rows: %w", table, err)
+		}
+		if hasRows {
+			return table, nil
+		}
+	}
+	return "", nil
+}
+
+// tenantConstraint is a constraint that doesn't include the tenant yet
+type tenantConstraint struct {
+	Table      string
+	Name       string
+	Definition string
+}
+
+// unscopedConstraints returns the constraints of the given type on tenant tables that don't
+// cover the tenant_id column yet
+func unscopedConstraints(tx *sql.Tx, constraintType string) ([]tenantConstraint, error) {
+	rows, err := tx.Query(`
+		SELECT t.relname, c.conname, pg_get_constraintdef(c.oid)
+		FROM pg_constraint c
+		JOIN pg_class t ON t.oid = c.conrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attname = 'tenant_id'
+		WHERE n.nspname = current_schema()
+			AND c.contype = $1
+			AND NOT t.relispartition
+			AND NOT a.attnum = ANY(c.conkey)
+		ORDER BY t.relname, c.conname
+	`, constraintType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list constraints: %w", err)
+	}
+	defer rows.Close()
+
+	var constraints []tenantConstraint
+	for rows.Next() {
+		var constraint tenantConstraint
+		if err := rows.Scan(&constraint.Table, &constraint.Name, &constraint.Definition); err != nil {
+			return nil, fmt.Errorf("failed to scan constraint: %w", err)
+		}
+		constraints = append(constraints, constraint)
+	}
+
+	return constraints, nil
+}
+
+// replaceConstraint swaps a constraint for a new definition under the same name, so code
+// matching on constraint names keeps working
+func replaceConstraint(tx *sql.Tx, constraint tenantConstraint, definition string) error {
+	query := fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s, ADD CONSTRAINT %s %s",
+		constraint.Table, constraint.Name, constraint.Name, definition)
+	if _, err := tx.Exec(query); err != nil {
+		return fmt.Errorf("failed to scope constraint %s to tenants: %w\nQuery: %s", constraint.Name, err, query)
+	}
+	return nil
+}
+
+// scopeUniqueConstraints makes every unique constraint unique per tenant
+func scopeUniqueConstraints(tx *sql.Tx) error {
+	constraints, err := unscopedConstraints(tx, "u")
+	if err != nil {
+		return err
+	}
+	for _, constraint := range constraints {
+		definition := strings.Replace(constraint.Definition, "(", "(tenant_id, ", 1)
+		if err := replaceConstraint(tx, constraint, definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scopeForeignKeys makes every foreign key include the tenant, so rows can only reference
+// rows of the same tenant. Referenced tables get a unique key on the tenant and column.
+func scopeForeignKeys(tx *sql.Tx) error {
+	constraints, err := unscopedConstraints(tx, "f")
+	if err != nil {
+		return err
+	}
+
+	referenced := make(map[string]bool)
+	for _, constraint := range constraints {
+		match := foreignKeyPattern.FindStringSubmatch(constraint.Definition)
+		if match == nil {
+			return fmt.Errorf("unsupported foreign key %s: %s", constraint.Name, constraint.Definition)
+		}
+		column, table, referencedColumn, actions := match[1], match[2], match[3], match[4]
+		if table == "tenants" {
+			continue
+		}
+
+		key := table + "_tenant_" + referencedColumn + "_key"
+		if !referenced[key] {
+			query := fmt.Sprintf(`DO $$ BEGIN
+				IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = '%s') THEN
+					ALTER TABLE %s ADD CONSTRAINT %s UNIQUE (tenant_id, %s);
+				END IF;
+			END $$`, key, table, key, referencedColumn)
+			if _, err := tx.Exec(query); err != nil {
+				return fmt.Errorf("failed to add tenant key to %s: %w", table, err)
+			}
+			referenced[key] = true
+		}
+
+		definition := fmt.Sprintf("FOREIGN KEY (tenant_id, %s) REFERENCES %s(tenant_id, %s)%s",
+			column, table, referencedColumn, actions)
+		if err := replaceConstraint(tx, constraint, definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createTenantRole creates the role tenant connections use and grants it access to the data
+func createTenantRole(db *sql.DB) error {
+	queries := []string{
+		fmt.Sprintf(`DO $$ BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = '%s') THEN
+				CREATE ROLE %s NOLOGIN;
+			END IF;
+		END $$`, TenantRole, TenantRole),
+		fmt.Sprintf("GRANT USAGE ON SCHEMA public TO %s", TenantRole),
+		fmt.Sprintf("GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO %s", TenantRole),
+		fmt.Sprintf("GRANT USAGE, SELECT, UPDATE ON ALL SEQUENCES IN SCHEMA public TO %s", TenantRole),
+	}
+
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to set up tenant role: %w\nQuery: %s", err, query)
+		}
+	}
+	return nil
+}
+
+// EnableRowLevelSecurity adds a policy to every tenant table restricting rows to the tenant
+// of the connection. Policies are forced on table owners too; only superusers bypass them.
+func EnableRowLevelSecurity(db *sql.DB) error {
+	tables, err := tenantTables(db)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		queries := []string{
+			fmt.Sprintf("ALTER TABLE %s ENABLE ROW LEVEL SECURITY", table),
+			fmt.Sprintf("ALTER TABLE %s FORCE ROW LEVEL SECURITY", table),
+			fmt.Sprintf("DROP POLICY IF EXISTS %s ON %s", tenantPolicy, table),
+			fmt.Sprintf(`CREATE POLICY %s ON %s
+				USING (tenant_id = current_setting('app.tenant_id')::int)
+				WITH CHECK (tenant_id = current_setting('app.tenant_id')::int)`, tenantPolicy, table),
+		}
+		for _, query := range queries {
+			if _, err := db.Exec(query); err != nil {
+				return fmt.Errorf("failed to enable row-level security on %s: %w", table, err)
+			}
+		}
+	}
+
+	log.Printf("Enabled row-level security on %d tables", len(tables))
+	return nil
+}
+
+// DisableRowLevelSecurity removes the tenant policies added by EnableRowLevelSecurity
+func DisableRowLevelSecurity(db *sql.DB) error {
+	tables, err := tenantTables(db)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		queries := []string{
+			fmt.Sprintf("DROP POLICY IF EXISTS %s ON %s", tenantPolicy, table),
+			fmt.Sprintf("ALTER TABLE %s NO FORCE ROW LEVEL SECURITY", table),
+			fmt.Sprintf("ALTER TABLE %s DISABLE ROW LEVEL SECURITY", table),
+		}
+		for _, query := range queries {
+			if _, err := db.Exec(query); err != nil {
+				return fmt.Errorf("failed to disable row-level security on %s: %w", table, err)
+			}
+		}
+	}
+
+	log.Printf("Disabled row-level security on %d tables", len(tables))
+	return nil
+}
@@ -0,0 +1,228 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"database-test/pkg/timedist"
+
+	"github.com/pterm/pterm"
+)
+
+// User account statuses
+const (
+	UserActive  = "Active"
+	UserChurned = "Churned"
+	UserDeleted = "Deleted"
+	UserErased  = "Erased"
+)
+
+// churnInactivity is how long a user must have been inactive to count as churned
+const churnInactivity = 90 * 24 * time.Hour
+
+// erasedValue replaces personal data of users erased on request
+const erasedValue = "[erased]"
+
+// AccountLifecycle holds the fractions of users leaving the store in each way
+type AccountLifecycle struct {
+	ChurnRate    float64 // Inactive users flagged as churned, keeping their account
+	DeletionRate float64 // Users who closed their account, soft-deleted with their data kept
+	ErasureRate  float64 // Users who asked for their personal data to be erased
+}
+
+// userActivity holds when a user was last seen
+type userActivity struct {
+	UserID       int
+	LastActiveAt time.Time
+}
+
+// GenerateAccountDeletions closes accounts after everything else is seeded, so users only
+// leave after their last order, review, ticket or visit. Churned users are the ones inactive
+// for a long time and keep their account. Deleted users are soft-deleted: deleted_at is set
+// on the user and their addresses and all their data stays. Erased users are soft-deleted
+// too, with their personal data replaced by tombstones; their orders are kept for bookkeeping.
+func GenerateAccountDeletions(db *sql.DB, lifecycle AccountLifecycle, timeline *timedist.Distribution) error {
+	users, err := getUserActivity(db)
+	if err != nil {
+		return err
+	}
+	random.Shuffle(len(users), func(i, j int) { users[i], users[j] = users[j], users[i] })
+
+	deleteCount := int(float64(len(users)) * lifecycle.DeletionRate)
+	eraseCount := int(float64(len(users)) * lifecycle.ErasureRate)
+	churnCount := int(float64(len(users)) * lifecycle.ChurnRate)
+
+	statusStmt, err := db.Prepare(`
+		UPDATE users SET status = $2, deleted_at = $3, updated_at = $4
+		WHERE id = $1
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare status statement: %w", err)
+	}
+	defer statusStmt.Close()
+
+	addressStmt, err := db.Prepare(`
+		UPDATE addresses SET deleted_at = $2, updated_at = $2
+		WHERE user_id = $1
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare address statement: %w", err)
+	}
+	defer addressStmt.Close()
+
+	// Erasure keeps the rows other records point to, with tombstones in place of the PII.
+	// Emails stay unique since they carry the user ID.
+	eraseStmt, err := db.Prepare(`
+		UPDATE users SET
+			email = 'erased-' || id || '@erased.invalid',
+			password_hash = $2,
+			first_name = $2,
+			last_name = $2,
+			phone = NULL
+		WHERE id = $1
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare erasure statement: %w", err)
+	}
+	defer eraseStmt.Close()
+
+	eraseAddressStmt, err := db.Prepare(`
+		UPDATE addresses SET
+			address_line1 = $2,
+			address_line2 = NULL,
+			latitude = NULL,
+			longitude = NULL,
+			city = $2,
+			state = $2,
+			postal_code = $2
+		WHERE user_id = $1
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare address erasure statement: %w", err)
+	}
+	defer eraseAddressStmt.Close()
+
+	// Agents and sellers greet customers by first name, so replies to erased users are
+	// scrubbed of it. This runs before the user row is erased, while the name is still known.
+	eraseTicketStmt, err := db.Prepare(`
+		UPDATE ticket_messages m SET body = regexp_replace(m.body, '\m' || u.first_name || '\M', $2, 'g')
+		FROM support_tickets t JOIN users u ON u.id = t.user_id
+		WHERE m.ticket_id = t.id AND t.user_id = $1
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare ticket erasure statement: %w", err)
+	}
+	defer eraseTicketStmt.Close()
+
+	eraseReplyStmt, err := db.Prepare(`
+		UPDATE review_replies rr SET body = regexp_replace(rr.body, '\m' || u.first_name || '\M', $2, 'g')
+		FROM reviews r JOIN users u ON u.id = r.user_id
+		WHERE rr.review_id = r.id AND r.user_id = $1
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare review reply erasure statement: %w", err)
+	}
+	defer eraseReplyStmt.Close()
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(len(users)).
+		WithTitle(fmt.Sprintf("Closing accounts for %d users...", len(users))).
+		Start()
+
+	for _, user := range users {
+		progressBar.Increment()
+
+		// Accounts are closed some time after the last activity, so users active until
+		// the end of the window can't leave
+		idle := timeline.End.Sub(user.LastActiveAt)
+		switch {
+		case (deleteCount > 0 || eraseCount > 0) && idle > 24*time.Hour:
+			status := UserDeleted
+			if eraseCount > 0 && (deleteCount == 0 || random.Intn(2) == 0) {
+				status = UserErased
+				eraseCount--
+			} else {
+				deleteCount--
+			}
+
+			deletedAt := timeline.SampleBetween(user.LastActiveAt.Add(time.Hour), timeline.End)
+			if _, err := statusStmt.Exec(user.UserID, status, deletedAt, deletedAt); err != nil {
+				return fmt.Errorf("failed to delete user: %w", err)
+			}
+			if _, err := addressStmt.Exec(user.UserID, deletedAt); err != nil {
+				return fmt.Errorf("failed to delete addresses: %w", err)
+			}
+			if status != UserErased {
+				continue
+			}
+			if _, err := eraseTicketStmt.Exec(user.UserID, erasedValue); err != nil {
+				return fmt.Errorf("failed to erase ticket messages: %w", err)
+			}
+			if _, err := eraseReplyStmt.Exec(user.UserID, erasedValue); err != nil {
+				return fmt.Errorf("failed to erase review replies: %w", err)
+			}
+			if _, err := eraseStmt.Exec(user.UserID, erasedValue); err != nil {
+				return fmt.Errorf("failed to erase user: %w", err)
+			}
+			if _, err := eraseAddressStmt.Exec(user.UserID, erasedValue); err != nil {
+				return fmt.Errorf("failed to erase addresses: %w", err)
+			}
+
+		case churnCount > 0 && idle > churnInactivity:
+			// Churn is noticed once the user has been away for the full inactivity period
+			flaggedAt := timeline.SampleBetween(user.LastActiveAt.Add(churnInactivity), timeline.End)
+			if _, err := statusStmt.Exec(user.UserID, UserChurned, nil, flaggedAt); err != nil {
+				return fmt.Errorf("failed to flag churned user: %w", err)
+			}
+			churnCount--
+		}
+	}
+
+	return nil
+}
+
+// getUserActivity returns every user with the time of their latest recorded activity.
+// Users with a running subscription are still customers and left out.
+func getUserActivity(db *sql.DB) ([]userActivity, error) {
+	rows, err := db.Query(`
+		SELECT u.id, GREATEST(
+			u.created_at,
+			(SELECT MAX(GREATEST(o.created_at, o.delivered_at)) FROM orders o WHERE o.user_id = u.id),
+			(SELECT MAX(sub.cancelled_at) FROM subscriptions sub WHERE sub.user_id = u.id),
+			(SELECT MAX(ret.requested_at) FROM returns ret JOIN orders o ON o.id = ret.order_id WHERE o.user_id = u.id),
+			(SELECT MAX(g.issued_at) FROM gift_cards g WHERE g.purchaser_user_id = u.id),
+			(SELECT MAX(r.created_at) FROM reviews r WHERE r.user_id = u.id),
+			(SELECT MAX(v.voted_at) FROM review_votes v WHERE v.user_id = u.id),
+			(SELECT MAX(s.ended_at) FROM sessions s WHERE s.user_id = u.id),
+			(SELECT MAX(t.updated_at) FROM support_tickets t WHERE t.user_id = u.id),
+			(SELECT MAX(c.updated_at) FROM carts c WHERE c.user_id = u.id),
+			(SELECT MAX(w.added_at) FROM wishlist_items w WHERE w.user_id = u.id),
+			(SELECT MAX(q.searched_at) FROM search_queries q WHERE q.user_id = u.id),
+			(SELECT MAX(l.occurred_at) FROM store_credit_ledger l
+				JOIN store_credit_accounts a ON a.id = l.account_id WHERE a.user_id = u.id)
+		)
+		FROM users u
+		WHERE u.deleted_at IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM subscriptions sub WHERE sub.user_id = u.id AND sub.status <> $1
+			)
+		ORDER BY u.id
+	`, SubscriptionCancelled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user activity: %w", err)
+	}
+	defer rows.Close()
+
+	var users []userActivity
+	for rows.Next() {
+		var user userActivity
+		if err := rows.Scan(&user.UserID, &user.LastActiveAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user activity: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
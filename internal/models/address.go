@@ -7,7 +7,9 @@ import (
 	"time"
 
 	"database-test/pkg/faker"
+	"database-test/pkg/geo"
 
+	"github.com/lib/pq"
 	"github.com/pterm/pterm"
 )
 
@@ -24,6 +26,8 @@ type Address struct {
 	State        string
 	PostalCode   string
 	Country      string
+	Latitude     sql.NullFloat64
+	Longitude    sql.NullFloat64
 	IsDefault    bool
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
@@ -37,8 +41,12 @@ func GenerateAddresses(db *sql.DB, usersCount, addressesPerUser int) error {
 	}
 
 	stmt, err := db.Prepare(`
-		INSERT INTO addresses (user_id, address_line1, address_line2, city, state, postal_code, country, is_default)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO addresses (
+			user_id, address_line1, address_line2, city, state, postal_code, country, latitude, longitude,
+			is_default, created_at, updated_at
+		)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, u.created_at, u.created_at
+		FROM users u WHERE u.id = $1
 		RETURNING id
 	`)
 	if err != nil {
@@ -67,11 +75,12 @@ func GenerateAddresses(db *sql.DB, usersCount, addressesPerUser int) error {
 			state := faker.State()
 			postalCode := faker.Zip()
 			country := faker.CountryAbbr()
+			latitude, longitude := addressLocation(country, state)
 			isDefault := j == 0 // First address is default
 
 			var id int
 			err := stmt.QueryRow(
-				userID, addressLine1, addressLine2, city, state, postalCode, country, isDefault,
+				userID, addressLine1, addressLine2, city, state, postalCode, country, latitude, longitude, isDefault,
 			).Scan(&id)
 			if err != nil {
 				return fmt.Errorf("failed to insert address: %w", err)
@@ -85,6 +94,18 @@ func GenerateAddresses(db *sql.DB, usersCount, addressesPerUser int) error {
 	return nil
 }
 
+// addressLocation returns a point near the center of the address's state or country, as
+// a geocoder would, or NULL coordinates for regions it can't place
+func addressLocation(country, state string) (sql.NullFloat64, sql.NullFloat64) {
+	center, ok := geo.Locate(country, state)
+	if !ok {
+		return sql.NullFloat64{}, sql.NullFloat64{}
+	}
+	lat := center.Lat + (random.Float64()*2-1)*1.5
+	lon := center.Lon + (random.Float64()*2-1)*1.5
+	return sql.NullFloat64{Float64: lat, Valid: true}, sql.NullFloat64{Float64: lon, Valid: true}
+}
+
 // GetRandomAddressIDs returns n random address IDs from the database
 func GetRandomAddressIDs(db *sql.DB, count int) ([]int, error) {
 	rows, err := db.Query("SELECT id FROM addresses ORDER BY RANDOM() LIMIT $1", count)
@@ -111,19 +132,10 @@ func GetRandomAddressIDsByUser(db *sql.DB, userIDs []int) (map[int]int, error) {
 		return make(map[int]int), nil
 	}
 
-	// Prepare the query with a dynamic number of placeholders
-	query := "SELECT id, user_id FROM addresses WHERE user_id IN ("
-	args := make([]interface{}, len(userIDs))
-	for i, id := range userIDs {
-		if i > 0 {
-			query += ", "
-		}
-		query += fmt.Sprintf("$%d", i+1)
-		args[i] = id
-	}
-	query += ") ORDER BY RANDOM()"
-
-	rows, err := db.Query(query, args...)
+	rows, err := db.Query(
+		"SELECT id, user_id FROM addresses WHERE user_id = ANY($1) ORDER BY RANDOM()",
+		pq.Array(userIDs),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get random address IDs by user: %w", err)
 	}
@@ -143,3 +155,30 @@ func GetRandomAddressIDsByUser(db *sql.DB, userIDs []int) (map[int]int, error) {
 
 	return result, nil
 }
+
+// AddressRegion holds the parts of an address that determine taxes and currency
+type AddressRegion struct {
+	State   string
+	Country string
+}
+
+// GetAddressRegions returns the region of each of the given addresses keyed by ID
+func GetAddressRegions(db *sql.DB, addressIDs []int) (map[int]AddressRegion, error) {
+	rows, err := db.Query("SELECT id, state, country FROM addresses WHERE id = ANY($1)", pq.Array(addressIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get address regions: %w", err)
+	}
+	defer rows.Close()
+
+	regions := make(map[int]AddressRegion)
+	for rows.Next() {
+		var id int
+		var region AddressRegion
+		if err := rows.Scan(&id, &region.State, &region.Country); err != nil {
+			return nil, fmt.Errorf("failed to scan address region: %w", err)
+		}
+		regions[id] = region
+	}
+
+	return regions, nil
+}
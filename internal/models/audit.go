@@ -0,0 +1,290 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"database-test/pkg/money"
+	"database-test/pkg/timedist"
+
+	"github.com/pterm/pterm"
+)
+
+// Audited actions
+const (
+	AuditOrderStatusChange = "order.status_change"
+	AuditRefundIssued      = "refund.issue"
+	AuditPriceEdit         = "product.price_edit"
+)
+
+// AuditEntry represents an action a staff member took on a record, with the values it
+// changed before and after
+type AuditEntry struct {
+	ID         int64
+	StaffID    int
+	Action     string
+	EntityType string
+	EntityID   int
+	OldValues  map[string]any
+	NewValues  map[string]any
+	OccurredAt time.Time
+	CreatedAt  time.Time
+}
+
+// GenerateAuditLog records the staff actions behind the orders, refunds and prices already
+// generated. Warehouse staff process and ship orders, support staff cancel orders and issue
+// refunds, and admins edit list prices. Each action happens when the record shows it did:
+// shipping at the first shipment, refunds when processed, price edits when the new price
+// took effect. Actions taken before any staff member with the role was hired are left out,
+// and so are records already in the log, so seeding again only adds the new ones.
+func GenerateAuditLog(db *sql.DB, timeline *timedist.Distribution) error {
+	staff := make(map[string][]staffMember)
+	for _, role := range []string{StaffAdmin, StaffSupport, StaffWarehouse} {
+		members, err := getStaff(db, role)
+		if err != nil {
+			return err
+		}
+		staff[role] = members
+	}
+
+	var entries []AuditEntry
+	record := func(role, action, entityType string, entityID int, oldValues, newValues map[string]any, at time.Time) {
+		member := pickStaff(staff[role], at)
+		if member == nil {
+			return
+		}
+		entries = append(entries, AuditEntry{
+			StaffID:    member.ID,
+			Action:     action,
+			EntityType: entityType,
+			EntityID:   entityID,
+			OldValues:  oldValues,
+			NewValues:  newValues,
+			OccurredAt: at,
+		})
+	}
+	statusChange := func(role string, orderID int, from, to string, at time.Time) {
+		record(role, AuditOrderStatusChange, "order", orderID, map[string]any{"status": from}, map[string]any{"status": to}, at)
+	}
+
+	orders, err := getAuditOrders(db)
+	if err != nil {
+		return err
+	}
+	for _, order := range orders {
+		if order.Status == "Cancelled" {
+			// Cancellations happen within two days of the order
+			at := order.CreatedAt.Add(time.Duration(10+random.Intn(48*60)) * time.Minute)
+			if at.After(timeline.End) {
+				at = order.CreatedAt.Add(timeline.End.Sub(order.CreatedAt) / 2)
+			}
+			statusChange(StaffSupport, order.ID, "Pending", "Cancelled", at)
+			continue
+		}
+
+		// Orders are picked up within half a day, and always before they ship
+		processingBy := order.CreatedAt.Add(12 * time.Hour)
+		if order.ShippedAt.Valid && order.ShippedAt.Time.Before(processingBy) {
+			processingBy = order.ShippedAt.Time
+		}
+		if processingBy.After(timeline.End) {
+			processingBy = timeline.End
+		}
+		processingAt := order.CreatedAt.Add(time.Duration(random.Int63n(int64(processingBy.Sub(order.CreatedAt)) + 1)))
+		statusChange(StaffWarehouse, order.ID, "Pending", "Processing", processingAt)
+
+		if order.ShippedAt.Valid {
+			statusChange(StaffWarehouse, order.ID, "Processing", "Shipped", order.ShippedAt.Time)
+		}
+		if order.Status == "Refunded" && order.RefundedAt.Valid {
+			statusChange(StaffSupport, order.ID, "Delivered", "Refunded", order.RefundedAt.Time)
+		}
+	}
+
+	refunds, err := getAuditRefunds(db)
+	if err != nil {
+		return err
+	}
+	for _, refund := range refunds {
+		record(StaffSupport, AuditRefundIssued, "refund", refund.ID, nil, map[string]any{
+			"order_id": refund.OrderID,
+			"amount":   json.Number(refund.Amount.String()),
+			"currency": refund.Currency,
+			"method":   refund.Method,
+		}, refund.ProcessedAt)
+	}
+
+	edits, err := getAuditPriceEdits(db)
+	if err != nil {
+		return err
+	}
+	for _, edit := range edits {
+		record(StaffAdmin, AuditPriceEdit, "product", edit.ProductID,
+			map[string]any{"price": json.Number(edit.OldPrice.String())},
+			map[string]any{"price": json.Number(edit.NewPrice.String())},
+			edit.EditedAt)
+	}
+
+	// The log is written in the order actions happened, like the real thing
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].OccurredAt.Before(entries[j].OccurredAt) })
+
+	stmt, err := db.Prepare(`
+		INSERT INTO audit_log (staff_id, action, entity_type, entity_id, old_values, new_values, occurred_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(len(entries)).
+		WithTitle(fmt.Sprintf("Writing %d audit log entries...", len(entries))).
+		Start()
+
+	for _, entry := range entries {
+		var oldValues []byte
+		if entry.OldValues != nil {
+			if oldValues, err = json.Marshal(entry.OldValues); err != nil {
+				return fmt.Errorf("failed to encode old values: %w", err)
+			}
+		}
+		newValues, err := json.Marshal(entry.NewValues)
+		if err != nil {
+			return fmt.Errorf("failed to encode new values: %w", err)
+		}
+
+		if _, err := stmt.Exec(
+			entry.StaffID, entry.Action, entry.EntityType, entry.EntityID, nullableJSON(oldValues), string(newValues), entry.OccurredAt,
+		); err != nil {
+			return fmt.Errorf("failed to insert audit log entry: %w", err)
+		}
+		progressBar.Increment()
+	}
+
+	return nil
+}
+
+// nullableJSON returns encoded JSON as a string, or NULL when there is none
+func nullableJSON(data []byte) sql.NullString {
+	return sql.NullString{String: string(data), Valid: data != nil}
+}
+
+// auditOrder holds the order milestones staff actions are timed against
+type auditOrder struct {
+	ID         int
+	Status     string
+	CreatedAt  time.Time
+	ShippedAt  sql.NullTime
+	RefundedAt sql.NullTime
+}
+
+// getAuditOrders returns every order past Pending and not yet in the audit log, with its
+// first shipment and refund times
+func getAuditOrders(db *sql.DB) ([]auditOrder, error) {
+	rows, err := db.Query(`
+		SELECT o.id, o.status, o.created_at,
+			(SELECT MIN(s.shipped_at) FROM shipments s WHERE s.order_id = o.id),
+			(SELECT MIN(r.processed_at) FROM refunds r WHERE r.order_id = o.id)
+		FROM orders o
+		WHERE o.status <> 'Pending'
+			AND NOT EXISTS (SELECT 1 FROM audit_log a WHERE a.entity_type = 'order' AND a.entity_id = o.id)
+		ORDER BY o.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []auditOrder
+	for rows.Next() {
+		var order auditOrder
+		if err := rows.Scan(&order.ID, &order.Status, &order.CreatedAt, &order.ShippedAt, &order.RefundedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+// auditRefund holds the details of an issued refund
+type auditRefund struct {
+	ID          int
+	OrderID     int
+	Amount      money.Amount
+	Currency    string
+	Method      string
+	ProcessedAt time.Time
+}
+
+// getAuditRefunds returns every refund not yet in the audit log
+func getAuditRefunds(db *sql.DB) ([]auditRefund, error) {
+	rows, err := db.Query(`
+		SELECT r.id, r.order_id, r.amount, r.currency, r.method, r.processed_at
+		FROM refunds r
+		WHERE NOT EXISTS (SELECT 1 FROM audit_log a WHERE a.entity_type = 'refund' AND a.entity_id = r.id)
+		ORDER BY r.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refunds: %w", err)
+	}
+	defer rows.Close()
+
+	var refunds []auditRefund
+	for rows.Next() {
+		var refund auditRefund
+		if err := rows.Scan(&refund.ID, &refund.OrderID, &refund.Amount, &refund.Currency, &refund.Method, &refund.ProcessedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan refund: %w", err)
+		}
+		refunds = append(refunds, refund)
+	}
+
+	return refunds, nil
+}
+
+// auditPriceEdit is a list price change made during the time window
+type auditPriceEdit struct {
+	ProductID int
+	OldPrice  money.Amount
+	NewPrice  money.Amount
+	EditedAt  time.Time
+}
+
+// getAuditPriceEdits returns every price change, that is every price history period
+// following an earlier one, with the price it replaced. Edits already in the audit log
+// are left out.
+func getAuditPriceEdits(db *sql.DB) ([]auditPriceEdit, error) {
+	rows, err := db.Query(`
+		SELECT product_id, old_price, price, valid_from FROM (
+			SELECT product_id, price, valid_from,
+				LAG(price) OVER (PARTITION BY product_id ORDER BY valid_from) AS old_price
+			FROM product_price_history
+		) changes
+		WHERE old_price IS NOT NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM audit_log a
+				WHERE a.entity_type = 'product' AND a.entity_id = changes.product_id AND a.occurred_at = changes.valid_from
+			)
+		ORDER BY product_id, valid_from
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get price edits: %w", err)
+	}
+	defer rows.Close()
+
+	var edits []auditPriceEdit
+	for rows.Next() {
+		var edit auditPriceEdit
+		if err := rows.Scan(&edit.ProductID, &edit.OldPrice, &edit.NewPrice, &edit.EditedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan price edit: %w", err)
+		}
+		edits = append(edits, edit)
+	}
+
+	return edits, nil
+}
@@ -0,0 +1,421 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"database-test/pkg/timedist"
+
+	"github.com/pterm/pterm"
+)
+
+// Cart statuses
+const (
+	CartActive    = "Active"
+	CartAbandoned = "Abandoned"
+	CartRecovered = "Recovered"
+	CartConverted = "Converted"
+)
+
+// cartIdleTimeout is how long a cart sits untouched before it counts as abandoned
+const cartIdleTimeout = time.Hour
+
+// Cart represents a shopping cart, which either turns into an order or is abandoned
+type Cart struct {
+	ID                  int
+	UserID              int
+	Status              string
+	OrderID             sql.NullInt64
+	AbandonedAt         sql.NullTime
+	RecoveryEmailSentAt sql.NullTime
+	ConvertedAt         sql.NullTime
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+}
+
+// CartItem represents a product in a cart
+type CartItem struct {
+	ID        int
+	CartID    int
+	ProductID int
+	VariantID sql.NullInt64
+	Quantity  int
+	AddedAt   time.Time
+}
+
+// WishlistItem represents a product a customer saved for later
+type WishlistItem struct {
+	ID               int
+	UserID           int
+	ProductID        int
+	AddedAt          time.Time
+	PurchasedOrderID sql.NullInt64
+	CreatedAt        time.Time
+}
+
+// cartLine is a product put in a cart
+type cartLine struct {
+	ProductID int
+	VariantID sql.NullInt64
+	Quantity  int
+}
+
+// popularProducts picks products in proportion to how often they were ordered, every
+// product having at least some chance
+type popularProducts struct {
+	IDs      []int
+	Variants map[int][]catalogVariant
+	chooser  *weightedChooser
+}
+
+// pick returns a random product, weighted by popularity, with one of its variants
+func (p *popularProducts) pick() cartLine {
+	id := p.IDs[p.chooser.Choose()]
+	line := cartLine{ProductID: id, Quantity: 1 + random.Intn(2)}
+	if variants := p.Variants[id]; len(variants) > 0 {
+		line.VariantID = sql.NullInt64{Int64: int64(variants[random.Intn(len(variants))].ID), Valid: true}
+	}
+	return line
+}
+
+// getPopularProducts returns every product weighted by the quantity ordered so far
+func getPopularProducts(db *sql.DB) (*popularProducts, error) {
+	rows, err := db.Query(`
+		SELECT p.id, COALESCE(SUM(oi.quantity), 0)
+		FROM products p
+		LEFT JOIN order_items oi ON oi.product_id = p.id
+		GROUP BY p.id
+		ORDER BY p.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product popularity: %w", err)
+	}
+	defer rows.Close()
+
+	products := &popularProducts{}
+	var weights []float64
+	for rows.Next() {
+		var id int
+		var ordered float64
+		if err := rows.Scan(&id, &ordered); err != nil {
+			return nil, fmt.Errorf("failed to scan product popularity: %w", err)
+		}
+		products.IDs = append(products.IDs, id)
+		weights = append(weights, ordered+1)
+	}
+	if len(products.IDs) == 0 {
+		return nil, fmt.Errorf("no products found")
+	}
+	products.chooser = newWeightedChooser(weights)
+
+	products.Variants, err = getCatalogVariants(db, products.IDs)
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// GenerateCarts generates the carts behind existing orders and carts that never converted,
+// and inserts them into the database. Every order placed in a session gets a cart holding
+// its items: most are checked out right away, while recoveryRate of them were abandoned
+// and recovered through a reminder email. On top of those, abandonedCount carts are filled
+// with popular products and abandoned, some of them getting a reminder too.
+func GenerateCarts(db *sql.DB, abandonedCount int, recoveryRate float64, timeline *timedist.Distribution) error {
+	orders, err := getCartOrders(db)
+	if err != nil {
+		return err
+	}
+	products, err := getPopularProducts(db)
+	if err != nil {
+		return err
+	}
+	users, err := GetUserPersonas(db)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return fmt.Errorf("no users found to fill carts")
+	}
+
+	cartStmt, err := db.Prepare(`
+		INSERT INTO carts (
+			user_id, status, order_id, abandoned_at, recovery_email_sent_at, converted_at, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare cart statement: %w", err)
+	}
+	defer cartStmt.Close()
+
+	itemStmt, err := db.Prepare(`
+		INSERT INTO cart_items (cart_id, product_id, variant_id, quantity, added_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare cart item statement: %w", err)
+	}
+	defer itemStmt.Close()
+
+	insertCart := func(cart Cart, lines []cartLine) error {
+		var cartID int
+		err := cartStmt.QueryRow(
+			cart.UserID, cart.Status, cart.OrderID, cart.AbandonedAt, cart.RecoveryEmailSentAt,
+			cart.ConvertedAt, cart.CreatedAt, cart.UpdatedAt,
+		).Scan(&cartID)
+		if err != nil {
+			return fmt.Errorf("failed to insert cart: %w", err)
+		}
+
+		// Items are added during the first half hour of the cart, the first one creating it
+		window := min(cart.UpdatedAt.Sub(cart.CreatedAt), cartIdleTimeout/2)
+		for i, line := range lines {
+			addedAt := cart.CreatedAt
+			if i > 0 && window > 0 {
+				addedAt = cart.CreatedAt.Add(time.Duration(random.Int63n(int64(window)))).Truncate(time.Second)
+			}
+			if _, err := itemStmt.Exec(cartID, line.ProductID, line.VariantID, line.Quantity, addedAt); err != nil {
+				return fmt.Errorf("failed to insert cart item: %w", err)
+			}
+		}
+		return nil
+	}
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(len(orders) + abandonedCount).
+		WithTitle(fmt.Sprintf("Generating carts for %d orders and %d abandoned carts...", len(orders), abandonedCount)).
+		Start()
+
+	for _, order := range orders {
+		cart := Cart{
+			UserID:      order.UserID,
+			Status:      CartConverted,
+			OrderID:     sql.NullInt64{Int64: int64(order.ID), Valid: true},
+			ConvertedAt: sql.NullTime{Time: order.CreatedAt, Valid: true},
+			UpdatedAt:   order.CreatedAt,
+		}
+
+		// Recovered carts sat abandoned for hours or days before a reminder brought the
+		// customer back; the others were filled minutes before checkout
+		if random.Float64() < recoveryRate {
+			cart.Status = CartRecovered
+			idle := 2*cartIdleTimeout + time.Duration(random.Int63n(int64(72*time.Hour)))
+			cart.CreatedAt = order.CreatedAt.Add(-idle).Truncate(time.Second)
+			abandonedAt := cart.CreatedAt.Add(cartIdleTimeout/2 + cartIdleTimeout)
+			cart.AbandonedAt = sql.NullTime{Time: abandonedAt, Valid: true}
+			reminder := abandonedAt.Add(time.Duration(random.Int63n(int64(order.CreatedAt.Sub(abandonedAt)))))
+			cart.RecoveryEmailSentAt = sql.NullTime{Time: reminder.Truncate(time.Second), Valid: true}
+		} else {
+			cart.CreatedAt = order.CreatedAt.Add(-time.Duration(5+random.Intn(85)) * time.Minute)
+		}
+
+		if err := insertCart(cart, order.Lines); err != nil {
+			return err
+		}
+		progressBar.Increment()
+	}
+
+	for i := 0; i < abandonedCount; i++ {
+		user := users[random.Intn(len(users))]
+		from, to := user.Persona.ActiveWindow(timeline, user.SignedUpAt)
+		if !to.After(from) {
+			from, to = timeline.Start, timeline.End
+		}
+		createdAt := timeline.SampleBetween(from, to)
+
+		lines := make([]cartLine, 1+random.Intn(4))
+		for j := range lines {
+			lines[j] = products.pick()
+		}
+
+		// Carts touched within the idle timeout are still active
+		lastActivity := createdAt.Add(time.Duration(random.Int63n(int64(cartIdleTimeout / 2)))).Truncate(time.Second)
+		cart := Cart{UserID: user.UserID, Status: CartActive, CreatedAt: createdAt, UpdatedAt: lastActivity}
+		if abandonedAt := lastActivity.Add(cartIdleTimeout); !abandonedAt.After(timeline.End) {
+			cart.Status = CartAbandoned
+			cart.AbandonedAt = sql.NullTime{Time: abandonedAt, Valid: true}
+
+			// Signed-in customers get a reminder a few hours later
+			reminder := abandonedAt.Add(time.Duration(1+random.Intn(24)) * time.Hour)
+			if random.Float64() < 0.6 && !reminder.After(timeline.End) {
+				cart.RecoveryEmailSentAt = sql.NullTime{Time: reminder, Valid: true}
+			}
+		}
+
+		if err := insertCart(cart, lines); err != nil {
+			return err
+		}
+		progressBar.Increment()
+	}
+
+	return nil
+}
+
+// cartOrder holds the order details needed to build its cart
+type cartOrder struct {
+	ID        int
+	UserID    int
+	CreatedAt time.Time
+	Lines     []cartLine
+}
+
+// getCartOrders returns the orders without a cart along with their items. Subscription
+// renewals are placed by the billing job and never go through a cart.
+func getCartOrders(db *sql.DB) ([]cartOrder, error) {
+	rows, err := db.Query(`
+		SELECT o.id, o.user_id, o.created_at, oi.product_id, oi.variant_id, oi.quantity
+		FROM orders o
+		JOIN order_items oi ON oi.order_id = o.id
+		WHERE NOT EXISTS (SELECT 1 FROM carts c WHERE c.order_id = o.id)
+			AND NOT EXISTS (
+				SELECT 1 FROM subscriptions sub
+				WHERE sub.id = o.subscription_id AND sub.started_at < o.created_at
+			)
+		ORDER BY o.id, oi.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []cartOrder
+	for rows.Next() {
+		var order cartOrder
+		var line cartLine
+		if err := rows.Scan(&order.ID, &order.UserID, &order.CreatedAt, &line.ProductID, &line.VariantID, &line.Quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan order item: %w", err)
+		}
+
+		if len(orders) == 0 || orders[len(orders)-1].ID != order.ID {
+			orders = append(orders, order)
+		}
+		last := &orders[len(orders)-1]
+		last.Lines = append(last.Lines, line)
+	}
+
+	return orders, nil
+}
+
+// GenerateWishlists generates n fake wishlist entries and inserts them into the database.
+// purchasedShare of them are products the customer saved before ordering them, linked to
+// that order; the rest are popular products saved at random, mostly never bought. Those the
+// customer did order after saving them are linked to the first such order.
+func GenerateWishlists(db *sql.DB, count int, purchasedShare float64, timeline *timedist.Distribution) error {
+	products, err := getPopularProducts(db)
+	if err != nil {
+		return err
+	}
+	users, err := GetUserPersonas(db)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return fmt.Errorf("no users found to save products")
+	}
+	purchases, err := getWishlistPurchases(db, int(float64(count)*purchasedShare))
+	if err != nil {
+		return err
+	}
+
+	stmt, err := db.Prepare(`
+		INSERT INTO wishlist_items (user_id, product_id, added_at, purchased_order_id, created_at)
+		VALUES ($1, $2, $3, COALESCE($4::INT, (
+			SELECT o.id FROM orders o
+			JOIN order_items oi ON oi.order_id = o.id
+			WHERE o.user_id = $1 AND oi.product_id = $2 AND o.created_at >= $3
+			ORDER BY o.created_at
+			LIMIT 1
+		)), $3)
+		ON CONFLICT ON CONSTRAINT wishlist_items_user_id_product_id_key DO NOTHING
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(count).
+		WithTitle(fmt.Sprintf("Generating %d wishlist items...", count)).
+		Start()
+
+	for i := 0; i < count; i++ {
+		progressBar.Increment()
+
+		// Saved products later bought were added up to three months before the order
+		if i < len(purchases) {
+			purchase := purchases[i]
+			addedAt := purchase.OrderedAt.Add(-time.Duration(1+random.Intn(90*24)) * time.Hour)
+			if addedAt.Before(purchase.SignedUpAt) {
+				addedAt = purchase.SignedUpAt
+			}
+			orderID := sql.NullInt64{Int64: int64(purchase.OrderID), Valid: true}
+			if _, err := stmt.Exec(purchase.UserID, purchase.ProductID, addedAt, orderID); err != nil {
+				return fmt.Errorf("failed to insert wishlist item: %w", err)
+			}
+			continue
+		}
+
+		user := users[random.Intn(len(users))]
+		from := user.SignedUpAt
+		if from.Before(timeline.Start) {
+			from = timeline.Start
+		}
+		if !timeline.End.After(from) {
+			continue
+		}
+		addedAt := timeline.SampleBetween(from, timeline.End)
+		if _, err := stmt.Exec(user.UserID, products.pick().ProductID, addedAt, nil); err != nil {
+			return fmt.Errorf("failed to insert wishlist item: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// wishlistPurchase is an ordered product that was on the customer's wishlist first
+type wishlistPurchase struct {
+	UserID     int
+	ProductID  int
+	OrderID    int
+	OrderedAt  time.Time
+	SignedUpAt time.Time
+}
+
+// getWishlistPurchases returns up to n random products customers ordered and haven't saved
+// yet, each with the first order it appears in
+func getWishlistPurchases(db *sql.DB, count int) ([]wishlistPurchase, error) {
+	rows, err := db.Query(`
+		SELECT user_id, product_id, order_id, created_at, signed_up_at FROM (
+			SELECT DISTINCT ON (o.user_id, oi.product_id)
+				o.user_id, oi.product_id, o.id AS order_id, o.created_at, u.created_at AS signed_up_at
+			FROM orders o
+			JOIN order_items oi ON oi.order_id = o.id
+			JOIN users u ON u.id = o.user_id
+			WHERE NOT EXISTS (
+				SELECT 1 FROM wishlist_items w WHERE w.user_id = o.user_id AND w.product_id = oi.product_id
+			)
+			ORDER BY o.user_id, oi.product_id, o.created_at
+		) purchases
+		ORDER BY RANDOM()
+		LIMIT $1
+	`, count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ordered products: %w", err)
+	}
+	defer rows.Close()
+
+	var purchases []wishlistPurchase
+	for rows.Next() {
+		var purchase wishlistPurchase
+		if err := rows.Scan(&purchase.UserID, &purchase.ProductID, &purchase.OrderID, &purchase.OrderedAt, &purchase.SignedUpAt); err != nil {
+			return nil, fmt.Errorf("failed to scan ordered product: %w", err)
+		}
+		purchases = append(purchases, purchase)
+	}
+
+	return purchases, nil
+}
@@ -3,10 +3,13 @@ package models
 import (
 	"database/sql"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"database-test/pkg/faker"
 
+	"github.com/lib/pq"
 	"github.com/pterm/pterm"
 )
 
@@ -16,21 +19,123 @@ type Category struct {
 	Name        string
 	Description string
 	ParentID    sql.NullInt64
+	Depth       int
+	Path        sql.NullString
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 }
 
-// GenerateCategories generates n fake categories and inserts them into the database
-func GenerateCategories(db *sql.DB, count int, maxDepth int) error {
-	// First, create top-level categories (about 1/3 of total)
-	topLevelCount := count / 3
-	if topLevelCount < 1 {
-		topLevelCount = 1
+// Category tree shapes
+const (
+	CategoryShapeBalanced = "balanced" // Children are spread evenly over the parents
+	CategoryShapeSkewed   = "skewed"   // A few parents hold most of the children
+)
+
+// Ways of storing the category hierarchy besides parent_id
+const (
+	CategoryHierarchyNone    = "none"
+	CategoryHierarchyPath    = "path"    // Materialized path of IDs, such as /1/5/12/
+	CategoryHierarchyClosure = "closure" // Every ancestor-descendant pair in category_closure
+	CategoryHierarchyBoth    = "both"
+)
+
+// CategoryTree describes the shape of a generated category tree
+type CategoryTree struct {
+	MaxDepth     int
+	Branching    float64   // Children per category at each level, used when DepthWeights is empty
+	DepthWeights []float64 // Relative number of categories at each depth, starting with the roots
+	Shape        string
+	Hierarchy    string
+}
+
+// levelSizes splits count categories into levels following the depth weights, or the
+// branching factor if none are given
+func (t CategoryTree) levelSizes(count int) []int {
+	weights := t.DepthWeights
+	if len(weights) == 0 {
+		for depth := 0; depth < t.MaxDepth; depth++ {
+			weights = append(weights, math.Pow(t.Branching, float64(depth)))
+		}
+	}
+	if t.MaxDepth > 0 && len(weights) > t.MaxDepth {
+		weights = weights[:t.MaxDepth]
+	}
+
+	sizes := apportion(count, weights)
+
+	// Every level needs parents above it, so empty levels are dropped
+	compacted := make([]int, 0, len(sizes))
+	for _, size := range sizes {
+		if size > 0 {
+			compacted = append(compacted, size)
+		}
+	}
+	if len(compacted) == 0 {
+		return []int{count}
+	}
+	return compacted
+}
+
+// assignParents returns the index of the parent of each of n children
+func (t CategoryTree) assignParents(n, parents int) []int {
+	order := random.Perm(parents)
+	assigned := make([]int, n)
+
+	if t.Shape == CategoryShapeSkewed {
+		// Zipf-like weights, so the first few parents in the shuffled order dominate
+		weights := make([]float64, parents)
+		for rank := range weights {
+			weights[rank] = 1 / math.Pow(float64(rank+1), 1.2)
+		}
+		chooser := newWeightedChooser(weights)
+		for i := range assigned {
+			assigned[i] = order[chooser.Choose()]
+		}
+		return assigned
+	}
+
+	for i := range assigned {
+		assigned[i] = order[i%parents]
+	}
+	return assigned
+}
+
+// generatedCategory tracks an inserted category while its descendants are generated
+type generatedCategory struct {
+	ID    int
+	Names []string // Category names from the root down
+	Path  string
+}
+
+// GenerateCategories generates n fake categories shaped by the tree options and inserts them
+// into the database. Names come from the taxonomy so children fit their parent, and siblings
+// never share a name.
+func GenerateCategories(db *sql.DB, count int, tree CategoryTree) error {
+	if tree.Shape != CategoryShapeBalanced && tree.Shape != CategoryShapeSkewed {
+		return fmt.Errorf("unknown category tree shape %q (available: %s, %s)",
+			tree.Shape, CategoryShapeBalanced, CategoryShapeSkewed)
+	}
+	withPath := tree.Hierarchy == CategoryHierarchyPath || tree.Hierarchy == CategoryHierarchyBoth
+	withClosure := tree.Hierarchy == CategoryHierarchyClosure || tree.Hierarchy == CategoryHierarchyBoth
+	if !withPath && !withClosure && tree.Hierarchy != CategoryHierarchyNone {
+		return fmt.Errorf("unknown category hierarchy %q (available: %s, %s, %s, %s)", tree.Hierarchy,
+			CategoryHierarchyNone, CategoryHierarchyPath, CategoryHierarchyClosure, CategoryHierarchyBoth)
+	}
+	for _, weight := range tree.DepthWeights {
+		if weight < 0 {
+			return fmt.Errorf("category depth weights must not be negative")
+		}
+	}
+	if count < 1 {
+		return nil
+	}
+	if tree.MaxDepth < 1 {
+		tree.MaxDepth = 1
 	}
 
 	stmt, err := db.Prepare(`
-		INSERT INTO categories (name, description, parent_id)
-		VALUES ($1, $2, $3)
+		INSERT INTO categories (name, description, parent_id, depth)
+		VALUES ($1, $2, $3, $4)
 		RETURNING id
 	`)
 	if err != nil {
@@ -38,83 +143,112 @@ func GenerateCategories(db *sql.DB, count int, maxDepth int) error {
 	}
 	defer stmt.Close()
 
-	// Create a progress bar for top-level categories
-	topLevelBar, _ := pterm.DefaultProgressbar.
-		WithTotal(topLevelCount).
-		WithTitle(fmt.Sprintf("Generating %d top-level categories...", topLevelCount)).
-		Start()
-
-	// Generate top-level categories
-	topLevelIDs := make([]int, 0, topLevelCount)
-	for i := 0; i < topLevelCount; i++ {
-		name := faker.CategoryName()
-		description := faker.CategoryDescription()
+	pathStmt, err := db.Prepare("UPDATE categories SET path = $1 WHERE id = $2")
+	if err != nil {
+		return fmt.Errorf("failed to prepare path statement: %w", err)
+	}
+	defer pathStmt.Close()
 
-		var id int
-		err := stmt.QueryRow(name, description, nil).Scan(&id)
-		if err != nil {
-			return fmt.Errorf("failed to insert top-level category: %w", err)
-		}
-		topLevelIDs = append(topLevelIDs, id)
-		topLevelBar.Increment()
+	closureStmt, err := db.Prepare(`
+		INSERT INTO category_closure (ancestor_id, descendant_id, depth)
+		SELECT ancestor_id, $1::INT, depth + 1 FROM category_closure WHERE descendant_id = $2::INT
+		UNION ALL
+		SELECT $1::INT, $1::INT, 0
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare closure statement: %w", err)
 	}
+	defer closureStmt.Close()
 
-	// Generate subcategories
-	remainingCount := count - topLevelCount
-	if remainingCount <= 0 {
-		return nil
+	// Roots from earlier runs are siblings of the new roots
+	rootNames, err := getRootCategoryNames(db)
+	if err != nil {
+		return err
 	}
 
-	// Create a progress bar for subcategories
-	subCategoryBar, _ := pterm.DefaultProgressbar.
-		WithTotal(remainingCount).
-		WithTitle(fmt.Sprintf("Generating %d subcategories...", remainingCount)).
-		Start()
+	sizes := tree.levelSizes(count)
 
-	// Create a map to track categories by depth
-	categoriesByDepth := make(map[int][]int)
-	categoriesByDepth[1] = topLevelIDs
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(count).
+		WithTitle(fmt.Sprintf("Generating %d categories over %d levels...", count, len(sizes))).
+		Start()
 
-	currentDepth := 1
-	for remainingCount > 0 && currentDepth < maxDepth {
-		parentIDs := categoriesByDepth[currentDepth]
-		if len(parentIDs) == 0 {
-			break
+	var parents []generatedCategory
+	for depth, size := range sizes {
+		var parentOf []int
+		siblingNames := make([]map[string]bool, len(parents))
+		for i := range siblingNames {
+			siblingNames[i] = make(map[string]bool)
 		}
-
-		// Determine how many subcategories to create at this depth
-		subcategoriesPerParent := remainingCount / len(parentIDs)
-		if subcategoriesPerParent < 1 {
-			subcategoriesPerParent = 1
+		if depth > 0 {
+			parentOf = tree.assignParents(size, len(parents))
 		}
 
-		nextDepthCategories := make([]int, 0)
-		categoriesCreated := 0
+		level := make([]generatedCategory, 0, size)
+		for i := 0; i < size; i++ {
+			var parentID sql.NullInt64
+			var names []string
+			pathPrefix := "/"
+			taken := rootNames
+			if depth > 0 {
+				parent := parents[parentOf[i]]
+				parentID = sql.NullInt64{Int64: int64(parent.ID), Valid: true}
+				names = parent.Names
+				pathPrefix = parent.Path
+				taken = siblingNames[parentOf[i]]
+			}
 
-		for _, parentID := range parentIDs {
-			for j := 0; j < subcategoriesPerParent && remainingCount > 0; j++ {
-				name := faker.CategoryName()
-				description := faker.CategoryDescription()
+			name := faker.UniqueCategoryName(names, taken)
+			taken[name] = true
+			description := faker.CategoryDescription(name)
 
-				var id int
-				err := stmt.QueryRow(name, description, parentID).Scan(&id)
-				if err != nil {
-					return fmt.Errorf("failed to insert subcategory: %w", err)
+			category := generatedCategory{Names: append(append([]string{}, names...), name)}
+			if err := stmt.QueryRow(name, description, parentID, depth+1).Scan(&category.ID); err != nil {
+				return fmt.Errorf("failed to insert category: %w", err)
+			}
+			category.Path = fmt.Sprintf("%s%d/", pathPrefix, category.ID)
+
+			if withPath {
+				if _, err := pathStmt.Exec(category.Path, category.ID); err != nil {
+					return fmt.Errorf("failed to set category path: %w", err)
+				}
+			}
+			if withClosure {
+				if _, err := closureStmt.Exec(category.ID, parentID); err != nil {
+					return fmt.Errorf("failed to insert category closure: %w", err)
 				}
-				nextDepthCategories = append(nextDepthCategories, id)
-				remainingCount--
-				categoriesCreated++
-				subCategoryBar.Increment()
 			}
-		}
 
-		categoriesByDepth[currentDepth+1] = nextDepthCategories
-		currentDepth++
+			level = append(level, category)
+			progressBar.Increment()
+		}
+		parents = level
 	}
 
 	return nil
 }
 
+// getRootCategoryNames returns the names of the existing top-level categories
+func getRootCategoryNames(db *sql.DB) (map[string]bool, error) {
+	rows, err := db.Query("SELECT name FROM categories WHERE parent_id IS NULL")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get root categories: %w", err)
+	}
+	defer rows.Close()
+
+	names := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan root category: %w", err)
+		}
+		names[name] = true
+	}
+
+	return names, nil
+}
+
 // GetRandomCategoryIDs returns n random category IDs from the database
 func GetRandomCategoryIDs(db *sql.DB, count int) ([]int, error) {
 	rows, err := db.Query("SELECT id FROM categories ORDER BY RANDOM() LIMIT $1", count)
@@ -134,3 +268,123 @@ func GetRandomCategoryIDs(db *sql.DB, count int) ([]int, error) {
 
 	return ids, nil
 }
+
+// GetCategoryPaths returns the category names from the root down to each of the given
+// categories, keyed by ID
+func GetCategoryPaths(db *sql.DB, categoryIDs []int) (map[int][]string, error) {
+	rows, err := db.Query(`
+		WITH RECURSIVE lineage AS (
+			SELECT id AS category_id, parent_id, name::TEXT AS names
+			FROM categories
+			WHERE id = ANY($1)
+			UNION ALL
+			SELECT l.category_id, c.parent_id, c.name || E'\x1f' || l.names
+			FROM lineage l
+			JOIN categories c ON c.id = l.parent_id
+		)
+		SELECT category_id, names FROM lineage WHERE parent_id IS NULL
+	`, pq.Array(categoryIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get category paths: %w", err)
+	}
+	defer rows.Close()
+
+	paths := make(map[int][]string)
+	for rows.Next() {
+		var id int
+		var names string
+		if err := rows.Scan(&id, &names); err != nil {
+			return nil, fmt.Errorf("failed to scan category path: %w", err)
+		}
+		paths[id] = strings.Split(names, "\x1f")
+	}
+
+	return paths, nil
+}
+
+// Policies for choosing which categories products are placed in
+const (
+	PlacementAny           = "any"            // Every category is equally likely
+	PlacementLeaf          = "leaf"           // Only categories without subcategories
+	PlacementDepthWeighted = "depth-weighted" // Deeper categories are proportionally more likely
+)
+
+// Distributions of product counts over the eligible categories
+const (
+	SpreadUniform = "uniform" // Every category gets about the same number of products
+	SpreadZipf    = "zipf"    // A few categories hold most products, with a long tail
+)
+
+// ProductPlacement describes how products are spread over the category tree
+type ProductPlacement struct {
+	Policy string
+	Spread string
+}
+
+// placementCategory holds the tree position of a category
+type placementCategory struct {
+	ID    int
+	Depth int
+	Leaf  bool
+}
+
+// PlaceProducts returns a category ID for each of count products, following the placement
+// policy and spreading the products over the eligible categories
+func PlaceProducts(db *sql.DB, count int, placement ProductPlacement) ([]int, error) {
+	if placement.Policy != PlacementAny && placement.Policy != PlacementLeaf && placement.Policy != PlacementDepthWeighted {
+		return nil, fmt.Errorf("unknown product placement %q (available: %s, %s, %s)",
+			placement.Policy, PlacementAny, PlacementLeaf, PlacementDepthWeighted)
+	}
+	if placement.Spread != SpreadUniform && placement.Spread != SpreadZipf {
+		return nil, fmt.Errorf("unknown product spread %q (available: %s, %s)",
+			placement.Spread, SpreadUniform, SpreadZipf)
+	}
+
+	rows, err := db.Query(`
+		SELECT c.id, c.depth, NOT EXISTS (SELECT 1 FROM categories sub WHERE sub.parent_id = c.id)
+		FROM categories c
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get categories: %w", err)
+	}
+	defer rows.Close()
+
+	var categories []placementCategory
+	for rows.Next() {
+		var category placementCategory
+		if err := rows.Scan(&category.ID, &category.Depth, &category.Leaf); err != nil {
+			return nil, fmt.Errorf("failed to scan category: %w", err)
+		}
+		if placement.Policy == PlacementLeaf && !category.Leaf {
+			continue
+		}
+		categories = append(categories, category)
+	}
+	if len(categories) == 0 {
+		return nil, fmt.Errorf("no categories to place products in")
+	}
+
+	// Shuffle so the popular categories of a Zipf spread are random
+	random.Shuffle(len(categories), func(i, j int) { categories[i], categories[j] = categories[j], categories[i] })
+
+	weights := make([]float64, len(categories))
+	for rank, category := range categories {
+		weights[rank] = 1
+		if placement.Policy == PlacementDepthWeighted {
+			weights[rank] = float64(category.Depth)
+		}
+		if placement.Spread == SpreadZipf {
+			weights[rank] /= math.Pow(float64(rank+1), 1.1)
+		}
+	}
+
+	categoryIDs := make([]int, 0, count)
+	for i, share := range apportion(count, weights) {
+		for j := 0; j < share; j++ {
+			categoryIDs = append(categoryIDs, categories[i].ID)
+		}
+	}
+	random.Shuffle(len(categoryIDs), func(i, j int) { categoryIDs[i], categoryIDs[j] = categoryIDs[j], categoryIDs[i] })
+
+	return categoryIDs, nil
+}
@@ -0,0 +1,443 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/url"
+	"time"
+
+	"database-test/pkg/faker"
+	"database-test/pkg/money"
+	"database-test/pkg/timedist"
+
+	"github.com/lib/pq"
+	"github.com/pterm/pterm"
+)
+
+// Event types, in funnel order
+const (
+	EventPageView      = "page_view"
+	EventSearch        = "search"
+	EventProductView   = "product_view"
+	EventAddToCart     = "add_to_cart"
+	EventCheckoutStart = "checkout_start"
+	EventPurchase      = "purchase"
+)
+
+// Session represents a visit to the store, by a signed in user or an anonymous visitor
+type Session struct {
+	ID          int64
+	UserID      sql.NullInt64
+	Device      string
+	Channel     string
+	LandingPage string
+	OrderID     sql.NullInt64 // Set when the session ended in a purchase
+	StartedAt   time.Time
+	EndedAt     time.Time
+}
+
+// Event represents a single user interaction within a session
+type Event struct {
+	ID          int64
+	SessionID   int64
+	UserID      sql.NullInt64
+	Type        string
+	Page        string
+	ProductID   sql.NullInt64
+	SearchQuery sql.NullString
+	OrderID     sql.NullInt64
+	Properties  map[string]interface{}
+	OccurredAt  time.Time
+}
+
+// Funnel holds the fraction of sessions reaching each step of the purchase funnel. Every
+// step is reached by no more sessions than the step before it.
+type Funnel struct {
+	ProductView float64
+	AddToCart   float64
+	Checkout    float64
+	Purchase    float64
+}
+
+// Validate checks that the funnel only narrows
+func (f Funnel) Validate() error {
+	if f.Purchase <= 0 || f.Purchase > f.Checkout || f.Checkout > f.AddToCart || f.AddToCart > f.ProductView || f.ProductView > 1 {
+		return fmt.Errorf("funnel rates must satisfy 0 < purchase <= checkout <= add to cart <= product view <= 1")
+	}
+	return nil
+}
+
+// continueRate returns the chance a session that doesn't end in a purchase moves on from one
+// funnel step to the next
+func (f Funnel) continueRate(from, to float64) float64 {
+	if from <= f.Purchase {
+		return 0
+	}
+	return (to - f.Purchase) / (from - f.Purchase)
+}
+
+// GenerateEvents generates sessions and their clickstream events, writing them to the sink.
+// Every order without a session gets a session ending in its purchase, and enough browsing
+// sessions that drop out of the funnel are added for the overall rates to match the funnel.
+// Searches made in sessions are recorded in the search log too, wherever events are written.
+func GenerateEvents(db *sql.DB, sink EventSink, funnel Funnel, timeline *timedist.Distribution) error {
+	if err := funnel.Validate(); err != nil {
+		return err
+	}
+
+	orders, err := getConvertingOrders(db)
+	if err != nil {
+		return err
+	}
+
+	users, err := GetUserPersonas(db)
+	if err != nil {
+		return err
+	}
+
+	productIDs, err := GetRandomProductIDs(db, 200)
+	if err != nil {
+		return err
+	}
+	products, err := getBrowsableProducts(db, productIDs)
+	if err != nil {
+		return err
+	}
+	if len(products) == 0 {
+		return fmt.Errorf("no products found to browse")
+	}
+
+	searches, err := newSearchLog(db)
+	if err != nil {
+		return err
+	}
+	defer searches.Close()
+
+	browsingCount := int(math.Round(float64(len(orders)) * (1 - funnel.Purchase) / funnel.Purchase))
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(len(orders) + browsingCount).
+		WithTitle(fmt.Sprintf("Generating %d purchase and %d browsing sessions...", len(orders), browsingCount)).
+		Start()
+
+	for _, order := range orders {
+		builder := convertingSession(order)
+		if err := builder.write(sink); err != nil {
+			return err
+		}
+		if err := builder.logSearches(searches); err != nil {
+			return err
+		}
+		progressBar.Increment()
+	}
+
+	for i := 0; i < browsingCount; i++ {
+		// Most visitors are signed in, browsing while their persona is active
+		var userID sql.NullInt64
+		startedAt := timeline.Sample()
+		if len(users) > 0 && random.Float64() < 0.7 {
+			user := users[random.Intn(len(users))]
+			if from, to := user.Persona.ActiveWindow(timeline, user.SignedUpAt); to.After(from) {
+				userID = sql.NullInt64{Int64: int64(user.UserID), Valid: true}
+				startedAt = timeline.SampleBetween(from, to)
+			}
+		}
+
+		builder := browsingSession(userID, startedAt, products, funnel)
+		if err := builder.write(sink); err != nil {
+			return err
+		}
+		if err := builder.logSearches(searches); err != nil {
+			return err
+		}
+		progressBar.Increment()
+	}
+
+	return nil
+}
+
+// sessionBuilder accumulates the events of a session in chronological order
+type sessionBuilder struct {
+	session Session
+	events  []Event
+	at      time.Time
+}
+
+// newSessionBuilder starts a session at the given time, landing on a page that fits its channel
+func newSessionBuilder(userID sql.NullInt64, startedAt time.Time, landingProduct browsableProduct) *sessionBuilder {
+	channel := faker.TrafficChannel()
+	landingPage := "/"
+	switch channel {
+	case "paid_search", "social":
+		landingPage = productPage(landingProduct.ID)
+	case "organic_search", "email":
+		landingPage = fmt.Sprintf("/categories/%d", landingProduct.CategoryID)
+	}
+
+	builder := &sessionBuilder{
+		session: Session{
+			UserID:      userID,
+			Device:      faker.Device(),
+			Channel:     channel,
+			LandingPage: landingPage,
+			StartedAt:   startedAt,
+		},
+		at: startedAt,
+	}
+	builder.add(EventPageView, landingPage)
+	return builder
+}
+
+// add appends an event at the current time and moves time on by a few seconds to minutes.
+// The returned event can be filled in until the next event is added.
+func (b *sessionBuilder) add(eventType, page string) *Event {
+	b.events = append(b.events, Event{
+		UserID:     b.session.UserID,
+		Type:       eventType,
+		Page:       page,
+		Properties: map[string]interface{}{},
+		OccurredAt: b.at,
+	})
+	b.at = b.at.Add(time.Duration(5+random.Intn(115)) * time.Second)
+	return &b.events[len(b.events)-1]
+}
+
+// search appends a search for the product followed by the results page
+func (b *sessionBuilder) search(product browsableProduct) {
+	query := faker.ProductSearchQuery(product.Name)
+	event := b.add(EventSearch, "/search")
+	event.SearchQuery = sql.NullString{String: query, Valid: true}
+	b.add(EventPageView, "/search?q="+url.QueryEscape(query))
+}
+
+// viewProduct appends a product page view
+func (b *sessionBuilder) viewProduct(productID int) {
+	event := b.add(EventProductView, productPage(productID))
+	event.ProductID = sql.NullInt64{Int64: int64(productID), Valid: true}
+}
+
+// addToCart appends adding a quantity of a product to the cart
+func (b *sessionBuilder) addToCart(productID int, variantID sql.NullInt64, quantity int) {
+	event := b.add(EventAddToCart, productPage(productID))
+	event.ProductID = sql.NullInt64{Int64: int64(productID), Valid: true}
+	event.Properties["quantity"] = quantity
+	if variantID.Valid {
+		event.Properties["variant_id"] = variantID.Int64
+	}
+}
+
+// shift moves the whole session so its last event happens at the given time
+func (b *sessionBuilder) shift(lastEventAt time.Time) {
+	offset := lastEventAt.Sub(b.events[len(b.events)-1].OccurredAt)
+	b.session.StartedAt = b.session.StartedAt.Add(offset)
+	for i := range b.events {
+		b.events[i].OccurredAt = b.events[i].OccurredAt.Add(offset)
+	}
+}
+
+// write writes the session and its events to the sink
+func (b *sessionBuilder) write(sink EventSink) error {
+	b.session.EndedAt = b.events[len(b.events)-1].OccurredAt
+	sessionID, err := sink.WriteSession(b.session)
+	if err != nil {
+		return err
+	}
+	for _, event := range b.events {
+		event.SessionID = sessionID
+		if err := sink.WriteEvent(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logSearches records the searches made in the session in the search log. The shopper was
+// looking for the product viewed next, and clicks it when the results include it.
+func (b *sessionBuilder) logSearches(searches *searchLog) error {
+	for i, event := range b.events {
+		if event.Type != EventSearch {
+			continue
+		}
+		var wanted int64
+		for _, next := range b.events[i+1:] {
+			if next.Type == EventProductView {
+				wanted = next.ProductID.Int64
+				break
+			}
+		}
+
+		results, resultCount, err := searches.run(event.SearchQuery.String)
+		if err != nil {
+			return err
+		}
+		var clicked sql.NullInt64
+		for _, id := range results {
+			if int64(id) == wanted {
+				clicked = sql.NullInt64{Int64: wanted, Valid: true}
+				break
+			}
+		}
+
+		if err := searches.record(event.UserID, event.SearchQuery.String, resultCount, clicked, event.OccurredAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convertingSession builds the session that ended in an order: the products in the order are
+// viewed and added to the cart before checking out, and the purchase happens when the order
+// was created
+func convertingSession(order convertingOrder) *sessionBuilder {
+	userID := sql.NullInt64{Int64: int64(order.UserID), Valid: true}
+	builder := newSessionBuilder(userID, order.CreatedAt, order.Items[0].Product)
+	builder.session.OrderID = sql.NullInt64{Int64: int64(order.ID), Valid: true}
+
+	if random.Float64() < 0.4 {
+		builder.search(order.Items[0].Product)
+	}
+	for _, item := range order.Items {
+		builder.viewProduct(item.Product.ID)
+		builder.addToCart(item.Product.ID, item.VariantID, item.Quantity)
+	}
+	builder.add(EventPageView, "/cart")
+	builder.add(EventCheckoutStart, "/checkout")
+	purchase := builder.add(EventPurchase, "/checkout/confirmation")
+	purchase.OrderID = builder.session.OrderID
+	purchase.Properties["total"] = order.TotalAmount.Float()
+	purchase.Properties["currency"] = order.Currency
+
+	builder.shift(order.CreatedAt)
+	return builder
+}
+
+// browsingSession builds a session that drops out of the funnel before purchasing
+func browsingSession(userID sql.NullInt64, startedAt time.Time, products []browsableProduct, funnel Funnel) *sessionBuilder {
+	first := products[random.Intn(len(products))]
+	builder := newSessionBuilder(userID, startedAt, first)
+
+	// Bounced visitors look at a few pages at most
+	if random.Float64() >= funnel.continueRate(1, funnel.ProductView) {
+		for i := random.Intn(3); i > 0; i-- {
+			builder.add(EventPageView, fmt.Sprintf("/categories/%d", products[random.Intn(len(products))].CategoryID))
+		}
+		return builder
+	}
+
+	if random.Float64() < 0.4 {
+		builder.search(first)
+	}
+	viewed := []browsableProduct{first}
+	for i := random.Intn(4); i > 0; i-- {
+		viewed = append(viewed, products[random.Intn(len(products))])
+	}
+	for _, product := range viewed {
+		builder.viewProduct(product.ID)
+	}
+
+	if random.Float64() >= funnel.continueRate(funnel.ProductView, funnel.AddToCart) {
+		return builder
+	}
+	product := viewed[random.Intn(len(viewed))]
+	builder.addToCart(product.ID, sql.NullInt64{}, 1+random.Intn(2))
+
+	if random.Float64() >= funnel.continueRate(funnel.AddToCart, funnel.Checkout) {
+		return builder
+	}
+	builder.add(EventPageView, "/cart")
+	builder.add(EventCheckoutStart, "/checkout")
+	return builder
+}
+
+// productPage returns the path of a product's page
+func productPage(productID int) string {
+	return fmt.Sprintf("/products/%d", productID)
+}
+
+// browsableProduct holds the product details that appear in events
+type browsableProduct struct {
+	ID         int
+	Name       string
+	CategoryID int
+}
+
+// getBrowsableProducts returns the name and category of the given products
+func getBrowsableProducts(db *sql.DB, productIDs []int) ([]browsableProduct, error) {
+	rows, err := db.Query("SELECT id, name, category_id FROM products WHERE id = ANY($1)", pq.Array(productIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get products: %w", err)
+	}
+	defer rows.Close()
+
+	var products []browsableProduct
+	for rows.Next() {
+		var product browsableProduct
+		if err := rows.Scan(&product.ID, &product.Name, &product.CategoryID); err != nil {
+			return nil, fmt.Errorf("failed to scan product: %w", err)
+		}
+		products = append(products, product)
+	}
+
+	return products, nil
+}
+
+// convertingOrder holds the order details needed to build the session that placed it
+type convertingOrder struct {
+	ID          int
+	UserID      int
+	Currency    string
+	TotalAmount money.Amount
+	CreatedAt   time.Time
+	Items       []convertingItem
+}
+
+// convertingItem holds an order item along with its product
+type convertingItem struct {
+	Product   browsableProduct
+	VariantID sql.NullInt64
+	Quantity  int
+}
+
+// getConvertingOrders returns the orders that have no session yet, along with their items.
+// Subscription renewals are placed by the billing job rather than in a session.
+func getConvertingOrders(db *sql.DB) ([]convertingOrder, error) {
+	rows, err := db.Query(`
+		SELECT o.id, o.user_id, o.currency, o.total_amount, o.created_at,
+			oi.product_id, p.name, p.category_id, oi.variant_id, oi.quantity
+		FROM orders o
+		JOIN order_items oi ON oi.order_id = o.id
+		JOIN products p ON p.id = oi.product_id
+		WHERE NOT EXISTS (SELECT 1 FROM sessions s WHERE s.order_id = o.id)
+			AND NOT EXISTS (
+				SELECT 1 FROM subscriptions sub
+				WHERE sub.id = o.subscription_id AND sub.started_at < o.created_at
+			)
+		ORDER BY o.id, oi.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []convertingOrder
+	for rows.Next() {
+		var order convertingOrder
+		var item convertingItem
+		if err := rows.Scan(
+			&order.ID, &order.UserID, &order.Currency, &order.TotalAmount, &order.CreatedAt,
+			&item.Product.ID, &item.Product.Name, &item.Product.CategoryID, &item.VariantID, &item.Quantity,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan order item: %w", err)
+		}
+
+		if len(orders) == 0 || orders[len(orders)-1].ID != order.ID {
+			orders = append(orders, order)
+		}
+		last := &orders[len(orders)-1]
+		last.Items = append(last.Items, item)
+	}
+
+	return orders, nil
+}
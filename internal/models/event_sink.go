@@ -0,0 +1,230 @@
+package models
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Ways of writing generated events
+const (
+	EventOutputNone  = "none"
+	EventOutputDB    = "db"    // Sessions and events tables
+	EventOutputJSONL = "jsonl" // sessions.jsonl and one events file per month
+)
+
+// ValidateEventOutput checks that the output is one of the ways of writing events
+func ValidateEventOutput(output string) error {
+	switch output {
+	case EventOutputNone, EventOutputDB, EventOutputJSONL:
+		return nil
+	}
+	return fmt.Errorf("unknown events output %q (available: none, db, jsonl)", output)
+}
+
+// EventSink receives generated sessions and their events
+type EventSink interface {
+	// WriteSession stores a session and returns its ID
+	WriteSession(session Session) (int64, error)
+	WriteEvent(event Event) error
+	Close() error
+}
+
+// dbEventSink inserts sessions and events into the database
+type dbEventSink struct {
+	sessionStmt *sql.Stmt
+	eventStmt   *sql.Stmt
+}
+
+// NewDBEventSink returns a sink inserting into the sessions and events tables. The events
+// partitions covering the generated events must already exist.
+func NewDBEventSink(db *sql.DB) (EventSink, error) {
+	sessionStmt, err := db.Prepare(`
+		INSERT INTO sessions (user_id, device, channel, landing_page, order_id, started_at, ended_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare session statement: %w", err)
+	}
+
+	eventStmt, err := db.Prepare(`
+		INSERT INTO events (session_id, user_id, event_type, page, product_id, search_query, order_id, properties, occurred_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`)
+	if err != nil {
+		sessionStmt.Close()
+		return nil, fmt.Errorf("failed to prepare event statement: %w", err)
+	}
+
+	return &dbEventSink{sessionStmt: sessionStmt, eventStmt: eventStmt}, nil
+}
+
+func (s *dbEventSink) WriteSession(session Session) (int64, error) {
+	var id int64
+	err := s.sessionStmt.QueryRow(
+		session.UserID, session.Device, session.Channel, session.LandingPage, session.OrderID,
+		session.StartedAt, session.EndedAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert session: %w", err)
+	}
+	return id, nil
+}
+
+func (s *dbEventSink) WriteEvent(event Event) error {
+	properties, err := json.Marshal(event.Properties)
+	if err != nil {
+		return fmt.Errorf("failed to encode event properties: %w", err)
+	}
+
+	_, err = s.eventStmt.Exec(
+		event.SessionID, event.UserID, event.Type, event.Page, event.ProductID, event.SearchQuery,
+		event.OrderID, string(properties), event.OccurredAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert event: %w", err)
+	}
+	return nil
+}
+
+func (s *dbEventSink) Close() error {
+	s.sessionStmt.Close()
+	return s.eventStmt.Close()
+}
+
+// jsonlEventSink writes sessions and events as JSON lines, numbering them itself
+type jsonlEventSink struct {
+	dir           string
+	files         map[string]*os.File
+	writers       map[string]*bufio.Writer
+	nextSessionID int64
+	nextEventID   int64
+}
+
+// NewJSONLEventSink returns a sink writing sessions.jsonl and one events_YYYY_MM.jsonl file
+// per month into the directory, matching the partitions of the events table. IDs are
+// numbered from 1, so each run should write into its own directory.
+func NewJSONLEventSink(dir string) (EventSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create events directory: %w", err)
+	}
+	return &jsonlEventSink{
+		dir:           dir,
+		files:         make(map[string]*os.File),
+		writers:       make(map[string]*bufio.Writer),
+		nextSessionID: 1,
+		nextEventID:   1,
+	}, nil
+}
+
+// sessionRecord is the JSON form of a session
+type sessionRecord struct {
+	ID          int64     `json:"id"`
+	UserID      *int64    `json:"user_id"`
+	Device      string    `json:"device"`
+	Channel     string    `json:"channel"`
+	LandingPage string    `json:"landing_page"`
+	OrderID     *int64    `json:"order_id"`
+	StartedAt   time.Time `json:"started_at"`
+	EndedAt     time.Time `json:"ended_at"`
+}
+
+// eventRecord is the JSON form of an event
+type eventRecord struct {
+	ID          int64                  `json:"id"`
+	SessionID   int64                  `json:"session_id"`
+	UserID      *int64                 `json:"user_id"`
+	EventType   string                 `json:"event_type"`
+	Page        string                 `json:"page"`
+	ProductID   *int64                 `json:"product_id"`
+	SearchQuery *string                `json:"search_query"`
+	OrderID     *int64                 `json:"order_id"`
+	Properties  map[string]interface{} `json:"properties"`
+	OccurredAt  time.Time              `json:"occurred_at"`
+}
+
+// nullableInt returns a pointer to the value, or nil when it's null
+func nullableInt(n sql.NullInt64) *int64 {
+	if !n.Valid {
+		return nil
+	}
+	return &n.Int64
+}
+
+func (s *jsonlEventSink) WriteSession(session Session) (int64, error) {
+	id := s.nextSessionID
+	s.nextSessionID++
+
+	record := sessionRecord{
+		ID:          id,
+		UserID:      nullableInt(session.UserID),
+		Device:      session.Device,
+		Channel:     session.Channel,
+		LandingPage: session.LandingPage,
+		OrderID:     nullableInt(session.OrderID),
+		StartedAt:   session.StartedAt,
+		EndedAt:     session.EndedAt,
+	}
+	return id, s.writeLine("sessions.jsonl", record)
+}
+
+func (s *jsonlEventSink) WriteEvent(event Event) error {
+	record := eventRecord{
+		ID:         s.nextEventID,
+		SessionID:  event.SessionID,
+		UserID:     nullableInt(event.UserID),
+		EventType:  event.Type,
+		Page:       event.Page,
+		ProductID:  nullableInt(event.ProductID),
+		OrderID:    nullableInt(event.OrderID),
+		Properties: event.Properties,
+		OccurredAt: event.OccurredAt,
+	}
+	if event.SearchQuery.Valid {
+		record.SearchQuery = &event.SearchQuery.String
+	}
+	s.nextEventID++
+
+	return s.writeLine("events_"+event.OccurredAt.Format("2006_01")+".jsonl", record)
+}
+
+// writeLine appends a JSON encoded record to the named file, opening it on first use
+func (s *jsonlEventSink) writeLine(name string, record interface{}) error {
+	writer, ok := s.writers[name]
+	if !ok {
+		file, err := os.Create(filepath.Join(s.dir, name))
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", name, err)
+		}
+		s.files[name] = file
+		writer = bufio.NewWriter(file)
+		s.writers[name] = writer
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s record: %w", name, err)
+	}
+	if _, err := writer.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *jsonlEventSink) Close() error {
+	var firstErr error
+	for name, writer := range s.writers {
+		if err := writer.Flush(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		if err := s.files[name].Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close %s: %w", name, err)
+		}
+	}
+	return firstErr
+}
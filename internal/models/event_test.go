@@ -0,0 +1,56 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFunnelValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		funnel  Funnel
+		wantErr bool
+	}{
+		{"narrowing funnel", Funnel{ProductView: 0.6, AddToCart: 0.3, Checkout: 0.2, Purchase: 0.1}, false},
+		{"every session purchases", Funnel{ProductView: 1, AddToCart: 1, Checkout: 1, Purchase: 1}, false},
+		{"no purchases", Funnel{ProductView: 0.6, AddToCart: 0.3, Checkout: 0.2}, true},
+		{"widening step", Funnel{ProductView: 0.6, AddToCart: 0.7, Checkout: 0.2, Purchase: 0.1}, true},
+		{"purchase above checkout", Funnel{ProductView: 0.6, AddToCart: 0.3, Checkout: 0.2, Purchase: 0.25}, true},
+		{"rate above one", Funnel{ProductView: 1.2, AddToCart: 0.3, Checkout: 0.2, Purchase: 0.1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.funnel.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestFunnelContinueRate checks that purchase sessions, which reach every step, together with
+// browsing sessions moving on at the continue rates reach each step at the funnel's rate
+func TestFunnelContinueRate(t *testing.T) {
+	funnels := []Funnel{
+		{ProductView: 0.6, AddToCart: 0.3, Checkout: 0.2, Purchase: 0.1},
+		{ProductView: 0.9, AddToCart: 0.5, Checkout: 0.45, Purchase: 0.02},
+		{ProductView: 0.4, AddToCart: 0.4, Checkout: 0.4, Purchase: 0.4},
+	}
+
+	for _, funnel := range funnels {
+		steps := []float64{1, funnel.ProductView, funnel.AddToCart, funnel.Checkout}
+		reached := 1.0 // Fraction of browsing sessions reaching the step
+		for i := 1; i < len(steps); i++ {
+			rate := funnel.continueRate(steps[i-1], steps[i])
+			if rate < 0 || rate > 1 {
+				t.Fatalf("%+v: continue rate into step %d is %v", funnel, i, rate)
+			}
+			reached *= rate
+
+			overall := funnel.Purchase + (1-funnel.Purchase)*reached
+			if math.Abs(overall-steps[i]) > 1e-9 {
+				t.Errorf("%+v: step %d reached by %v of sessions, want %v", funnel, i, overall, steps[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"database-test/pkg/money"
+	"database-test/pkg/timedist"
+
+	"github.com/pterm/pterm"
+)
+
+// ExchangeRate represents the daily rate between a base and a quote currency
+type ExchangeRate struct {
+	ID            int
+	RateDate      time.Time
+	BaseCurrency  string
+	QuoteCurrency string
+	Rate          float64
+	CreatedAt     time.Time
+}
+
+// referenceRates holds approximate units of each currency per US dollar, used as the
+// starting point of the generated rate history
+var referenceRates = map[string]float64{
+	"USD": 1, "EUR": 0.92, "GBP": 0.79, "CAD": 1.36, "MXN": 17.1, "JPY": 150.2,
+	"CNY": 7.19, "AUD": 1.52, "NZD": 1.64, "BRL": 4.97, "ARS": 830, "CLP": 940,
+	"RUB": 91.5, "INR": 83.0, "ZAR": 18.9, "NGN": 1450, "EGP": 30.9,
+}
+
+// dailyVolatility is the standard deviation of the daily log change of a rate
+const dailyVolatility = 0.005
+
+// usdConversion returns the conversion of amounts defined in US dollars, such as fees and
+// catalog price ranges, into the target currency of fx, a conversion from the base currency.
+// Dollars are converted into the base currency at its reference rate.
+func usdConversion(base money.Currency, fx money.Conversion) money.Conversion {
+	return money.Conversion{Rate: referenceRates[base.Code] * fx.Rate, To: fx.To}
+}
+
+// fromUSD converts an amount defined in US dollars into the currency at its reference rate
+func fromUSD(a money.Amount, c money.Currency) money.Amount {
+	return usdConversion(c, money.Identity(c)).Apply(a)
+}
+
+// GenerateExchangeRates generates a daily rate history from the base currency to every
+// other supported currency over the time window, as a random walk from reference rates.
+// Days that already have a rate keep it, so orders priced at it still match.
+func GenerateExchangeRates(db *sql.DB, base money.Currency, timeline *timedist.Distribution) error {
+	stmt, err := db.Prepare(`
+		INSERT INTO exchange_rates (rate_date, base_currency, quote_currency, rate)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT ON CONSTRAINT exchange_rates_day_key DO NOTHING
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	quotes := make([]string, 0, len(money.Currencies))
+	for code := range money.Currencies {
+		if code != base.Code {
+			quotes = append(quotes, code)
+		}
+	}
+	sort.Strings(quotes)
+
+	firstDay := timeline.Start.Truncate(24 * time.Hour)
+	days := int(timeline.End.Sub(firstDay).Hours()/24) + 1
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(days * len(quotes)).
+		WithTitle(fmt.Sprintf("Generating %d days of %s exchange rates for %d currencies...", days, base.Code, len(quotes))).
+		Start()
+
+	for _, quote := range quotes {
+		rate := referenceRates[quote] / referenceRates[base.Code]
+		for day := 0; day < days; day++ {
+			date := firstDay.AddDate(0, 0, day)
+			if _, err := stmt.Exec(date, base.Code, quote, fmt.Sprintf("%.8f", rate)); err != nil {
+				return fmt.Errorf("failed to insert exchange rate: %w", err)
+			}
+			rate *= math.Exp(random.NormFloat64() * dailyVolatility)
+			progressBar.Increment()
+		}
+	}
+
+	return nil
+}
+
+// ExchangeRates holds the daily rates from a base currency, used to price orders
+type ExchangeRates struct {
+	Base    money.Currency
+	byQuote map[string][]datedRate // Rates to each quote currency in date order
+}
+
+// datedRate is the rate of a day, with the day formatted as a date
+type datedRate struct {
+	Day  string
+	Rate float64
+}
+
+// GetExchangeRates returns every stored rate from the base currency
+func GetExchangeRates(db *sql.DB, base money.Currency) (*ExchangeRates, error) {
+	rows, err := db.Query(
+		"SELECT rate_date, quote_currency, rate FROM exchange_rates WHERE base_currency = $1 ORDER BY rate_date",
+		base.Code,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exchange rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := &ExchangeRates{Base: base, byQuote: make(map[string][]datedRate)}
+	for rows.Next() {
+		var date time.Time
+		var quote string
+		var rate float64
+		if err := rows.Scan(&date, &quote, &rate); err != nil {
+			return nil, fmt.Errorf("failed to scan exchange rate: %w", err)
+		}
+		rates.byQuote[quote] = append(rates.byQuote[quote], datedRate{Day: date.Format(time.DateOnly), Rate: rate})
+	}
+
+	return rates, nil
+}
+
+// Conversion returns the conversion from the base currency into the quote currency on the
+// given day. Days without a rate of their own use the latest rate stored before them.
+func (r *ExchangeRates) Conversion(quote money.Currency, at time.Time) (money.Conversion, error) {
+	if quote.Code == r.Base.Code {
+		return money.Identity(r.Base), nil
+	}
+
+	// Dates formatted as YYYY-MM-DD sort in date order
+	day := at.Format(time.DateOnly)
+	rates := r.byQuote[quote.Code]
+	i := sort.Search(len(rates), func(i int) bool { return rates[i].Day > day })
+	if i == 0 {
+		return money.Conversion{}, fmt.Errorf("no %s to %s exchange rate on or before %s", r.Base.Code, quote.Code, day)
+	}
+	return money.Conversion{Rate: rates[i-1].Rate, To: quote}, nil
+}
@@ -0,0 +1,341 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"database-test/pkg/money"
+	"database-test/pkg/timedist"
+
+	"github.com/pterm/pterm"
+)
+
+// Loyalty transaction types
+const (
+	LoyaltyEarn   = "earn"
+	LoyaltyRedeem = "redeem"
+)
+
+// loyaltyPaymentMethod is the payment method of the part of an order paid with points
+const loyaltyPaymentMethod = "Loyalty Points"
+
+// Points are worth one minor unit of the base currency each, so 100 points make a dollar.
+// Customers redeem points in blocks, on some orders once they have enough, and never for
+// more than half of what they would pay by card.
+const (
+	loyaltyRedeemBlock   = 100
+	loyaltyRedeemMinimum = 500
+	loyaltyRedeemRate    = 0.3
+)
+
+// LoyaltyAccount represents a customer's membership of the loyalty program
+type LoyaltyAccount struct {
+	ID             int
+	UserID         int
+	Tier           string
+	PointsBalance  int
+	LifetimePoints int
+	EnrolledAt     time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// LoyaltyTransaction represents points earned or redeemed. Earned points are positive and
+// redeemed points negative.
+type LoyaltyTransaction struct {
+	ID              int
+	AccountID       int
+	TransactionType string
+	Points          int
+	BalanceAfter    int
+	OrderID         sql.NullInt64
+	OccurredAt      time.Time
+	CreatedAt       time.Time
+}
+
+// LoyaltyTierChange represents a member moving between tiers
+type LoyaltyTierChange struct {
+	ID        int
+	AccountID int
+	FromTier  sql.NullString
+	ToTier    string
+	ChangedAt time.Time
+	CreatedAt time.Time
+}
+
+// loyaltyTier is a level of the loyalty program, reached by earning enough points in a year
+type loyaltyTier struct {
+	Name       string
+	Threshold  int     // Points earned over the last 12 months to reach the tier
+	Multiplier float64 // Points earned per unit of the base currency spent
+}
+
+// loyaltyTiers lists the tiers from lowest to highest
+var loyaltyTiers = []loyaltyTier{
+	{Name: "Bronze", Threshold: 0, Multiplier: 1},
+	{Name: "Silver", Threshold: 500, Multiplier: 1.25},
+	{Name: "Gold", Threshold: 1500, Multiplier: 1.5},
+	{Name: "Platinum", Threshold: 4000, Multiplier: 2},
+}
+
+// tierFor returns the index of the highest tier reached with the given yearly points
+func tierFor(points int) int {
+	tier := 0
+	for i, t := range loyaltyTiers {
+		if points >= t.Threshold {
+			tier = i
+		}
+	}
+	return tier
+}
+
+// loyaltyOrder holds the order details needed to earn and redeem points
+type loyaltyOrder struct {
+	ID            int
+	UserID        int
+	SignedUpAt    time.Time
+	TotalAmount   money.Amount
+	ExchangeRate  float64
+	Currency      string
+	CreatedAt     time.Time
+	CardPaymentID sql.NullInt64
+	CardAmount    money.Amount
+}
+
+// loyaltyMember tracks a member's points and tier while their orders are replayed
+type loyaltyMember struct {
+	AccountID  int
+	Tier       int
+	Balance    int
+	Lifetime   int
+	NextReview time.Time
+	Earned     []LoyaltyTransaction // Earn transactions, for the rolling 12 months
+	UpdatedAt  time.Time
+}
+
+// yearlyPoints returns the points earned in the 12 months up to at
+func (m *loyaltyMember) yearlyPoints(at time.Time) int {
+	points := 0
+	for _, earn := range m.Earned {
+		if earn.OccurredAt.After(at.AddDate(-1, 0, 0)) && !earn.OccurredAt.After(at) {
+			points += earn.Points
+		}
+	}
+	return points
+}
+
+// GenerateLoyalty enrolls enrollmentRate of the customers without a loyalty account and
+// replays their orders. Orders earn points on their total in the base currency, multiplied
+// by the member's tier, and some redeem points as a payment taken off the card payment.
+// Members move up a tier as soon as their points over the last 12 months reach it, and are
+// reviewed on each membership anniversary, where they may move down.
+func GenerateLoyalty(db *sql.DB, enrollmentRate float64, timeline *timedist.Distribution) error {
+	orders, err := getLoyaltyOrders(db)
+	if err != nil {
+		return err
+	}
+
+	accountStmt, err := db.Prepare(`
+		INSERT INTO loyalty_accounts (user_id, tier, enrolled_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $3, $3)
+		RETURNING id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare account statement: %w", err)
+	}
+	defer accountStmt.Close()
+
+	transactionStmt, err := db.Prepare(`
+		INSERT INTO loyalty_transactions (account_id, transaction_type, points, balance_after, order_id, occurred_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare transaction statement: %w", err)
+	}
+	defer transactionStmt.Close()
+
+	tierStmt, err := db.Prepare(`
+		INSERT INTO loyalty_tier_changes (account_id, from_tier, to_tier, changed_at)
+		VALUES ($1, $2, $3, $4)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare tier change statement: %w", err)
+	}
+	defer tierStmt.Close()
+
+	changeTier := func(member *loyaltyMember, tier int, at time.Time) error {
+		from := sql.NullString{String: loyaltyTiers[member.Tier].Name, Valid: true}
+		if _, err := tierStmt.Exec(member.AccountID, from, loyaltyTiers[tier].Name, at); err != nil {
+			return fmt.Errorf("failed to insert tier change: %w", err)
+		}
+		member.Tier = tier
+		member.UpdatedAt = at
+		return nil
+	}
+
+	// Anniversary reviews reset the tier to what the last 12 months earned
+	review := func(member *loyaltyMember, until time.Time) error {
+		for !member.NextReview.After(until) {
+			if tier := tierFor(member.yearlyPoints(member.NextReview)); tier != member.Tier {
+				if err := changeTier(member, tier, member.NextReview); err != nil {
+					return err
+				}
+			}
+			member.NextReview = member.NextReview.AddDate(1, 0, 0)
+		}
+		return nil
+	}
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(len(orders)).
+		WithTitle(fmt.Sprintf("Replaying %d orders for loyalty points...", len(orders))).
+		Start()
+
+	members := make(map[int]*loyaltyMember)
+	enrolled := make(map[int]bool)
+	for _, order := range orders {
+		progressBar.Increment()
+
+		// Customers decide whether to join around their first order
+		if _, decided := enrolled[order.UserID]; !decided {
+			enrolled[order.UserID] = random.Float64() < enrollmentRate
+			if !enrolled[order.UserID] {
+				continue
+			}
+
+			enrolledAt := order.CreatedAt.Add(-time.Duration(random.Int63n(int64(30 * 24 * time.Hour)))).Truncate(time.Second)
+			if enrolledAt.Before(order.SignedUpAt) {
+				enrolledAt = order.SignedUpAt
+			}
+			member := &loyaltyMember{NextReview: enrolledAt.AddDate(1, 0, 0), UpdatedAt: enrolledAt}
+			if err := accountStmt.QueryRow(order.UserID, loyaltyTiers[0].Name, enrolledAt).Scan(&member.AccountID); err != nil {
+				return fmt.Errorf("failed to insert loyalty account: %w", err)
+			}
+			if _, err := tierStmt.Exec(member.AccountID, nil, loyaltyTiers[0].Name, enrolledAt); err != nil {
+				return fmt.Errorf("failed to insert tier change: %w", err)
+			}
+			members[order.UserID] = member
+		}
+		member, ok := members[order.UserID]
+		if !ok {
+			continue
+		}
+		if err := review(member, order.CreatedAt); err != nil {
+			return err
+		}
+		orderID := sql.NullInt64{Int64: int64(order.ID), Valid: true}
+
+		// Redeem points against the card payment
+		if order.CardPaymentID.Valid && member.Balance >= loyaltyRedeemMinimum && random.Float64() < loyaltyRedeemRate {
+			currency, err := money.LookupCurrency(order.Currency)
+			if err != nil {
+				return err
+			}
+			fx := money.Conversion{Rate: order.ExchangeRate, To: currency}
+			maxPoints := int(float64(order.CardAmount/2) / order.ExchangeRate)
+			points := min(member.Balance, maxPoints) / loyaltyRedeemBlock * loyaltyRedeemBlock
+
+			if value := fx.Apply(money.Amount(points)); points > 0 && value > 0 && value < order.CardAmount {
+				member.Balance -= points
+				member.UpdatedAt = order.CreatedAt
+				if _, err := transactionStmt.Exec(
+					member.AccountID, LoyaltyRedeem, -points, member.Balance, orderID, order.CreatedAt,
+				); err != nil {
+					return fmt.Errorf("failed to insert loyalty transaction: %w", err)
+				}
+				if _, err := db.Exec(
+					"INSERT INTO order_payments (order_id, method, amount, paid_at) VALUES ($1, $2, $3, $4)",
+					order.ID, loyaltyPaymentMethod, value, order.CreatedAt,
+				); err != nil {
+					return fmt.Errorf("failed to insert order payment: %w", err)
+				}
+				if _, err := db.Exec(
+					"UPDATE order_payments SET amount = amount - $1 WHERE id = $2", value, order.CardPaymentID.Int64,
+				); err != nil {
+					return fmt.Errorf("failed to update order payment: %w", err)
+				}
+			}
+		}
+
+		// Earn points on the total in the base currency
+		baseUnits := order.TotalAmount.Float() / order.ExchangeRate
+		points := int(math.Floor(baseUnits * loyaltyTiers[member.Tier].Multiplier))
+		if points <= 0 {
+			continue
+		}
+		member.Balance += points
+		member.Lifetime += points
+		member.UpdatedAt = order.CreatedAt
+		member.Earned = append(member.Earned, LoyaltyTransaction{Points: points, OccurredAt: order.CreatedAt})
+		if _, err := transactionStmt.Exec(
+			member.AccountID, LoyaltyEarn, points, member.Balance, orderID, order.CreatedAt,
+		); err != nil {
+			return fmt.Errorf("failed to insert loyalty transaction: %w", err)
+		}
+
+		// Upgrades happen as soon as the threshold is reached
+		if tier := tierFor(member.yearlyPoints(order.CreatedAt)); tier > member.Tier {
+			if err := changeTier(member, tier, order.CreatedAt); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Review the remaining anniversaries and store the final state of each account
+	for _, member := range members {
+		if err := review(member, timeline.End); err != nil {
+			return err
+		}
+		_, err := db.Exec(`
+			UPDATE loyalty_accounts
+			SET tier = $1, points_balance = $2, lifetime_points = $3, updated_at = $4
+			WHERE id = $5
+		`, loyaltyTiers[member.Tier].Name, member.Balance, member.Lifetime, member.UpdatedAt, member.AccountID)
+		if err != nil {
+			return fmt.Errorf("failed to update loyalty account: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// getLoyaltyOrders returns the orders of customers without a loyalty account that earn
+// points, grouped by customer in chronological order, along with the card payment points
+// can be redeemed against. Pending, cancelled and refunded orders earn nothing.
+func getLoyaltyOrders(db *sql.DB) ([]loyaltyOrder, error) {
+	rows, err := db.Query(`
+		SELECT o.id, o.user_id, u.created_at, o.total_amount, o.exchange_rate, o.currency, o.created_at,
+			p.id, COALESCE(p.amount, 0)
+		FROM orders o
+		JOIN users u ON u.id = o.user_id
+		LEFT JOIN order_payments p ON p.order_id = o.id
+			AND p.method = o.payment_method AND p.ledger_entry_id IS NULL
+		WHERE o.status NOT IN ('Pending', 'Cancelled', 'Refunded')
+			AND NOT EXISTS (SELECT 1 FROM loyalty_accounts a WHERE a.user_id = o.user_id)
+		ORDER BY o.user_id, o.created_at, o.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []loyaltyOrder
+	for rows.Next() {
+		var order loyaltyOrder
+		if err := rows.Scan(
+			&order.ID, &order.UserID, &order.SignedUpAt, &order.TotalAmount, &order.ExchangeRate,
+			&order.Currency, &order.CreatedAt, &order.CardPaymentID, &order.CardAmount,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read orders: %w", err)
+	}
+
+	return orders, nil
+}
@@ -6,22 +6,43 @@ import (
 	"time"
 
 	"database-test/pkg/faker"
+	"database-test/pkg/money"
+	"database-test/pkg/timedist"
 
+	"github.com/lib/pq"
 	"github.com/pterm/pterm"
 )
 
+// Order lines hold between minLineQuantity and maxLineQuantity units of their product
+const (
+	minLineQuantity = 1
+	maxLineQuantity = 5
+)
+
+// meanLineQuantity is the average number of units on an order line
+const meanLineQuantity = (minLineQuantity + maxLineQuantity) / 2.0
+
 // Order represents an order in the e-commerce system
 type Order struct {
 	ID                int
 	UserID            int
+	SubscriptionID    sql.NullInt64
 	Status            string
-	TotalAmount       float64
+	Currency          string
+	ExchangeRate      float64
+	Subtotal          money.Amount
+	DiscountAmount    money.Amount
+	DiscountCode      sql.NullString
+	ShippingCost      money.Amount
+	TaxAmount         money.Amount
+	TotalAmount       money.Amount
 	ShippingAddressID int
 	BillingAddressID  int
 	PaymentMethod     string
 	ShippingMethod    string
 	TrackingNumber    sql.NullString
 	Notes             sql.NullString
+	DeliveredAt       sql.NullTime
 	CreatedAt         time.Time
 	UpdatedAt         time.Time
 }
@@ -31,76 +52,134 @@ type OrderItem struct {
 	ID           int
 	OrderID      int
 	ProductID    int
+	VariantID    int
+	PromotionID  sql.NullInt64
+	ShipmentID   sql.NullInt64
 	Quantity     int
-	PricePerUnit float64
+	PricePerUnit money.Amount
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 }
 
-// GenerateOrders generates n fake orders and inserts them into the database
-func GenerateOrders(db *sql.DB, count int, maxItemsPerOrder int) error {
-	// Get random user IDs
-	userIDs, err := GetRandomUserIDs(db, count)
+// GenerateOrders generates n fake orders and inserts them into the database.
+// Users are picked according to the order frequency of their persona, and order
+// timestamps follow the traffic shape of the timeline within the user's active period.
+// Items are sold at the list price of the order date, less the deepest active promotion.
+// Orders are placed in the local currency of the shipping address, converted from the
+// base currency at the rate of the order date. Orders that left the warehouse are split
+// into one shipment per seller. Baskets holding the anchor of a planted association get
+// its partner too, at the association's rate.
+func GenerateOrders(db *sql.DB, count int, maxItemsPerOrder int, timeline *timedist.Distribution, baseCurrency money.Currency) error {
+	// Get every user along with the persona driving their behavior
+	users, err := GetUserPersonas(db)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return fmt.Errorf("no users found to place orders")
+	}
+
+	userIDs := make([]int, len(users))
+	for i, user := range users {
+		userIDs[i] = user.UserID
+	}
+
+	// Get addresses for each user
+	userAddresses, err := GetRandomAddressIDsByUser(db, userIDs)
 	if err != nil {
 		return err
 	}
 
-	// If we don't have enough users, reuse them
-	for len(userIDs) < count {
-		userIDs = append(userIDs, userIDs...)
+	// Only users with an address and an active period inside the time window can place orders
+	eligibleUsers := make([]UserPersona, 0, len(users))
+	frequencies := make([]float64, 0, len(users))
+	for _, user := range users {
+		if _, ok := userAddresses[user.UserID]; !ok {
+			continue
+		}
+		if from, to := user.Persona.ActiveWindow(timeline, user.SignedUpAt); !to.After(from) {
+			continue
+		}
+		eligibleUsers = append(eligibleUsers, user)
+		frequencies = append(frequencies, user.Persona.OrderFrequency)
+	}
+	if len(eligibleUsers) == 0 {
+		return fmt.Errorf("no users with addresses found to place orders")
+	}
+	userChooser := newWeightedChooser(frequencies)
+	ordersPerUser := make(map[int]int)
+
+	// Get the region of each address for taxes
+	addressIDs := make([]int, 0, len(userAddresses))
+	for _, addressID := range userAddresses {
+		addressIDs = append(addressIDs, addressID)
+	}
+	addressRegions, err := GetAddressRegions(db, addressIDs)
+	if err != nil {
+		return err
 	}
-	userIDs = userIDs[:count]
 
 	// Get random product IDs
 	productIDs, err := GetRandomProductIDs(db, 100) // Get a pool of products to choose from
 	if err != nil {
 		return err
 	}
+	if len(productIDs) == 0 {
+		return fmt.Errorf("no products found to order")
+	}
 
-	// Get addresses for each user
-	userAddresses, err := GetRandomAddressIDsByUser(db, userIDs)
+	// Products in planted associations are always on offer, so the pairs show up in orders
+	planted, err := getPlantedAssociations(db)
 	if err != nil {
 		return err
 	}
+	pool := make(map[int]bool, len(productIDs))
+	for _, id := range productIDs {
+		pool[id] = true
+	}
+	for _, associations := range planted {
+		for _, association := range associations {
+			for _, id := range []int{association.AnchorProductID, association.PartnerProductID} {
+				if !pool[id] {
+					productIDs = append(productIDs, id)
+					pool[id] = true
+				}
+			}
+		}
+	}
 
-	// Prepare order statement
-	orderStmt, err := db.Prepare(`
-		INSERT INTO orders (
-			user_id, status, total_amount, shipping_address_id, billing_address_id,
-			payment_method, shipping_method, tracking_number, notes, created_at, updated_at
-		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), NOW())
-		RETURNING id
-	`)
+	// Get product prices, price history, billable weights and variants
+	products, err := getCatalogProducts(db, productIDs)
 	if err != nil {
-		return fmt.Errorf("failed to prepare order statement: %w", err)
+		return err
+	}
+	productIDs = productIDs[:0]
+	for id := range products {
+		productIDs = append(productIDs, id)
+	}
+	if len(productIDs) == 0 {
+		return fmt.Errorf("no products with variants found to order")
 	}
-	defer orderStmt.Close()
 
-	// Prepare order item statement
-	itemStmt, err := db.Prepare(`
-		INSERT INTO order_items (
-			order_id, product_id, quantity, price_per_unit, created_at, updated_at
-		)
-		VALUES ($1, $2, $3, $4, NOW(), NOW())
-		RETURNING id
-	`)
+	// Get the promotions that may discount order items
+	promotions, err := getActivePromotions(db)
 	if err != nil {
-		return fmt.Errorf("failed to prepare order item statement: %w", err)
+		return err
 	}
-	defer itemStmt.Close()
 
-	// Get product prices
-	productPrices := make(map[int]float64)
-	for _, productID := range productIDs {
-		var price float64
-		err := db.QueryRow("SELECT price FROM products WHERE id = $1", productID).Scan(&price)
-		if err != nil {
-			return fmt.Errorf("failed to get product price: %w", err)
-		}
-		productPrices[productID] = price
+	// Get the daily exchange rates from the base currency
+	exchangeRates, err := GetExchangeRates(db, baseCurrency)
+	if err != nil {
+		return err
 	}
 
+	// Prepare the order, shipment and order item statements
+	writer, err := newOrderWriter(db)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
 	// Create a progress bar
 	progressBar, _ := pterm.DefaultProgressbar.
 		WithTotal(count).
@@ -108,15 +187,19 @@ func GenerateOrders(db *sql.DB, count int, maxItemsPerOrder int) error {
 		Start()
 
 	for i := 0; i < count; i++ {
-		userID := userIDs[i]
-
-		// Get address IDs for this user
-		addressID, ok := userAddresses[userID]
+		user, ok := pickOrderingUser(eligibleUsers, userChooser, ordersPerUser)
 		if !ok {
-			// If no address found, skip this order
-			pterm.Warning.Printf("No address found for user %d, skipping order", userID)
-			continue
+			pterm.Warning.Printf("Every user reached their persona's order limit, stopping after %d orders\n", i)
+			break
 		}
+		userID := user.UserID
+		persona := user.Persona
+
+		// Place the order within the user's active period, shaped by the traffic curves
+		createdAt := timeline.SampleBetween(persona.ActiveWindow(timeline, user.SignedUpAt))
+
+		// Get address IDs for this user
+		addressID := userAddresses[userID]
 
 		// Use the same address for shipping and billing (could be randomized)
 		shippingAddressID := addressID
@@ -140,63 +223,368 @@ func GenerateOrders(db *sql.DB, count int, maxItemsPerOrder int) error {
 		var notes sql.NullString
 		if random.Float64() < 0.3 {
 			notes = sql.NullString{
-				String: "Please deliver to the front door.",
+				String: faker.OrderNote(),
 				Valid:  true,
 			}
 		}
 
-		// Generate order items
-		numItems := random.Intn(maxItemsPerOrder) + 1
-		orderItems := make([]struct {
-			ProductID    int
-			Quantity     int
-			PricePerUnit float64
-		}, numItems)
+		// The order is placed in the local currency of the shipping address
+		region := addressRegions[shippingAddressID]
+		fx, err := exchangeRates.Conversion(money.CurrencyForCountry(region.Country, baseCurrency), createdAt)
+		if err != nil {
+			return err
+		}
 
-		totalAmount := 0.0
+		// Generate order items, sized and priced according to the persona
+		numItems := persona.BasketSize(maxItemsPerOrder)
+		lines := make([]OrderLine, 0, numItems)
+		addLine := func(product catalogProduct) {
+			variant := product.Variants[random.Intn(len(product.Variants))]
 
-		// Select random products for this order
-		for j := 0; j < numItems; j++ {
-			productID := productIDs[random.Intn(len(productIDs))]
-			quantity := random.Intn(5) + 1
-			price := productPrices[productID]
-
-			orderItems[j] = struct {
-				ProductID    int
-				Quantity     int
-				PricePerUnit float64
-			}{
-				ProductID:    productID,
-				Quantity:     quantity,
-				PricePerUnit: price,
+			// Sell at the list price of the day, less any promotion running at the time
+			unitPrice := product.PriceAt(createdAt) + variant.PriceDelta
+			var promotionID sql.NullInt64
+			if promotion := bestPromotion(promotions, product.CategoryID, createdAt); promotion != nil {
+				unitPrice -= unitPrice.BasisPoints(promotion.BasisPoints).Round(baseCurrency)
+				promotionID = sql.NullInt64{Int64: int64(promotion.ID), Valid: true}
 			}
 
-			totalAmount += float64(quantity) * price
+			lines = append(lines, OrderLine{
+				ProductID:    product.ID,
+				VariantID:    variant.ID,
+				SellerID:     product.SellerID,
+				PromotionID:  promotionID,
+				Quantity:     minLineQuantity + random.Intn(maxLineQuantity-minLineQuantity+1),
+				PricePerUnit: fx.Apply(unitPrice),
+				BillableKg:   product.BillableKg,
+			})
 		}
 
-		// Insert order
-		var orderID int
-		err := orderStmt.QueryRow(
-			userID, status, totalAmount, shippingAddressID, billingAddressID,
-			paymentMethod, shippingMethod, trackingNumber, notes,
-		).Scan(&orderID)
-
-		if err != nil {
-			return fmt.Errorf("failed to insert order: %w", err)
+		// Select products close to the persona's spend for this order
+		targetPrice := fromUSD(money.FromFloat(persona.AvgSpend/(float64(numItems)*meanLineQuantity)), baseCurrency)
+		inBasket := make(map[int]bool, numItems)
+		for j := 0; j < numItems; j++ {
+			product := pickProductNearPrice(productIDs, products, targetPrice)
+			addLine(product)
+			inBasket[product.ID] = true
 		}
 
-		// Insert order items
-		for _, item := range orderItems {
-			_, err := itemStmt.Exec(
-				orderID, item.ProductID, item.Quantity, item.PricePerUnit,
-			)
-			if err != nil {
-				return fmt.Errorf("failed to insert order item: %w", err)
+		// Planted partners join their anchor in the basket
+		for j := 0; j < numItems; j++ {
+			for _, association := range planted[lines[j].ProductID] {
+				partner, ok := products[association.PartnerProductID]
+				if !ok || inBasket[partner.ID] || random.Float64() >= association.Rate {
+					continue
+				}
+				addLine(partner)
+				inBasket[partner.ID] = true
 			}
 		}
 
+		// Delivered and refunded orders arrived when their last shipment did, unless that
+		// would be in the future
+		shipments, status, deliveredAt := planShipments(lines, createdAt, status, shippingMethod, trackingNumber, timeline.End)
+
+		// Compute totals in exact minor units so they reconcile with the order items
+		totals := PriceOrder(lines, shippingMethod, region, randomCoupon(), baseCurrency, fx)
+
+		_, err = writer.write(orderDraft{
+			UserID:            userID,
+			Status:            status,
+			FX:                fx,
+			Totals:            totals,
+			ShippingAddressID: shippingAddressID,
+			BillingAddressID:  billingAddressID,
+			PaymentMethod:     paymentMethod,
+			ShippingMethod:    shippingMethod,
+			TrackingNumber:    trackingNumber,
+			Notes:             notes,
+			DeliveredAt:       deliveredAt,
+			CreatedAt:         createdAt,
+			Lines:             lines,
+			Shipments:         shipments,
+		})
+		if err != nil {
+			return err
+		}
+
+		ordersPerUser[userID]++
 		progressBar.Increment()
 	}
 
 	return nil
 }
+
+// orderDraft is an order ready to be written along with its items and shipments
+type orderDraft struct {
+	UserID            int
+	SubscriptionID    sql.NullInt64
+	Status            string
+	FX                money.Conversion
+	Totals            OrderTotals
+	ShippingAddressID int
+	BillingAddressID  int
+	PaymentMethod     string
+	ShippingMethod    string
+	TrackingNumber    sql.NullString
+	Notes             sql.NullString
+	DeliveredAt       sql.NullTime
+	CreatedAt         time.Time
+	Lines             []OrderLine
+	Shipments         []plannedShipment
+}
+
+// orderWriter inserts orders along with their shipments and items
+type orderWriter struct {
+	orderStmt    *sql.Stmt
+	shipmentStmt *sql.Stmt
+	itemStmt     *sql.Stmt
+}
+
+// newOrderWriter prepares the statements inserting orders
+func newOrderWriter(db *sql.DB) (*orderWriter, error) {
+	writer := &orderWriter{}
+	var err error
+
+	// Prepare order statement
+	writer.orderStmt, err = db.Prepare(`
+		INSERT INTO orders (
+			user_id, subscription_id, status, currency, exchange_rate, subtotal, discount_amount, discount_code, shipping_cost, tax_amount, total_amount,
+			shipping_address_id, billing_address_id, payment_method, shipping_method, tracking_number, notes,
+			delivered_at, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $19)
+		RETURNING id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare order statement: %w", err)
+	}
+
+	// Prepare shipment statement
+	writer.shipmentStmt, err = db.Prepare(`
+		INSERT INTO shipments (
+			order_id, seller_id, carrier, tracking_number, status, shipped_at, delivered_at, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $6, $8)
+		RETURNING id
+	`)
+	if err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("failed to prepare shipment statement: %w", err)
+	}
+
+	// Prepare order item statement
+	writer.itemStmt, err = db.Prepare(`
+		INSERT INTO order_items (
+			order_id, product_id, variant_id, promotion_id, shipment_id, quantity, price_per_unit, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+		RETURNING id
+	`)
+	if err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("failed to prepare order item statement: %w", err)
+	}
+
+	return writer, nil
+}
+
+// write inserts an order, its shipments and its items, and returns the order ID
+func (w *orderWriter) write(order orderDraft) (int, error) {
+	var discountCode sql.NullString
+	if order.Totals.DiscountCode != "" {
+		discountCode = sql.NullString{String: order.Totals.DiscountCode, Valid: true}
+	}
+
+	// Insert order
+	var orderID int
+	totals := order.Totals
+	err := w.orderStmt.QueryRow(
+		order.UserID, order.SubscriptionID, order.Status, order.FX.To.Code, fmt.Sprintf("%.8f", order.FX.Rate),
+		totals.Subtotal, totals.Discount, discountCode, totals.Shipping, totals.Tax, totals.Total,
+		order.ShippingAddressID, order.BillingAddressID, order.PaymentMethod, order.ShippingMethod, order.TrackingNumber, order.Notes,
+		order.DeliveredAt, order.CreatedAt,
+	).Scan(&orderID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert order: %w", err)
+	}
+
+	// Insert shipments
+	shipmentIDs := make([]sql.NullInt64, len(order.Lines))
+	for _, shipment := range order.Shipments {
+		updatedAt := shipment.ShippedAt
+		if shipment.DeliveredAt.Valid {
+			updatedAt = shipment.DeliveredAt.Time
+		}
+
+		var shipmentID int64
+		err := w.shipmentStmt.QueryRow(
+			orderID, shipment.SellerID, shipment.Carrier, shipment.TrackingNumber, shipment.Status,
+			shipment.ShippedAt, shipment.DeliveredAt, updatedAt,
+		).Scan(&shipmentID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert shipment: %w", err)
+		}
+		for _, line := range shipment.Lines {
+			shipmentIDs[line] = sql.NullInt64{Int64: shipmentID, Valid: true}
+		}
+	}
+
+	// Insert order items
+	for i, line := range order.Lines {
+		_, err := w.itemStmt.Exec(
+			orderID, line.ProductID, line.VariantID, line.PromotionID, shipmentIDs[i], line.Quantity, line.PricePerUnit, order.CreatedAt,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert order item: %w", err)
+		}
+	}
+
+	return orderID, nil
+}
+
+// Close releases the prepared statements
+func (w *orderWriter) Close() {
+	for _, stmt := range []*sql.Stmt{w.orderStmt, w.shipmentStmt, w.itemStmt} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
+
+// expectedDeliveryDays maps each shipping method to its advertised delivery time in days
+var expectedDeliveryDays = map[string]int{
+	"Standard Shipping":      5,
+	"Express Shipping":       2,
+	"Next Day Delivery":      1,
+	"Two-Day Shipping":       2,
+	"Free Shipping":          7,
+	"International Shipping": 12,
+}
+
+// deliveryTime returns when an order placed at createdAt arrived, occasionally later than advertised
+func deliveryTime(createdAt time.Time, shippingMethod string) time.Time {
+	days := expectedDeliveryDays[shippingMethod]
+	switch n := random.Float64(); {
+	case n < 0.05:
+		days += random.Intn(7) + 4 // Badly delayed
+	case n < 0.20:
+		days += random.Intn(3) + 1 // Slightly delayed
+	}
+
+	// Deliveries happen during the day
+	day := createdAt.Truncate(24*time.Hour).AddDate(0, 0, days)
+	return day.Add(time.Duration(8+random.Intn(12))*time.Hour + time.Duration(random.Intn(3600))*time.Second)
+}
+
+// pickOrderingUser picks a user to place an order, skipping users at their persona's order limit
+func pickOrderingUser(users []UserPersona, chooser *weightedChooser, ordersPerUser map[int]int) (UserPersona, bool) {
+	for attempt := 0; attempt < 20; attempt++ {
+		index := chooser.Choose()
+		if index < 0 {
+			break
+		}
+		user := users[index]
+		if user.Persona.MaxOrders == 0 || ordersPerUser[user.UserID] < user.Persona.MaxOrders {
+			return user, true
+		}
+	}
+
+	// Fall back to a linear scan so sparse eligibility doesn't end generation early
+	for _, user := range users {
+		if user.Persona.MaxOrders == 0 || ordersPerUser[user.UserID] < user.Persona.MaxOrders {
+			return user, true
+		}
+	}
+	return UserPersona{}, false
+}
+
+// catalogProduct holds the product details needed to build order lines
+type catalogProduct struct {
+	ID         int
+	CategoryID int
+	SellerID   sql.NullInt64
+	Price      money.Amount // Current list price
+	History    []priceChange
+	BillableKg float64
+	Variants   []catalogVariant
+}
+
+// PriceAt returns the list price of the product at the given time, falling back to the
+// current price when the history doesn't cover it
+func (p catalogProduct) PriceAt(at time.Time) money.Amount {
+	for i := len(p.History) - 1; i >= 0; i-- {
+		if !p.History[i].ValidFrom.After(at) {
+			return p.History[i].Price
+		}
+	}
+	return p.Price
+}
+
+// getCatalogProducts returns the category, seller, prices, billable weight and variants of the given
+// products keyed by ID. Products without variants can't be ordered and are left out.
+func getCatalogProducts(db *sql.DB, productIDs []int) (map[int]catalogProduct, error) {
+	rows, err := db.Query(
+		"SELECT id, category_id, seller_id, price, COALESCE(weight, 0), COALESCE(dimensions, '') FROM products WHERE id = ANY($1)",
+		pq.Array(productIDs),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product prices: %w", err)
+	}
+	defer rows.Close()
+
+	products := make(map[int]catalogProduct)
+	for rows.Next() {
+		var product catalogProduct
+		var weight float64
+		var dimensions string
+		if err := rows.Scan(&product.ID, &product.CategoryID, &product.SellerID, &product.Price, &weight, &dimensions); err != nil {
+			return nil, fmt.Errorf("failed to scan product price: %w", err)
+		}
+		product.BillableKg = BillableWeight(weight, dimensions)
+		products[product.ID] = product
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read product prices: %w", err)
+	}
+
+	variants, err := getCatalogVariants(db, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	histories, err := getPriceHistories(db, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	for id, product := range products {
+		if len(variants[id]) == 0 {
+			delete(products, id)
+			continue
+		}
+		product.Variants = variants[id]
+		product.History = histories[id]
+		products[id] = product
+	}
+
+	return products, nil
+}
+
+// pickProductNearPrice samples a few products and returns the one priced closest to the target
+func pickProductNearPrice(productIDs []int, products map[int]catalogProduct, targetPrice money.Amount) catalogProduct {
+	best := products[productIDs[random.Intn(len(productIDs))]]
+	for i := 0; i < 2; i++ {
+		candidate := products[productIDs[random.Intn(len(productIDs))]]
+		if distance(candidate.Price, targetPrice) < distance(best.Price, targetPrice) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// distance returns the absolute difference between two amounts
+func distance(a, b money.Amount) money.Amount {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"database-test/pkg/timedist"
+)
+
+// Persona describes the purchase behavior of a customer segment
+type Persona struct {
+	Name             string
+	Share            float64 // Fraction of users assigned to this persona
+	OrderFrequency   float64 // Relative likelihood of placing any given order
+	MaxOrders        int     // Upper bound on orders per user, 0 means unlimited
+	MinBasketSize    int
+	MaxBasketSize    int
+	AvgSpend         float64 // Target average order value, in US dollars
+	ReviewPropensity float64 // Relative likelihood of writing any given review
+	ActiveUntil      float64 // Fraction of the time window after which the user stops ordering
+}
+
+// Personas lists the customer segments users are drawn from
+var Personas = []Persona{
+	{
+		Name:             "one_time",
+		Share:            0.30,
+		OrderFrequency:   1.0,
+		MaxOrders:        1,
+		MinBasketSize:    1,
+		MaxBasketSize:    2,
+		AvgSpend:         60,
+		ReviewPropensity: 0.5,
+		ActiveUntil:      1.0,
+	},
+	{
+		Name:             "regular",
+		Share:            0.35,
+		OrderFrequency:   1.0,
+		MinBasketSize:    1,
+		MaxBasketSize:    4,
+		AvgSpend:         150,
+		ReviewPropensity: 1.0,
+		ActiveUntil:      1.0,
+	},
+	{
+		Name:             "whale",
+		Share:            0.05,
+		OrderFrequency:   4.0,
+		MinBasketSize:    3,
+		MaxBasketSize:    8,
+		AvgSpend:         800,
+		ReviewPropensity: 2.0,
+		ActiveUntil:      1.0,
+	},
+	{
+		Name:             "dormant",
+		Share:            0.15,
+		OrderFrequency:   0.4,
+		MinBasketSize:    1,
+		MaxBasketSize:    3,
+		AvgSpend:         80,
+		ReviewPropensity: 0.3,
+		ActiveUntil:      0.6,
+	},
+	{
+		Name:             "churned",
+		Share:            0.15,
+		OrderFrequency:   0.7,
+		MinBasketSize:    1,
+		MaxBasketSize:    3,
+		AvgSpend:         100,
+		ReviewPropensity: 0.3,
+		ActiveUntil:      0.35,
+	},
+}
+
+// defaultPersona is used for users that have no recorded segment
+const defaultPersona = "regular"
+
+// PersonaByName returns the persona with the given name, falling back to the default persona
+func PersonaByName(name string) Persona {
+	for _, persona := range Personas {
+		if persona.Name == name {
+			return persona
+		}
+	}
+	return PersonaByName(defaultPersona)
+}
+
+// RandomPersona returns a persona picked according to the persona shares
+func RandomPersona() Persona {
+	weights := make([]float64, len(Personas))
+	for i, persona := range Personas {
+		weights[i] = persona.Share
+	}
+	return Personas[newWeightedChooser(weights).Choose()]
+}
+
+// BasketSize returns a random number of items for an order, capped at maxItems
+func (p Persona) BasketSize(maxItems int) int {
+	size := p.MinBasketSize + random.Intn(p.MaxBasketSize-p.MinBasketSize+1)
+	if size > maxItems {
+		size = maxItems
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// ActiveWindow returns the part of the time window in which a user who signed up at
+// signedUpAt places orders
+func (p Persona) ActiveWindow(timeline *timedist.Distribution, signedUpAt time.Time) (time.Time, time.Time) {
+	from := signedUpAt
+	if from.Before(timeline.Start) {
+		from = timeline.Start
+	}
+	return from, timeline.Fraction(p.ActiveUntil)
+}
+
+// SignupTime returns a random registration time for a user with this persona. Some users
+// registered before the time window, the rest follow the traffic shape up to the end of
+// the persona's active period.
+func (p Persona) SignupTime(timeline *timedist.Distribution) time.Time {
+	if random.Float64() < 0.4 {
+		before := timeline.End.Sub(timeline.Start)
+		return timeline.Start.Add(-time.Duration(random.Int63n(int64(before)))).Truncate(time.Second)
+	}
+	return timeline.SampleBetween(timeline.Start, timeline.Fraction(p.ActiveUntil*0.8))
+}
+
+// UserPersona pairs a user ID with the persona recorded for that user
+type UserPersona struct {
+	UserID     int
+	Persona    Persona
+	SignedUpAt time.Time
+}
+
+// GetUserPersonas returns every user not deleted along with their persona from the user_segments table
+func GetUserPersonas(db *sql.DB) ([]UserPersona, error) {
+	rows, err := db.Query(`
+		SELECT u.id, COALESCE(s.segment, $1), u.created_at
+		FROM users u
+		LEFT JOIN user_segments s ON s.user_id = u.id
+		WHERE u.deleted_at IS NULL
+		ORDER BY u.id
+	`, defaultPersona)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user personas: %w", err)
+	}
+	defer rows.Close()
+
+	var users []UserPersona
+	for rows.Next() {
+		var userID int
+		var segment string
+		var signedUpAt time.Time
+		if err := rows.Scan(&userID, &segment, &signedUpAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user persona: %w", err)
+		}
+		users = append(users, UserPersona{UserID: userID, Persona: PersonaByName(segment), SignedUpAt: signedUpAt})
+	}
+
+	return users, nil
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"database-test/pkg/money"
+	"database-test/pkg/timedist"
+
+	"github.com/lib/pq"
+	"github.com/pterm/pterm"
+)
+
+// ProductPrice represents the list price of a product during a period of time
+type ProductPrice struct {
+	ID        int
+	ProductID int
+	Price     money.Amount
+	Currency  string
+	ValidFrom time.Time
+	ValidTo   sql.NullTime // Null for the current price
+	CreatedAt time.Time
+}
+
+// GeneratePriceHistory generates the list price history over the time window of every product
+// without one. The history ends at the product's current price, and walks back through
+// occasional price changes, mostly increases with the odd price cut.
+func GeneratePriceHistory(db *sql.DB, timeline *timedist.Distribution) error {
+	rows, err := db.Query(`
+		SELECT p.id, p.price, p.currency
+		FROM products p
+		WHERE NOT EXISTS (SELECT 1 FROM product_price_history h WHERE h.product_id = p.id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to get products without price history: %w", err)
+	}
+
+	var products []ProductPrice
+	for rows.Next() {
+		var product ProductPrice
+		if err := rows.Scan(&product.ProductID, &product.Price, &product.Currency); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan product price: %w", err)
+		}
+		products = append(products, product)
+	}
+	rows.Close()
+
+	stmt, err := db.Prepare(`
+		INSERT INTO product_price_history (product_id, price, currency, valid_from, valid_to)
+		VALUES ($1, $2, $3, $4, $5)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(len(products)).
+		WithTitle(fmt.Sprintf("Generating price history for %d products...", len(products))).
+		Start()
+
+	for _, product := range products {
+		currency, err := money.LookupCurrency(product.Currency)
+		if err != nil {
+			return err
+		}
+
+		price := product.Price
+		var validTo sql.NullTime
+		end := timeline.End
+		for {
+			// Prices hold for one to six months
+			validFrom := end.Add(-time.Duration(30+random.Intn(150)) * 24 * time.Hour)
+			if !validFrom.After(timeline.Start) {
+				validFrom = timeline.Start
+			}
+
+			if _, err := stmt.Exec(product.ProductID, price, product.Currency, validFrom, validTo); err != nil {
+				return fmt.Errorf("failed to insert price history: %w", err)
+			}
+			if !validFrom.After(timeline.Start) {
+				break
+			}
+
+			price = previousPrice(price, currency)
+			validTo = sql.NullTime{Time: validFrom, Valid: true}
+			end = validFrom
+		}
+
+		progressBar.Increment()
+	}
+
+	return nil
+}
+
+// previousPrice returns the list price a product had before changing to the given price.
+// Most changes are increases of 2-15%, the rest are cuts of 5-20%.
+func previousPrice(price money.Amount, currency money.Currency) money.Amount {
+	var change float64
+	if random.Float64() < 0.75 {
+		change = -(0.02 + random.Float64()*0.13)
+	} else {
+		change = 0.05 + random.Float64()*0.15
+	}
+
+	previous := money.FromFloat(price.Float() * (1 + change)).Round(currency)
+	if minimum := money.FromFloat(1).Round(currency); previous < minimum {
+		return minimum
+	}
+	return previous
+}
+
+// priceChange is a list price taking effect at a point in time
+type priceChange struct {
+	ValidFrom time.Time
+	Price     money.Amount
+}
+
+// getPriceHistories returns the price changes of the given products in chronological order,
+// keyed by product ID
+func getPriceHistories(db *sql.DB, productIDs []int) (map[int][]priceChange, error) {
+	rows, err := db.Query(
+		"SELECT product_id, valid_from, price FROM product_price_history WHERE product_id = ANY($1)",
+		pq.Array(productIDs),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get price history: %w", err)
+	}
+	defer rows.Close()
+
+	histories := make(map[int][]priceChange)
+	for rows.Next() {
+		var productID int
+		var change priceChange
+		if err := rows.Scan(&productID, &change.ValidFrom, &change.Price); err != nil {
+			return nil, fmt.Errorf("failed to scan price history: %w", err)
+		}
+		histories[productID] = append(histories[productID], change)
+	}
+
+	for _, history := range histories {
+		sort.Slice(history, func(i, j int) bool { return history[i].ValidFrom.Before(history[j].ValidFrom) })
+	}
+	return histories, nil
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"database/sql"
+	"math"
+	"strconv"
+	"strings"
+
+	"database-test/pkg/money"
+)
+
+// salesTaxBasisPoints holds the combined average sales tax rate of each US state
+var salesTaxBasisPoints = map[string]int64{
+	"Alabama": 924, "Alaska": 182, "Arizona": 840, "Arkansas": 946, "California": 882,
+	"Colorado": 778, "Connecticut": 635, "Delaware": 0, "Florida": 702, "Georgia": 738,
+	"Hawaii": 444, "Idaho": 603, "Illinois": 886, "Indiana": 700, "Iowa": 694,
+	"Kansas": 869, "Kentucky": 600, "Louisiana": 955, "Maine": 550, "Maryland": 600,
+	"Massachusetts": 625, "Michigan": 600, "Minnesota": 749, "Mississippi": 707, "Missouri": 833,
+	"Montana": 0, "Nebraska": 697, "Nevada": 823, "New Hampshire": 0, "New Jersey": 660,
+	"New Mexico": 772, "New York": 852, "North Carolina": 700, "North Dakota": 696, "Ohio": 724,
+	"Oklahoma": 899, "Oregon": 0, "Pennsylvania": 634, "Rhode Island": 700, "South Carolina": 743,
+	"South Dakota": 611, "Tennessee": 955, "Texas": 820, "Utah": 719, "Vermont": 624,
+	"Virginia": 577, "Washington": 938, "West Virginia": 652, "Wisconsin": 570, "Wyoming": 544,
+}
+
+// vatBasisPoints holds the standard VAT or GST rate of each non-US country
+var vatBasisPoints = map[string]int64{
+	"CA": 500, "MX": 1600, "UK": 2000, "FR": 2000, "DE": 1900, "IT": 2200, "ES": 2100,
+	"JP": 1000, "CN": 1300, "AU": 1000, "NZ": 1500, "BR": 1700, "AR": 2100, "CL": 1900,
+	"RU": 2000, "IN": 1800, "ZA": 1500, "NG": 750, "EG": 1400,
+}
+
+// TaxBasisPoints returns the tax rate applied to orders shipped to an address region
+func TaxBasisPoints(region AddressRegion) int64 {
+	if region.Country == "US" {
+		return salesTaxBasisPoints[region.State]
+	}
+	return vatBasisPoints[region.Country]
+}
+
+// shippingRate is the cost of a shipping method, by billable weight
+type shippingRate struct {
+	Base      money.Amount // Flat fee per order
+	PerHalfKg money.Amount // Fee per started half kilogram of billable weight
+}
+
+// shippingRates holds the rate of each shipping method in US dollars
+var shippingRates = map[string]shippingRate{
+	"Standard Shipping":      {Base: 499, PerHalfKg: 50},
+	"Express Shipping":       {Base: 999, PerHalfKg: 120},
+	"Next Day Delivery":      {Base: 1999, PerHalfKg: 200},
+	"Two-Day Shipping":       {Base: 1299, PerHalfKg: 150},
+	"Free Shipping":          {Base: 0, PerHalfKg: 0},
+	"International Shipping": {Base: 2499, PerHalfKg: 400},
+}
+
+// volumetricDivisor converts a volume in cubic centimeters to a dimensional weight in kilograms
+const volumetricDivisor = 5000
+
+// ShippingCost returns the cost in US dollars of shipping items with the given total
+// billable weight
+func ShippingCost(method string, billableKg float64) money.Amount {
+	rate := shippingRates[method]
+	halfKgs := int(math.Ceil(billableKg * 2))
+	return rate.Base + rate.PerHalfKg.Mul(halfKgs)
+}
+
+// BillableWeight returns the larger of a product's actual and dimensional weight in kilograms
+func BillableWeight(weightKg float64, dimensions string) float64 {
+	if volume, ok := parseVolume(dimensions); ok {
+		if dimensional := volume / volumetricDivisor; dimensional > weightKg {
+			return dimensional
+		}
+	}
+	return weightKg
+}
+
+// parseVolume parses dimensions formatted as "W x H x D cm" into cubic centimeters
+func parseVolume(dimensions string) (float64, bool) {
+	parts := strings.Split(strings.TrimSuffix(strings.TrimSpace(dimensions), " cm"), " x ")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	volume := 1.0
+	for _, part := range parts {
+		size, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return 0, false
+		}
+		volume *= size
+	}
+	return volume, true
+}
+
+// Coupon is a discount code applied to a whole order
+type Coupon struct {
+	Code        string
+	BasisPoints int64        // Percentage off the subtotal, in basis points
+	AmountOff   money.Amount // Fixed amount off the subtotal
+	MinSubtotal money.Amount // Minimum subtotal for the coupon to apply
+}
+
+// coupons lists the discount codes customers can use
+var coupons = []Coupon{
+	{Code: "WELCOME10", BasisPoints: 1000},
+	{Code: "SAVE15", BasisPoints: 1500, MinSubtotal: 10000},
+	{Code: "VIP20", BasisPoints: 2000, MinSubtotal: 25000},
+	{Code: "TAKE5", AmountOff: 500, MinSubtotal: 3000},
+	{Code: "TAKE25", AmountOff: 2500, MinSubtotal: 15000},
+}
+
+// Discount returns the discount the coupon gives on a subtotal in the currency usd converts
+// US dollars into, never more than the subtotal. Fixed amounts are defined in US dollars.
+func (c Coupon) Discount(subtotal money.Amount, usd money.Conversion) money.Amount {
+	if subtotal < usd.Apply(c.MinSubtotal) {
+		return 0
+	}
+	discount := usd.Apply(c.AmountOff) + subtotal.BasisPoints(c.BasisPoints).Round(usd.To)
+	if discount > subtotal {
+		return subtotal
+	}
+	return discount
+}
+
+// OrderLine is a product in an order, priced per unit in the order's currency
+type OrderLine struct {
+	ProductID    int
+	VariantID    int
+	SellerID     sql.NullInt64
+	PromotionID  sql.NullInt64
+	Quantity     int
+	PricePerUnit money.Amount
+	BillableKg   float64 // Billable weight of a single unit
+}
+
+// OrderTotals holds the amounts making up an order's total
+type OrderTotals struct {
+	Subtotal     money.Amount
+	Discount     money.Amount
+	DiscountCode string
+	Shipping     money.Amount
+	Tax          money.Amount
+	Total        money.Amount
+}
+
+// PriceOrder computes the totals of an order shipped to a region, in the currency fx
+// converts the base currency into. The subtotal is the exact sum of the order lines, tax is
+// charged on the discounted subtotal, and every amount is rounded to the currency's minor
+// units.
+func PriceOrder(lines []OrderLine, shippingMethod string, region AddressRegion, coupon *Coupon, base money.Currency, fx money.Conversion) OrderTotals {
+	var totals OrderTotals
+	usd := usdConversion(base, fx)
+	billableKg := 0.0
+	for _, line := range lines {
+		totals.Subtotal += line.PricePerUnit.Mul(line.Quantity)
+		billableKg += line.BillableKg * float64(line.Quantity)
+	}
+
+	if coupon != nil {
+		totals.Discount = coupon.Discount(totals.Subtotal, usd)
+		if totals.Discount > 0 {
+			totals.DiscountCode = coupon.Code
+		}
+	}
+
+	totals.Shipping = usd.Apply(ShippingCost(shippingMethod, billableKg))
+	totals.Tax = (totals.Subtotal - totals.Discount).BasisPoints(TaxBasisPoints(region)).Round(fx.To)
+	totals.Total = totals.Subtotal - totals.Discount + totals.Shipping + totals.Tax
+	return totals
+}
+
+// randomCoupon returns a coupon for about 15% of orders, nil otherwise
+func randomCoupon() *Coupon {
+	if random.Float64() >= 0.15 {
+		return nil
+	}
+	return &coupons[random.Intn(len(coupons))]
+}
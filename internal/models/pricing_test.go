@@ -0,0 +1,124 @@
+package models
+
+import (
+	"testing"
+
+	"database-test/pkg/money"
+)
+
+func TestPriceOrder(t *testing.T) {
+	usd, jpy := money.Currencies["USD"], money.Currencies["JPY"]
+	lines := []OrderLine{
+		{ProductID: 1, Quantity: 2, PricePerUnit: 1999, BillableKg: 0.4},
+		{ProductID: 2, Quantity: 1, PricePerUnit: 8550, BillableKg: 1.3},
+	}
+	yenLines := []OrderLine{
+		{ProductID: 1, Quantity: 2, PricePerUnit: 300300, BillableKg: 0.4},
+		{ProductID: 2, Quantity: 1, PricePerUnit: 1284200, BillableKg: 1.3},
+	}
+
+	tests := []struct {
+		name   string
+		lines  []OrderLine
+		method string
+		region AddressRegion
+		coupon *Coupon
+		fx     money.Conversion
+		want   OrderTotals
+	}{
+		{
+			name:   "sales tax on the subtotal",
+			method: "Standard Shipping",
+			region: AddressRegion{State: "California", Country: "US"},
+			fx:     money.Identity(usd),
+			want:   OrderTotals{Subtotal: 12548, Shipping: 749, Tax: 1107, Total: 14404},
+		},
+		{
+			name:   "tax on the discounted subtotal",
+			method: "Standard Shipping",
+			region: AddressRegion{State: "California", Country: "US"},
+			coupon: &coupons[1],
+			fx:     money.Identity(usd),
+			want:   OrderTotals{Subtotal: 12548, Discount: 1882, DiscountCode: "SAVE15", Shipping: 749, Tax: 941, Total: 12356},
+		},
+		{
+			name:   "coupon below its minimum subtotal",
+			method: "Free Shipping",
+			region: AddressRegion{State: "Oregon", Country: "US"},
+			coupon: &coupons[2],
+			fx:     money.Identity(usd),
+			want:   OrderTotals{Subtotal: 12548, Total: 12548},
+		},
+		{
+			name:   "dollar amounts converted and rounded to whole yen",
+			lines:  yenLines,
+			method: "Express Shipping",
+			region: AddressRegion{Country: "JP"},
+			coupon: &coupons[3],
+			fx:     money.Conversion{Rate: 150.2, To: jpy},
+			want:   OrderTotals{Subtotal: 1884800, Discount: 75100, DiscountCode: "TAKE5", Shipping: 240200, Tax: 181000, Total: 2230900},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderLines := tt.lines
+			if orderLines == nil {
+				orderLines = lines
+			}
+			got := PriceOrder(orderLines, tt.method, tt.region, tt.coupon, usd, tt.fx)
+			if got != tt.want {
+				t.Errorf("PriceOrder() = %+v, want %+v", got, tt.want)
+			}
+			checkTotals(t, got, tt.fx.To)
+		})
+	}
+}
+
+// TestPriceOrderTotals checks the totals add up the way the orders table requires, across
+// currencies, regions, shipping methods and coupons
+func TestPriceOrderTotals(t *testing.T) {
+	regions := []AddressRegion{
+		{State: "New York", Country: "US"}, {State: "Oregon", Country: "US"},
+		{Country: "UK"}, {Country: "JP"}, {Country: "NG"},
+	}
+	for _, base := range []string{"USD", "EUR", "JPY"} {
+		for _, to := range []string{"USD", "GBP", "JPY", "CLP", "NGN"} {
+			baseCurrency, toCurrency := money.Currencies[base], money.Currencies[to]
+			fx := money.Conversion{Rate: referenceRates[to] / referenceRates[base], To: toCurrency}
+			for i := range coupons {
+				for method := range shippingRates {
+					for _, region := range regions {
+						lines := []OrderLine{
+							{Quantity: 1 + i, PricePerUnit: fx.Apply(money.Amount(1234 * (i + 1))), BillableKg: 0.75},
+							{Quantity: 3, PricePerUnit: fx.Apply(4999), BillableKg: 2.1},
+						}
+						totals := PriceOrder(lines, method, region, &coupons[i], baseCurrency, fx)
+						checkTotals(t, totals, toCurrency)
+					}
+				}
+			}
+		}
+	}
+}
+
+// checkTotals fails the test unless the totals satisfy the orders table's check and every
+// amount is in whole minor units of the currency
+func checkTotals(t *testing.T, totals OrderTotals, currency money.Currency) {
+	t.Helper()
+	if totals.Total != totals.Subtotal-totals.Discount+totals.Shipping+totals.Tax {
+		t.Errorf("total %v != subtotal %v - discount %v + shipping %v + tax %v",
+			totals.Total, totals.Subtotal, totals.Discount, totals.Shipping, totals.Tax)
+	}
+	if totals.Discount < 0 || totals.Discount > totals.Subtotal {
+		t.Errorf("discount %v outside 0..subtotal %v", totals.Discount, totals.Subtotal)
+	}
+	if totals.Discount == 0 && totals.DiscountCode != "" {
+		t.Errorf("discount code %q recorded without a discount", totals.DiscountCode)
+	}
+	for _, amount := range []money.Amount{totals.Discount, totals.Shipping, totals.Tax} {
+		if amount.Round(currency) != amount {
+			t.Errorf("amount %v is not in whole %s minor units", amount, currency.Code)
+		}
+	}
+}
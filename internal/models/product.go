@@ -2,10 +2,12 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"database-test/pkg/faker"
+	"database-test/pkg/money"
 
 	"github.com/pterm/pterm"
 )
@@ -17,12 +19,16 @@ type Product struct {
 	ID            int
 	Name          string
 	Description   string
-	Price         float64
+	Price         money.Amount
+	Currency      string
 	StockQuantity int
 	CategoryID    int
+	SellerID      sql.NullInt64
+	BrandID       sql.NullInt64
 	SKU           string
 	Weight        sql.NullFloat64
 	Dimensions    sql.NullString
+	Attributes    map[string]interface{}
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 }
@@ -37,27 +43,39 @@ type ProductImage struct {
 	UpdatedAt time.Time
 }
 
-// GenerateProducts generates n fake products and inserts them into the database
-func GenerateProducts(db *sql.DB, count int, imagesPerProduct int) error {
-	// Get random category IDs
-	categoryIDs, err := GetRandomCategoryIDs(db, count)
+// GenerateProducts generates n fake products priced in the base currency and inserts them into
+// the database. Each product gets a category-specific spec sheet and up to maxVariants variants,
+// and its stock is the total stock of its variants. Products are spread over the categories
+// following the placement. When there are sellers, each product is listed by one of them,
+// the kth largest seller listing 1/k^sellerSkew as many products as the largest, under
+// one of the brands the seller carries.
+func GenerateProducts(db *sql.DB, count int, imagesPerProduct int, maxVariants int, baseCurrency money.Currency, placement ProductPlacement, sellerSkew float64) error {
+	// Place products in categories
+	categoryIDs, err := PlaceProducts(db, count, placement)
 	if err != nil {
 		return err
 	}
 
-	// If we don't have enough categories, reuse them
-	for len(categoryIDs) < count {
-		categoryIDs = append(categoryIDs, categoryIDs...)
+	// Get category paths: descriptions mention the category itself, while spec sheets and
+	// variants follow the top-level category
+	categoryPaths, err := GetCategoryPaths(db, categoryIDs)
+	if err != nil {
+		return err
+	}
+
+	// Get the sellers listing products and the brands they carry
+	sellers, err := newSellerAssigner(db, sellerSkew)
+	if err != nil {
+		return err
 	}
-	categoryIDs = categoryIDs[:count]
 
 	// Prepare product statement
 	productStmt, err := db.Prepare(`
 		INSERT INTO products (
-			name, description, price, stock_quantity, category_id, 
-			sku, weight, dimensions, created_at, updated_at
+			name, description, price, currency, stock_quantity, category_id, seller_id, brand_id,
+			sku, weight, dimensions, attributes, created_at, updated_at
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW(), NOW())
 		RETURNING id
 	`)
 	if err != nil {
@@ -65,6 +83,18 @@ func GenerateProducts(db *sql.DB, count int, imagesPerProduct int) error {
 	}
 	defer productStmt.Close()
 
+	// Prepare variant statement
+	variantStmt, err := db.Prepare(`
+		INSERT INTO product_variants (
+			product_id, sku, name, options, price_delta, stock_quantity, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare variant statement: %w", err)
+	}
+	defer variantStmt.Close()
+
 	// Prepare image statement
 	imageStmt, err := db.Prepare(`
 		INSERT INTO product_images (
@@ -86,13 +116,38 @@ func GenerateProducts(db *sql.DB, count int, imagesPerProduct int) error {
 
 	for i := 0; i < count; i++ {
 		// Generate product data
-		name := faker.ProductName()
-		description := faker.ProductDescription()
-		price := faker.Price(9.99, 999.99)
-		stockQuantity := random.Intn(1000) + 1
 		categoryID := categoryIDs[i]
+		categoryPath := categoryPaths[categoryID]
+		categoryName, department := "", ""
+		if len(categoryPath) > 0 {
+			categoryName, department = categoryPath[len(categoryPath)-1], categoryPath[0]
+		}
+		name := faker.ProductName()
+		description := faker.ProductDescription(name, categoryName)
+		// Price ranges are in US dollars, converted into the base currency
+		price := fromUSD(money.FromFloat(faker.Price(9.99, 999.99)), baseCurrency)
 		sku := faker.SKU()
 
+		// The spec sheet names the product's brand when it has one
+		sellerID, brand := sellers.pick()
+		var brandID sql.NullInt64
+		specs := faker.ProductAttributes(department)
+		if brand != nil {
+			brandID = sql.NullInt64{Int64: int64(brand.ID), Valid: true}
+			specs["brand"] = brand.Name
+		}
+		attributes, err := json.Marshal(specs)
+		if err != nil {
+			return fmt.Errorf("failed to encode product attributes: %w", err)
+		}
+
+		// Stock is held per variant
+		variants := randomVariants(department, maxVariants, baseCurrency)
+		stockQuantity := 0
+		for _, variant := range variants {
+			stockQuantity += variant.StockQuantity
+		}
+
 		// 80% chance of having weight
 		var weight sql.NullFloat64
 		if random.Float64() < 0.8 {
@@ -113,15 +168,19 @@ func GenerateProducts(db *sql.DB, count int, imagesPerProduct int) error {
 
 		// Insert product
 		var productID int
-		err := productStmt.QueryRow(
-			name, description, price, stockQuantity, categoryID,
-			sku, weight, dimensions,
+		err = productStmt.QueryRow(
+			name, description, price, baseCurrency.Code, stockQuantity, categoryID, sellerID, brandID,
+			sku, weight, dimensions, string(attributes),
 		).Scan(&productID)
 
 		if err != nil {
 			return fmt.Errorf("failed to insert product: %w", err)
 		}
 
+		if err := insertVariants(variantStmt, productID, sku, variants); err != nil {
+			return err
+		}
+
 		// Generate images for this product
 		for j := 0; j < imagesPerProduct; j++ {
 			imageURL := faker.ImageURL(productID)
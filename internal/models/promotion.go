@@ -0,0 +1,152 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"database-test/pkg/faker"
+	"database-test/pkg/timedist"
+
+	"github.com/lib/pq"
+	"github.com/pterm/pterm"
+)
+
+// Promotion represents a time-bound discount on a category and its subcategories, or on the
+// whole catalog when it has no category
+type Promotion struct {
+	ID              int
+	Name            string
+	DiscountPercent float64
+	CategoryID      sql.NullInt64
+	StartsAt        time.Time
+	EndsAt          time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// GeneratePromotions generates n fake promotions over the time window and inserts them into
+// the database. Promotions start more often when traffic is high.
+func GeneratePromotions(db *sql.DB, count int, timeline *timedist.Distribution) error {
+	categoryIDs, err := GetRandomCategoryIDs(db, count)
+	if err != nil {
+		return err
+	}
+	categoryPaths, err := GetCategoryPaths(db, categoryIDs)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := db.Prepare(`
+		INSERT INTO promotions (name, discount_percent, category_id, starts_at, ends_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(count).
+		WithTitle(fmt.Sprintf("Generating %d promotions...", count)).
+		Start()
+
+	for i := 0; i < count; i++ {
+		// 30% of promotions are sitewide, and they're shallower than category promotions
+		var categoryID sql.NullInt64
+		categoryName := ""
+		discounts := []float64{10, 15, 20}
+		if len(categoryIDs) > 0 && random.Float64() >= 0.3 {
+			id := categoryIDs[random.Intn(len(categoryIDs))]
+			categoryID = sql.NullInt64{Int64: int64(id), Valid: true}
+			if path := categoryPaths[id]; len(path) > 0 {
+				categoryName = path[len(path)-1]
+			}
+			discounts = []float64{10, 15, 20, 25, 30, 40}
+		}
+
+		startsAt := timeline.Sample().Truncate(24 * time.Hour)
+		durations := []int{1, 2, 3, 7, 10, 14}
+		endsAt := startsAt.AddDate(0, 0, durations[random.Intn(len(durations))])
+
+		_, err := stmt.Exec(
+			faker.PromotionName(categoryName), discounts[random.Intn(len(discounts))],
+			categoryID, startsAt, endsAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert promotion: %w", err)
+		}
+		progressBar.Increment()
+	}
+
+	return nil
+}
+
+// activePromotion holds the promotion details needed to price order lines
+type activePromotion struct {
+	ID          int
+	BasisPoints int64
+	Categories  map[int]bool // The promoted category and its subcategories, empty when sitewide
+	StartsAt    time.Time
+	EndsAt      time.Time
+}
+
+// appliesTo reports whether the promotion discounts a product in the category at the given time
+func (p activePromotion) appliesTo(categoryID int, at time.Time) bool {
+	if at.Before(p.StartsAt) || !at.Before(p.EndsAt) {
+		return false
+	}
+	return len(p.Categories) == 0 || p.Categories[categoryID]
+}
+
+// bestPromotion returns the deepest promotion discounting a product in the category at the
+// given time, or nil if there is none
+func bestPromotion(promotions []activePromotion, categoryID int, at time.Time) *activePromotion {
+	var best *activePromotion
+	for i := range promotions {
+		if promotions[i].appliesTo(categoryID, at) && (best == nil || promotions[i].BasisPoints > best.BasisPoints) {
+			best = &promotions[i]
+		}
+	}
+	return best
+}
+
+// getActivePromotions returns every promotion along with the categories it covers
+func getActivePromotions(db *sql.DB) ([]activePromotion, error) {
+	rows, err := db.Query(`
+		WITH RECURSIVE scope AS (
+			SELECT id AS promotion_id, category_id FROM promotions WHERE category_id IS NOT NULL
+			UNION ALL
+			SELECT s.promotion_id, c.id FROM scope s JOIN categories c ON c.parent_id = s.category_id
+		)
+		SELECT p.id, p.discount_percent, p.starts_at, p.ends_at,
+			COALESCE(array_agg(s.category_id) FILTER (WHERE s.category_id IS NOT NULL), '{}')
+		FROM promotions p
+		LEFT JOIN scope s ON s.promotion_id = p.id
+		GROUP BY p.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get promotions: %w", err)
+	}
+	defer rows.Close()
+
+	var promotions []activePromotion
+	for rows.Next() {
+		var promotion activePromotion
+		var percent float64
+		var categoryIDs []int64
+		if err := rows.Scan(&promotion.ID, &percent, &promotion.StartsAt, &promotion.EndsAt, pq.Array(&categoryIDs)); err != nil {
+			return nil, fmt.Errorf("failed to scan promotion: %w", err)
+		}
+		promotion.BasisPoints = int64(math.Round(percent * 100))
+		promotion.Categories = make(map[int]bool, len(categoryIDs))
+		for _, id := range categoryIDs {
+			promotion.Categories[int(id)] = true
+		}
+		promotions = append(promotions, promotion)
+	}
+
+	return promotions, nil
+}
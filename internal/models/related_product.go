@@ -0,0 +1,194 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// plantedAssociationRate is how often an order with the anchor of a planted association
+// also gets its partner
+const plantedAssociationRate = 0.6
+
+// plantedCategoryPairs lists the categories planted associations are drawn from: products
+// of the first category are bought along with a product of the second
+var plantedCategoryPairs = [][2]string{
+	{"Laptops", "Chargers"},
+	{"Laptops", "Mice"},
+	{"Smartphones", "Cases"},
+	{"Smartphones", "Screen Protectors"},
+	{"Mirrorless Cameras", "Lenses"},
+	{"Televisions", "Soundbars"},
+	{"Pots & Pans", "Utensils"},
+	{"Sheets", "Pillows"},
+	{"Coffee Makers", "Utensils"},
+	{"Tents", "Sleeping Bags"},
+}
+
+// PlantedAssociation is a pair of products deliberately bought together in generated
+// orders, the ground truth related products are expected to find
+type PlantedAssociation struct {
+	ID               int
+	AnchorProductID  int
+	PartnerProductID int
+	Rate             float64
+	CreatedAt        time.Time
+}
+
+// RelatedProduct is a product frequently bought together with another
+type RelatedProduct struct {
+	ID               int
+	ProductID        int
+	RelatedProductID int
+	CoPurchaseCount  int
+	Confidence       float64
+	Lift             float64
+	Rank             int
+	Planted          bool
+	ComputedAt       time.Time
+}
+
+// GeneratePlantedAssociations picks n anchor products and a partner for each and inserts
+// them into the database, for GenerateOrders to buy together. Pairs come from categories
+// naturally bought together, such as laptops and chargers, falling back to random products
+// when the catalog has no such categories.
+func GeneratePlantedAssociations(db *sql.DB, count int) error {
+	stmt, err := db.Prepare(`
+		INSERT INTO planted_associations (anchor_product_id, partner_product_id, rate)
+		VALUES ($1, $2, $3)
+		ON CONFLICT ON CONSTRAINT planted_associations_anchor_product_id_partner_product_id_key DO NOTHING
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	pairs := random.Perm(len(plantedCategoryPairs))
+	for i := 0; i < count; i++ {
+		var categories [2]string
+		if i < len(pairs) {
+			categories = plantedCategoryPairs[pairs[i]]
+		}
+
+		anchorID, err := randomProductInCategory(db, categories[0], 0)
+		if err != nil {
+			return err
+		}
+		partnerID, err := randomProductInCategory(db, categories[1], anchorID)
+		if err != nil {
+			return err
+		}
+		if anchorID == 0 || partnerID == 0 {
+			return fmt.Errorf("not enough products to plant associations")
+		}
+
+		if _, err := stmt.Exec(anchorID, partnerID, plantedAssociationRate); err != nil {
+			return fmt.Errorf("failed to insert planted association: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// randomProductInCategory returns a random product with variants, other than exclude, in a
+// category whose name starts with the given one, or in any category if none has a product.
+// It returns 0 when there is no product at all.
+func randomProductInCategory(db *sql.DB, category string, exclude int) (int, error) {
+	var id int
+	err := db.QueryRow(`
+		SELECT p.id
+		FROM products p
+		JOIN categories c ON c.id = p.category_id
+		WHERE p.id <> $2 AND EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = p.id)
+		ORDER BY $1 <> '' AND c.name LIKE $1 || '%' DESC, RANDOM()
+		LIMIT 1
+	`, category, exclude).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get product in category: %w", err)
+	}
+	return id, nil
+}
+
+// getPlantedAssociations returns the partner of every planted anchor product
+func getPlantedAssociations(db *sql.DB) (map[int][]PlantedAssociation, error) {
+	rows, err := db.Query("SELECT id, anchor_product_id, partner_product_id, rate FROM planted_associations ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get planted associations: %w", err)
+	}
+	defer rows.Close()
+
+	associations := make(map[int][]PlantedAssociation)
+	for rows.Next() {
+		var association PlantedAssociation
+		if err := rows.Scan(&association.ID, &association.AnchorProductID, &association.PartnerProductID, &association.Rate); err != nil {
+			return nil, fmt.Errorf("failed to scan planted association: %w", err)
+		}
+		associations[association.AnchorProductID] = append(associations[association.AnchorProductID], association)
+	}
+
+	return associations, nil
+}
+
+// GenerateRelatedProducts computes the products frequently bought together from the
+// co-occurrence of products in orders and replaces the related_products table with them.
+// Each product keeps its topN related products bought together in at least minOrders
+// orders, ranked by how many orders they share. Confidence is the share of the product's
+// orders that also have the related product, and lift compares that to the related
+// product's share of all orders. Pairs planted by GeneratePlantedAssociations are flagged.
+func GenerateRelatedProducts(db *sql.DB, minOrders, topN int) error {
+	if _, err := db.Exec("DELETE FROM related_products"); err != nil {
+		return fmt.Errorf("failed to clear related products: %w", err)
+	}
+
+	_, err := db.Exec(`
+		WITH baskets AS (
+			SELECT DISTINCT order_id, product_id FROM order_items
+		),
+		product_orders AS (
+			SELECT product_id, COUNT(*) AS orders FROM baskets GROUP BY product_id
+		),
+		total AS (
+			SELECT COUNT(DISTINCT order_id) AS orders FROM baskets
+		),
+		pairs AS (
+			SELECT a.product_id, b.product_id AS related_product_id, COUNT(*) AS co_purchases
+			FROM baskets a
+			JOIN baskets b ON b.order_id = a.order_id AND b.product_id <> a.product_id
+			GROUP BY a.product_id, b.product_id
+			HAVING COUNT(*) >= $1
+		),
+		ranked AS (
+			SELECT p.product_id, p.related_product_id, p.co_purchases,
+				p.co_purchases::NUMERIC / pa.orders AS confidence,
+				p.co_purchases::NUMERIC * t.orders / (pa.orders * pb.orders) AS lift,
+				ROW_NUMBER() OVER (
+					PARTITION BY p.product_id
+					ORDER BY p.co_purchases DESC, p.co_purchases::NUMERIC / pb.orders DESC, p.related_product_id
+				) AS rank
+			FROM pairs p
+			JOIN product_orders pa ON pa.product_id = p.product_id
+			JOIN product_orders pb ON pb.product_id = p.related_product_id
+			CROSS JOIN total t
+		)
+		INSERT INTO related_products (
+			product_id, related_product_id, co_purchase_count, confidence, lift, rank, planted
+		)
+		SELECT r.product_id, r.related_product_id, r.co_purchases, r.confidence, r.lift, r.rank,
+			EXISTS (
+				SELECT 1 FROM planted_associations pl
+				WHERE (pl.anchor_product_id, pl.partner_product_id) IN (
+					(r.product_id, r.related_product_id), (r.related_product_id, r.product_id)
+				)
+			)
+		FROM ranked r
+		WHERE r.rank <= $2
+	`, minOrders, topN)
+	if err != nil {
+		return fmt.Errorf("failed to compute related products: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,303 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"database-test/pkg/faker"
+	"database-test/pkg/money"
+	"database-test/pkg/timedist"
+
+	"github.com/lib/pq"
+	"github.com/pterm/pterm"
+)
+
+// Return represents a customer's request to send back items of a delivered order
+type Return struct {
+	ID          int
+	OrderID     int
+	Status      string
+	Reason      string
+	RequestedAt time.Time
+	ReceivedAt  sql.NullTime
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// ReturnItem represents a quantity of an order item sent back in a return
+type ReturnItem struct {
+	ID          int
+	ReturnID    int
+	OrderItemID int
+	Quantity    int
+	Condition   string
+	CreatedAt   time.Time
+}
+
+// Refund represents money paid back to a customer, in the currency of the order
+type Refund struct {
+	ID          int
+	OrderID     int
+	ReturnID    sql.NullInt64
+	Amount      money.Amount
+	Currency    string
+	Method      string
+	ProcessedAt time.Time
+	CreatedAt   time.Time
+}
+
+// returnableOrder holds the order details needed to generate a return
+type returnableOrder struct {
+	ID            int
+	Status        string
+	Currency      string
+	PaymentMethod string
+	Subtotal      money.Amount
+	ShippingCost  money.Amount
+	TotalAmount   money.Amount
+	DeliveredAt   time.Time
+	Items         []returnableItem
+}
+
+// returnableItem holds the order item details needed to generate a return
+type returnableItem struct {
+	ID           int
+	Quantity     int
+	PricePerUnit money.Amount
+}
+
+// GenerateReturns generates returns and refunds for delivered orders without one. Refunded
+// orders are returned in full and refunded their total, while partialReturnRate of delivered
+// orders get some of their items returned and refunded at the price paid for them. Returns
+// are requested after delivery, and nothing happens after the end of the time window.
+func GenerateReturns(db *sql.DB, partialReturnRate float64, timeline *timedist.Distribution) error {
+	orders, err := getReturnableOrders(db)
+	if err != nil {
+		return err
+	}
+
+	returnStmt, err := db.Prepare(`
+		INSERT INTO returns (order_id, status, reason, requested_at, received_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $4, $6)
+		RETURNING id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare return statement: %w", err)
+	}
+	defer returnStmt.Close()
+
+	itemStmt, err := db.Prepare(`
+		INSERT INTO return_items (return_id, order_item_id, quantity, condition, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare return item statement: %w", err)
+	}
+	defer itemStmt.Close()
+
+	refundStmt, err := db.Prepare(`
+		INSERT INTO refunds (order_id, return_id, amount, currency, method, processed_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare refund statement: %w", err)
+	}
+	defer refundStmt.Close()
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(len(orders)).
+		WithTitle(fmt.Sprintf("Checking %d delivered orders for returns...", len(orders))).
+		Start()
+
+	for _, order := range orders {
+		progressBar.Increment()
+
+		refunded := order.Status == "Refunded"
+		if !refunded && random.Float64() >= partialReturnRate {
+			continue
+		}
+
+		// Customers ask for a return within a month of delivery
+		requestedAt := order.DeliveredAt.Add(time.Duration(1+random.Intn(30*24)) * time.Hour)
+		if requestedAt.After(timeline.End) {
+			if !refunded {
+				continue
+			}
+			requestedAt = order.DeliveredAt.Add(time.Duration(random.Int63n(int64(timeline.End.Sub(order.DeliveredAt)) + 1)))
+		}
+		receivedAt := requestedAt.Add(time.Duration(3*24+random.Intn(7*24)) * time.Hour)
+		processedAt := receivedAt.Add(time.Duration(1+random.Intn(4*24)) * time.Hour)
+
+		// Refunded orders went through the whole process, even if it ran past the window
+		status := "Refunded"
+		if !refunded {
+			switch {
+			case receivedAt.After(timeline.End):
+				status = "Requested"
+			case processedAt.After(timeline.End):
+				status = "Received"
+			case random.Float64() < 0.05:
+				status = "Rejected"
+			}
+		} else if processedAt.After(timeline.End) {
+			remaining := timeline.End.Sub(requestedAt)
+			receivedAt = requestedAt.Add(remaining / 2)
+			processedAt = requestedAt.Add(remaining * 3 / 4)
+		}
+
+		var received sql.NullTime
+		if status != "Requested" {
+			received = sql.NullTime{Time: receivedAt, Valid: true}
+		}
+		updatedAt := requestedAt
+		if received.Valid {
+			updatedAt = processedAt
+		}
+
+		var returnID int
+		err := returnStmt.QueryRow(order.ID, status, faker.ReturnReason(), requestedAt, received, updatedAt).Scan(&returnID)
+		if err != nil {
+			return fmt.Errorf("failed to insert return: %w", err)
+		}
+
+		// Refunded orders send everything back, others return part of their items
+		items := order.Items
+		if !refunded {
+			items = partialReturnItems(order.Items)
+		}
+
+		var itemsValue money.Amount
+		for _, item := range items {
+			if _, err := itemStmt.Exec(returnID, item.ID, item.Quantity, faker.ReturnCondition(), requestedAt); err != nil {
+				return fmt.Errorf("failed to insert return item: %w", err)
+			}
+			itemsValue += item.PricePerUnit.Mul(item.Quantity)
+		}
+
+		if status != "Refunded" {
+			continue
+		}
+
+		amount := order.TotalAmount
+		if !refunded {
+			amount = order.merchandiseRefund(itemsValue)
+		}
+
+		// Some customers take store credit instead of their money back
+		method := order.PaymentMethod
+		if random.Float64() < 0.1 {
+			method = "Store Credit"
+		}
+
+		if _, err := refundStmt.Exec(order.ID, returnID, amount, order.Currency, method, processedAt); err != nil {
+			return fmt.Errorf("failed to insert refund: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// merchandiseRefund returns the refund for returned items worth itemsValue at their unit
+// prices: their share of what was paid for the order's items after discounts and tax,
+// never more than that
+func (o returnableOrder) merchandiseRefund(itemsValue money.Amount) money.Amount {
+	paid := o.TotalAmount - o.ShippingCost
+	if o.Subtotal <= 0 || paid <= 0 {
+		return 0
+	}
+
+	currency, err := money.LookupCurrency(o.Currency)
+	if err != nil {
+		currency = money.Currency{Code: o.Currency, MinorUnits: 2}
+	}
+	refund := money.Amount(int64(itemsValue) * int64(paid) / int64(o.Subtotal)).Round(currency)
+	if refund > paid {
+		return paid
+	}
+	return refund
+}
+
+// partialReturnItems picks some of an order's items and quantities to return, always at
+// least one unit of one item
+func partialReturnItems(items []returnableItem) []returnableItem {
+	var returned []returnableItem
+	for _, item := range items {
+		if random.Float64() < 0.5 {
+			returned = append(returned, returnableItem{
+				ID:           item.ID,
+				Quantity:     1 + random.Intn(item.Quantity),
+				PricePerUnit: item.PricePerUnit,
+			})
+		}
+	}
+	if len(returned) == 0 {
+		item := items[random.Intn(len(items))]
+		returned = append(returned, returnableItem{ID: item.ID, Quantity: 1, PricePerUnit: item.PricePerUnit})
+	}
+	return returned
+}
+
+// getReturnableOrders returns delivered and refunded orders that have no return yet, along
+// with their items
+func getReturnableOrders(db *sql.DB) ([]returnableOrder, error) {
+	rows, err := db.Query(`
+		SELECT o.id, o.status, o.currency, o.payment_method, o.subtotal, o.shipping_cost, o.total_amount, o.delivered_at
+		FROM orders o
+		WHERE o.status IN ('Delivered', 'Refunded')
+			AND o.delivered_at IS NOT NULL
+			AND NOT EXISTS (SELECT 1 FROM returns r WHERE r.order_id = o.id)
+		ORDER BY o.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get returnable orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []returnableOrder
+	index := make(map[int]int)
+	for rows.Next() {
+		var order returnableOrder
+		if err := rows.Scan(
+			&order.ID, &order.Status, &order.Currency, &order.PaymentMethod,
+			&order.Subtotal, &order.ShippingCost, &order.TotalAmount, &order.DeliveredAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan returnable order: %w", err)
+		}
+		index[order.ID] = len(orders)
+		orders = append(orders, order)
+	}
+
+	orderIDs := make([]int, len(orders))
+	for i, order := range orders {
+		orderIDs[i] = order.ID
+	}
+
+	itemRows, err := db.Query(
+		"SELECT id, order_id, quantity, price_per_unit FROM order_items WHERE order_id = ANY($1) ORDER BY id",
+		pq.Array(orderIDs),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order items: %w", err)
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var item returnableItem
+		var orderID int
+		if err := itemRows.Scan(&item.ID, &orderID, &item.Quantity, &item.PricePerUnit); err != nil {
+			return nil, fmt.Errorf("failed to scan order item: %w", err)
+		}
+		orders[index[orderID]].Items = append(orders[index[orderID]].Items, item)
+	}
+
+	// Orders without items have nothing to return
+	returnable := orders[:0]
+	for _, order := range orders {
+		if len(order.Items) > 0 {
+			returnable = append(returnable, order)
+		}
+	}
+	return returnable, nil
+}
@@ -3,57 +3,77 @@ package models
 import (
 	"database/sql"
 	"fmt"
+	"math"
+	"sort"
 	"time"
 
 	"database-test/pkg/faker"
+	"database-test/pkg/timedist"
 
 	"github.com/pterm/pterm"
 )
 
 // Review represents a product review
 type Review struct {
-	ID        int
-	ProductID int
-	UserID    int
-	Rating    int
-	Title     string
-	Content   string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID               int
+	ProductID        int
+	UserID           int
+	Rating           int
+	Title            string
+	Content          string
+	OrderID          sql.NullInt64
+	VerifiedPurchase bool
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
 }
 
-// GenerateReviews generates reviews for products
-func GenerateReviews(db *sql.DB, count int) error {
-	// Get random user IDs
-	userIDs, err := GetRandomUserIDs(db, count)
-	if err != nil {
-		return err
-	}
+// reviewablePurchase is a delivered product a user hasn't reviewed yet
+type reviewablePurchase struct {
+	UserID      int
+	Product     reviewedProduct
+	OrderID     int
+	DeliveredAt time.Time
+	Persona     Persona
+	sampleKey   float64
+}
 
-	// If we don't have enough users, reuse them
-	for len(userIDs) < count {
-		userIDs = append(userIDs, userIDs...)
-	}
-	userIDs = userIDs[:count]
+// reviewedProduct holds the product details mentioned in review text
+type reviewedProduct struct {
+	ID       int
+	Name     string
+	Category string
+}
 
-	// Get random product IDs
-	productIDs, err := GetRandomProductIDs(db, count)
+// GenerateReviews generates reviews for products. Verified reviews are written by users
+// who received the product, after delivery, favoring personas inclined to review. A
+// fraction of reviews, set by unverifiedRatio, come from users without a purchase.
+func GenerateReviews(db *sql.DB, count int, unverifiedRatio float64, timeline *timedist.Distribution) error {
+	unverifiedCount := int(math.Round(float64(count) * unverifiedRatio))
+	verifiedCount := count - unverifiedCount
+
+	purchases, err := getReviewablePurchases(db, timeline.End)
 	if err != nil {
 		return err
 	}
+	if len(purchases) < verifiedCount {
+		pterm.Warning.Printf("Only %d delivered purchases can be reviewed, generating %d verified reviews\n",
+			len(purchases), len(purchases))
+		verifiedCount = len(purchases)
+	}
 
-	// If we don't have enough products, reuse them
-	for len(productIDs) < count {
-		productIDs = append(productIDs, productIDs...)
+	// Weighted sampling without replacement, favoring personas inclined to review
+	for i := range purchases {
+		purchases[i].sampleKey = -math.Log(1-random.Float64()) / purchases[i].Persona.ReviewPropensity
 	}
-	productIDs = productIDs[:count]
+	sort.Slice(purchases, func(i, j int) bool { return purchases[i].sampleKey < purchases[j].sampleKey })
+	purchases = purchases[:verifiedCount]
 
 	// Prepare review statement
 	stmt, err := db.Prepare(`
 		INSERT INTO reviews (
-			product_id, user_id, rating, title, content, created_at, updated_at
+			product_id, user_id, rating, title, content, order_id, verified_purchase, created_at, updated_at
 		)
-		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
 		RETURNING id
 	`)
 	if err != nil {
@@ -63,38 +83,171 @@ func GenerateReviews(db *sql.DB, count int) error {
 
 	// Create a progress bar
 	progressBar, _ := pterm.DefaultProgressbar.
-		WithTotal(count).
-		WithTitle(fmt.Sprintf("Generating %d reviews...", count)).
+		WithTotal(verifiedCount + unverifiedCount).
+		WithTitle(fmt.Sprintf("Generating %d verified and %d unverified reviews...", verifiedCount, unverifiedCount)).
 		Start()
 
-	reviewsGenerated := 0
-	for i := 0; i < count; i++ {
-		productID := productIDs[i]
-		userID := userIDs[i]
+	for _, purchase := range purchases {
+		// Most reviews are written within a few weeks of delivery
+		createdAt := purchase.DeliveredAt.Add(time.Duration(random.ExpFloat64()*7*24) * time.Hour)
+		if createdAt.After(timeline.End) {
+			createdAt = timeline.End.Add(-time.Duration(random.Intn(3600)) * time.Second)
+		}
+		if createdAt.Before(purchase.DeliveredAt) {
+			createdAt = purchase.DeliveredAt
+		}
+
+		orderID := sql.NullInt64{Int64: int64(purchase.OrderID), Valid: true}
+		if err := insertReview(stmt, purchase.Product, purchase.UserID, orderID, true, createdAt); err != nil {
+			return fmt.Errorf("failed to insert review: %w", err)
+		}
+		progressBar.Increment()
+	}
 
-		// Generate review data
-		rating := random.Intn(5) + 1 // 1-5 stars
-		title := faker.ReviewTitle()
-		content := faker.ReviewContent()
+	if unverifiedCount > 0 {
+		if err := generateUnverifiedReviews(db, stmt, unverifiedCount, timeline, progressBar); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unverifiedReviewAttempts bounds the random user and product pairs tried per unverified
+// review, for catalogs where most pairs were already reviewed
+const unverifiedReviewAttempts = 20
+
+// generateUnverifiedReviews writes n reviews by random users on random products, warning
+// when too few pairs are left to review
+func generateUnverifiedReviews(db *sql.DB, stmt *sql.Stmt, count int, timeline *timedist.Distribution, progressBar *pterm.ProgressbarPrinter) error {
+	users, err := GetUserPersonas(db)
+	if err != nil {
+		return err
+	}
+	products, err := getRandomReviewedProducts(db, count)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 || len(products) == 0 {
+		return fmt.Errorf("no users or products found for unverified reviews")
+	}
 
-		// Insert review
-		var id int
-		err := stmt.QueryRow(
-			productID, userID, rating, title, content,
-		).Scan(&id)
+	written := 0
+	for attempt := 0; written < count && attempt < count*unverifiedReviewAttempts; attempt++ {
+		user := users[random.Intn(len(users))]
+		product := products[random.Intn(len(products))]
 
+		// Users can only review once they've signed up
+		from := timeline.Start
+		if user.SignedUpAt.After(from) {
+			from = user.SignedUpAt
+		}
+		if !timeline.End.After(from) {
+			continue
+		}
+
+		err := insertReview(stmt, product, user.UserID, sql.NullInt64{}, false, timeline.SampleBetween(from, timeline.End))
 		if err != nil {
-			// Check if this user already reviewed this product
+			// Skip pairs where this user already reviewed this product
 			if err.Error() == "pq: duplicate key value violates unique constraint \"reviews_product_id_user_id_key\"" {
-				// Skip this review
 				continue
 			}
 			return fmt.Errorf("failed to insert review: %w", err)
 		}
-
-		reviewsGenerated++
+		written++
 		progressBar.Increment()
 	}
 
+	if written < count {
+		progressBar.Stop()
+		pterm.Warning.Printf("Only found %d user and product pairs to review, generating %d unverified reviews\n",
+			written, written)
+	}
+
 	return nil
 }
+
+// insertReview inserts a review whose title and content match its rating
+func insertReview(stmt *sql.Stmt, product reviewedProduct, userID int, orderID sql.NullInt64, verified bool, createdAt time.Time) error {
+	rating := faker.Rating()
+	title := faker.ReviewTitle(rating)
+	content := faker.ReviewContent(rating, product.Name, product.Category)
+
+	var id int
+	return stmt.QueryRow(
+		product.ID, userID, rating, title, content, orderID, verified, createdAt,
+	).Scan(&id)
+}
+
+// getReviewablePurchases returns each product delivered to a user before the cutoff that
+// the user hasn't reviewed yet, keeping the earliest delivery of repeat purchases
+func getReviewablePurchases(db *sql.DB, cutoff time.Time) ([]reviewablePurchase, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT ON (o.user_id, oi.product_id)
+			o.user_id, oi.product_id, p.name, c.name, o.id, o.delivered_at, COALESCE(s.segment, $2)
+		FROM order_items oi
+		JOIN orders o ON o.id = oi.order_id
+		JOIN products p ON p.id = oi.product_id
+		JOIN categories c ON c.id = p.category_id
+		LEFT JOIN user_segments s ON s.user_id = o.user_id
+		WHERE o.delivered_at IS NOT NULL AND o.delivered_at < $1
+		AND NOT EXISTS (
+			SELECT 1 FROM reviews r WHERE r.user_id = o.user_id AND r.product_id = oi.product_id
+		)
+		ORDER BY o.user_id, oi.product_id, o.delivered_at
+	`, cutoff, defaultPersona)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reviewable purchases: %w", err)
+	}
+	defer rows.Close()
+
+	var purchases []reviewablePurchase
+	for rows.Next() {
+		var purchase reviewablePurchase
+		var segment string
+		if err := rows.Scan(
+			&purchase.UserID, &purchase.Product.ID, &purchase.Product.Name, &purchase.Product.Category,
+			&purchase.OrderID, &purchase.DeliveredAt, &segment,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan reviewable purchase: %w", err)
+		}
+		purchase.Persona = PersonaByName(segment)
+		purchases = append(purchases, purchase)
+	}
+
+	return purchases, nil
+}
+
+// getRandomReviewedProducts returns n random products along with their category names
+func getRandomReviewedProducts(db *sql.DB, count int) ([]reviewedProduct, error) {
+	rows, err := db.Query(`
+		SELECT p.id, p.name, c.name
+		FROM products p
+		JOIN categories c ON c.id = p.category_id
+		ORDER BY RANDOM() LIMIT $1
+	`, count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get random products: %w", err)
+	}
+	defer rows.Close()
+
+	var products []reviewedProduct
+	for rows.Next() {
+		var product reviewedProduct
+		if err := rows.Scan(&product.ID, &product.Name, &product.Category); err != nil {
+			return nil, fmt.Errorf("failed to scan product: %w", err)
+		}
+		products = append(products, product)
+	}
+
+	return products, nil
+}
+
+// GetLastReviewID returns the ID of the latest review, or 0 if there are none yet
+func GetLastReviewID(db *sql.DB) (int, error) {
+	var id int
+	if err := db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM reviews").Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to get last review ID: %w", err)
+	}
+	return id, nil
+}
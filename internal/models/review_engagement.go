@@ -0,0 +1,221 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"database-test/pkg/faker"
+	"database-test/pkg/timedist"
+
+	"github.com/pterm/pterm"
+)
+
+// reviewPhotoRate is the fraction of reviews with photos, before the rating skew
+const reviewPhotoRate = 0.12
+
+// ReviewVote represents another user marking a review as helpful or not
+type ReviewVote struct {
+	ID        int
+	ReviewID  int
+	UserID    int
+	Helpful   bool
+	VotedAt   time.Time
+	CreatedAt time.Time
+}
+
+// ReviewReply represents the seller's public answer to a review
+type ReviewReply struct {
+	ID        int
+	ReviewID  int
+	SellerID  sql.NullInt64
+	Body      string
+	RepliedAt time.Time
+	CreatedAt time.Time
+}
+
+// ReviewImage represents a photo uploaded with a review
+type ReviewImage struct {
+	ID        int
+	ReviewID  int
+	ImageURL  string
+	Position  int
+	CreatedAt time.Time
+}
+
+// ReviewEngagement holds how much engagement reviews get on average
+type ReviewEngagement struct {
+	VotesPerReview float64 // Typical number of helpful and unhelpful votes on a review
+	ReplyRate      float64 // Fraction of reviews the seller answers, before the rating skew
+}
+
+// engagedReview holds the review details engagement depends on
+type engagedReview struct {
+	ID           int
+	UserID       int
+	Rating       int
+	Verified     bool
+	CreatedAt    time.Time
+	CustomerName string
+	ProductName  string
+	SellerID     sql.NullInt64
+}
+
+// GenerateReviewEngagement generates helpful votes, seller replies and photos for the
+// reviews written after the review with ID afterID, that is the ones seeded since
+// engagement last ran, so reviews that drew none keep it that way. Engagement piles up over time and around strong opinions: older
+// reviews have been read and voted on longer, and one and five star reviews draw more votes
+// and photos than lukewarm ones. Sellers mostly reply to unhappy customers. Replies to
+// products the store sells itself have no seller. Nothing happens after the end of the
+// time window.
+func GenerateReviewEngagement(db *sql.DB, engagement ReviewEngagement, afterID int, timeline *timedist.Distribution) error {
+	reviews, err := getEngagedReviews(db, afterID)
+	if err != nil {
+		return err
+	}
+	users, err := GetUserPersonas(db)
+	if err != nil {
+		return err
+	}
+
+	voteStmt, err := db.Prepare(`
+		INSERT INTO review_votes (review_id, user_id, helpful, voted_at, created_at)
+		VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT ON CONSTRAINT review_votes_review_id_user_id_key DO NOTHING
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare vote statement: %w", err)
+	}
+	defer voteStmt.Close()
+
+	replyStmt, err := db.Prepare(`
+		INSERT INTO review_replies (review_id, seller_id, body, replied_at, created_at)
+		VALUES ($1, $2, $3, $4, $4)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare reply statement: %w", err)
+	}
+	defer replyStmt.Close()
+
+	imageStmt, err := db.Prepare(`
+		INSERT INTO review_images (review_id, image_url, position, created_at)
+		VALUES ($1, $2, $3, $4)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare image statement: %w", err)
+	}
+	defer imageStmt.Close()
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(len(reviews)).
+		WithTitle(fmt.Sprintf("Generating engagement for %d reviews...", len(reviews))).
+		Start()
+
+	window := timeline.End.Sub(timeline.Start)
+	for _, review := range reviews {
+		progressBar.Increment()
+		if !review.CreatedAt.Before(timeline.End) {
+			continue
+		}
+
+		// Reviews collect votes for as long as they've been up, and strong opinions more so
+		age := float64(timeline.End.Sub(review.CreatedAt)) / float64(window)
+		extremity := ratingExtremity(review.Rating)
+
+		// Photos are uploaded with the review
+		if random.Float64() < reviewPhotoRate*extremity {
+			photos := 1 + random.Intn(4)
+			for position := 1; position <= photos; position++ {
+				if _, err := imageStmt.Exec(review.ID, faker.ReviewImageURL(review.ID, position), position, review.CreatedAt); err != nil {
+					return fmt.Errorf("failed to insert review image: %w", err)
+				}
+			}
+		}
+
+		// Verified reviews are found more helpful
+		votes := int(engagement.VotesPerReview * (0.25 + age) * extremity * 2 * random.Float64())
+		helpfulRate := 0.55
+		if review.Verified {
+			helpfulRate = 0.75
+		}
+		for v := 0; v < votes && len(users) > 1; v++ {
+			voter := users[random.Intn(len(users))]
+			if voter.UserID == review.UserID {
+				continue
+			}
+			from := review.CreatedAt
+			if voter.SignedUpAt.After(from) {
+				from = voter.SignedUpAt
+			}
+			if !timeline.End.After(from) {
+				continue
+			}
+			votedAt := timeline.SampleBetween(from, timeline.End)
+			if _, err := voteStmt.Exec(review.ID, voter.UserID, random.Float64() < helpfulRate, votedAt); err != nil {
+				return fmt.Errorf("failed to insert review vote: %w", err)
+			}
+		}
+
+		// Sellers answer most of the bad reviews and some of the good ones, within a week
+		replyRate := engagement.ReplyRate
+		if review.Rating <= 2 {
+			replyRate *= 3
+		}
+		if random.Float64() < replyRate {
+			repliedAt := review.CreatedAt.Add(time.Duration(1+random.Intn(7*24)) * time.Hour)
+			if repliedAt.After(timeline.End) {
+				continue
+			}
+			body := faker.ReviewReply(review.Rating, review.CustomerName, review.ProductName)
+			if _, err := replyStmt.Exec(review.ID, review.SellerID, body, repliedAt); err != nil {
+				return fmt.Errorf("failed to insert review reply: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ratingExtremity weighs engagement by how strong the opinion of a rating is
+func ratingExtremity(rating int) float64 {
+	switch rating {
+	case 1, 5:
+		return 1.6
+	case 2, 4:
+		return 0.9
+	default:
+		return 0.5
+	}
+}
+
+// getEngagedReviews returns the reviews after the one with ID afterID, along with their
+// author's first name and the product's seller
+func getEngagedReviews(db *sql.DB, afterID int) ([]engagedReview, error) {
+	rows, err := db.Query(`
+		SELECT r.id, r.user_id, r.rating, r.verified_purchase, r.created_at, u.first_name, p.name, p.seller_id
+		FROM reviews r
+		JOIN users u ON u.id = r.user_id
+		JOIN products p ON p.id = r.product_id
+		WHERE r.id > $1
+		ORDER BY r.id
+	`, afterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reviews: %w", err)
+	}
+	defer rows.Close()
+
+	var reviews []engagedReview
+	for rows.Next() {
+		var review engagedReview
+		if err := rows.Scan(
+			&review.ID, &review.UserID, &review.Rating, &review.Verified, &review.CreatedAt,
+			&review.CustomerName, &review.ProductName, &review.SellerID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan review: %w", err)
+		}
+		reviews = append(reviews, review)
+	}
+
+	return reviews, nil
+}
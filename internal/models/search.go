@@ -0,0 +1,194 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"database-test/pkg/faker"
+	"database-test/pkg/timedist"
+
+	"github.com/pterm/pterm"
+)
+
+// searchClickRate is the fraction of searches with results where the shopper clicks one
+const searchClickRate = 0.45
+
+// SearchQuery represents a search made in the store, with how many products it found
+type SearchQuery struct {
+	ID               int64
+	UserID           sql.NullInt64
+	Query            string
+	ResultCount      int
+	ClickedProductID sql.NullInt64
+	SearchedAt       time.Time
+	CreatedAt        time.Time
+}
+
+// UpdateSearchVectors fills the full-text search vector of every product from its name,
+// the names of its category and the category's ancestors, and its description, weighted
+// in that order
+func UpdateSearchVectors(db *sql.DB) error {
+	return updateSearchVectors(db, false)
+}
+
+// updateSearchVectors fills the search vectors of every product, or only of the products
+// without one when missingOnly is set
+func updateSearchVectors(db *sql.DB, missingOnly bool) error {
+	_, err := db.Exec(`
+		WITH RECURSIVE lineage AS (
+			SELECT id AS category_id, id AS ancestor_id, parent_id FROM categories
+			UNION ALL
+			SELECT l.category_id, c.id, c.parent_id
+			FROM lineage l
+			JOIN categories c ON c.id = l.parent_id
+		),
+		category_names AS (
+			SELECT l.category_id, string_agg(c.name, ' ') AS names
+			FROM lineage l
+			JOIN categories c ON c.id = l.ancestor_id
+			GROUP BY l.category_id
+		)
+		UPDATE products p SET search_vector =
+			setweight(to_tsvector('english', p.name), 'A') ||
+			setweight(to_tsvector('english', COALESCE(cn.names, '')), 'B') ||
+			setweight(to_tsvector('english', p.description), 'C')
+		FROM category_names cn
+		WHERE cn.category_id = p.category_id
+			AND (NOT $1 OR p.search_vector IS NULL)
+	`, missingOnly)
+	if err != nil {
+		return fmt.Errorf("failed to update search vectors: %w", err)
+	}
+	return nil
+}
+
+// GenerateSearchQueries generates n searches drawn from the catalog vocabulary, including
+// misspelled queries and queries for things the store doesn't sell, and inserts them into
+// the database. Each query is run against the product search vectors to record how many
+// products it found, so queries without results are real misses. Some searches are made
+// by signed-in users, who click one of the top results part of the time.
+func GenerateSearchQueries(db *sql.DB, count int, timeline *timedist.Distribution) error {
+	users, err := GetUserPersonas(db)
+	if err != nil {
+		return err
+	}
+
+	searches, err := newSearchLog(db)
+	if err != nil {
+		return err
+	}
+	defer searches.Close()
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(count).
+		WithTitle(fmt.Sprintf("Generating %d search queries...", count)).
+		Start()
+
+	for i := 0; i < count; i++ {
+		query := faker.CatalogSearchQuery()
+		searchedAt := timeline.Sample()
+
+		// Signed-in shoppers search after signing up; the rest are anonymous
+		var userID sql.NullInt64
+		if len(users) > 0 && random.Float64() < 0.6 {
+			user := users[random.Intn(len(users))]
+			if !user.SignedUpAt.After(searchedAt) {
+				userID = sql.NullInt64{Int64: int64(user.UserID), Valid: true}
+			}
+		}
+
+		topResults, resultCount, err := searches.run(query)
+		if err != nil {
+			return err
+		}
+
+		var clicked sql.NullInt64
+		if len(topResults) > 0 && random.Float64() < searchClickRate {
+			// Shoppers mostly click the first few results
+			position := min(int(random.ExpFloat64()*1.5), len(topResults)-1)
+			clicked = sql.NullInt64{Int64: int64(topResults[position]), Valid: true}
+		}
+
+		if err := searches.record(userID, query, resultCount, clicked, searchedAt); err != nil {
+			return err
+		}
+		progressBar.Increment()
+	}
+
+	return nil
+}
+
+// searchLog runs searches against the product search vectors and records them in the
+// search log
+type searchLog struct {
+	searchStmt *sql.Stmt
+	insertStmt *sql.Stmt
+}
+
+// newSearchLog prepares the statements searching products and logging searches. Products
+// without a search vector, such as ones seeded before products were searchable, get one
+// first so searches can find them.
+func newSearchLog(db *sql.DB) (*searchLog, error) {
+	if err := updateSearchVectors(db, true); err != nil {
+		return nil, err
+	}
+
+	searchStmt, err := db.Prepare(`
+		SELECT id, COUNT(*) OVER ()
+		FROM products
+		WHERE search_vector @@ plainto_tsquery('english', $1)
+		ORDER BY ts_rank(search_vector, plainto_tsquery('english', $1)) DESC, id
+		LIMIT 10
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare search statement: %w", err)
+	}
+
+	insertStmt, err := db.Prepare(`
+		INSERT INTO search_queries (user_id, query, result_count, clicked_product_id, searched_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+	`)
+	if err != nil {
+		searchStmt.Close()
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+
+	return &searchLog{searchStmt: searchStmt, insertStmt: insertStmt}, nil
+}
+
+// Close closes the prepared statements
+func (l *searchLog) Close() {
+	l.searchStmt.Close()
+	l.insertStmt.Close()
+}
+
+// run returns the IDs of the top products matching the query and how many match
+func (l *searchLog) run(query string) ([]int, int, error) {
+	rows, err := l.searchStmt.Query(query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search products: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	total := 0
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id, &total); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, total, nil
+}
+
+// record logs a search with how many products it found and the result clicked, if any
+func (l *searchLog) record(userID sql.NullInt64, query string, resultCount int, clicked sql.NullInt64, at time.Time) error {
+	if _, err := l.insertStmt.Exec(userID, query, resultCount, clicked, at); err != nil {
+		return fmt.Errorf("failed to insert search query: %w", err)
+	}
+	return nil
+}
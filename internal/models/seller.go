@@ -0,0 +1,217 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"database-test/pkg/faker"
+	"database-test/pkg/timedist"
+
+	"github.com/pterm/pterm"
+)
+
+// Seller represents a merchant selling products on the marketplace
+type Seller struct {
+	ID                int
+	Name              string
+	Email             string
+	Country           string
+	Rating            float64
+	CommissionPercent float64
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+// Brand represents the brand a product is made under
+type Brand struct {
+	ID        int
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// GenerateSellers generates n fake sellers and inserts them into the database. Sellers were
+// established on the marketplace before the time window starts.
+func GenerateSellers(db *sql.DB, count int, timeline *timedist.Distribution) error {
+	stmt, err := db.Prepare(`
+		INSERT INTO sellers (name, email, country, rating, commission_percent, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(count).
+		WithTitle(fmt.Sprintf("Generating %d sellers...", count)).
+		Start()
+
+	commissions := []float64{8, 10, 12, 15}
+	for i := 0; i < count; i++ {
+		name := faker.CompanyName()
+		email := fmt.Sprintf("sales@%s-%d.example.com", faker.Slug(name), random.Intn(100000))
+		rating := math.Round((3.5+random.Float64()*1.5)*100) / 100
+		createdAt := timeline.Start.Add(-time.Duration(30+random.Intn(700)) * 24 * time.Hour)
+
+		_, err := stmt.Exec(
+			name, email, faker.CountryAbbr(), rating, commissions[random.Intn(len(commissions))], createdAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert seller: %w", err)
+		}
+		progressBar.Increment()
+	}
+
+	return nil
+}
+
+// GenerateBrands generates n fake brands with unique names and inserts them into the database
+func GenerateBrands(db *sql.DB, count int) error {
+	taken, err := getBrandNames(db)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := db.Prepare("INSERT INTO brands (name) VALUES ($1)")
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(count).
+		WithTitle(fmt.Sprintf("Generating %d brands...", count)).
+		Start()
+
+	for i := 0; i < count; i++ {
+		base := faker.BrandName()
+		name := base
+		for n := 2; taken[name]; n++ {
+			name = fmt.Sprintf("%s %d", base, n)
+		}
+		taken[name] = true
+
+		if _, err := stmt.Exec(name); err != nil {
+			return fmt.Errorf("failed to insert brand: %w", err)
+		}
+		progressBar.Increment()
+	}
+
+	return nil
+}
+
+// getBrandNames returns the names of the existing brands
+func getBrandNames(db *sql.DB) (map[string]bool, error) {
+	rows, err := db.Query("SELECT name FROM brands")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get brands: %w", err)
+	}
+	defer rows.Close()
+
+	names := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan brand: %w", err)
+		}
+		names[name] = true
+	}
+
+	return names, nil
+}
+
+// catalogBrand is a brand a seller carries
+type catalogBrand struct {
+	ID   int
+	Name string
+}
+
+// sellerAssigner picks the seller and brand of new products. Catalog sizes are skewed across
+// sellers, and each seller carries a handful of brands.
+type sellerAssigner struct {
+	sellerIDs  []int
+	chooser    *weightedChooser
+	portfolios map[int][]catalogBrand
+	brands     []catalogBrand
+}
+
+// newSellerAssigner loads the sellers and brands. The kth largest seller lists 1/k^skew as
+// many products as the largest one.
+func newSellerAssigner(db *sql.DB, skew float64) (*sellerAssigner, error) {
+	assigner := &sellerAssigner{portfolios: make(map[int][]catalogBrand)}
+
+	rows, err := db.Query("SELECT id, name FROM brands")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get brands: %w", err)
+	}
+	for rows.Next() {
+		var brand catalogBrand
+		if err := rows.Scan(&brand.ID, &brand.Name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan brand: %w", err)
+		}
+		assigner.brands = append(assigner.brands, brand)
+	}
+	rows.Close()
+
+	// Largest sellers are random, not the oldest
+	assigner.sellerIDs, err = GetRandomSellerIDs(db, math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+	weights := make([]float64, len(assigner.sellerIDs))
+	for rank := range weights {
+		weights[rank] = 1 / math.Pow(float64(rank+1), skew)
+	}
+	assigner.chooser = newWeightedChooser(weights)
+
+	for _, sellerID := range assigner.sellerIDs {
+		for i := 1 + random.Intn(5); i > 0 && len(assigner.brands) > 0; i-- {
+			assigner.portfolios[sellerID] = append(assigner.portfolios[sellerID], assigner.brands[random.Intn(len(assigner.brands))])
+		}
+	}
+
+	return assigner, nil
+}
+
+// pick returns a seller and one of the brands it carries. Products have no seller when the
+// store isn't a marketplace, and no brand when there are no brands.
+func (a *sellerAssigner) pick() (sql.NullInt64, *catalogBrand) {
+	var sellerID sql.NullInt64
+	brands := a.brands
+	if index := a.chooser.Choose(); index >= 0 {
+		id := a.sellerIDs[index]
+		sellerID = sql.NullInt64{Int64: int64(id), Valid: true}
+		brands = a.portfolios[id]
+	}
+
+	if len(brands) == 0 {
+		return sellerID, nil
+	}
+	return sellerID, &brands[random.Intn(len(brands))]
+}
+
+// GetRandomSellerIDs returns n random seller IDs from the database
+func GetRandomSellerIDs(db *sql.DB, count int) ([]int, error) {
+	rows, err := db.Query("SELECT id FROM sellers ORDER BY RANDOM() LIMIT $1", count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get random seller IDs: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan seller ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"database-test/pkg/faker"
+)
+
+// Shipment represents the parcel a seller sends for its part of an order
+type Shipment struct {
+	ID             int
+	OrderID        int
+	SellerID       sql.NullInt64
+	Carrier        string
+	TrackingNumber string
+	Status         string
+	ShippedAt      time.Time
+	DeliveredAt    sql.NullTime
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// plannedShipment is a shipment along with the indexes of the order lines it contains
+type plannedShipment struct {
+	Shipment
+	Lines []int
+}
+
+// planShipments splits an order into one shipment per seller. Only orders that left the
+// warehouse have shipments. Each seller ships on its own schedule, so a delivered order
+// arrived when its last shipment did; when that would be after end the order is still
+// shipped, though some of its shipments may have arrived. It returns the shipments along
+// with the order's resulting status and delivery time.
+func planShipments(lines []OrderLine, createdAt time.Time, status, shippingMethod string, trackingNumber sql.NullString, end time.Time) ([]plannedShipment, string, sql.NullTime) {
+	if status != "Shipped" && status != "Delivered" && status != "Refunded" {
+		return nil, status, sql.NullTime{}
+	}
+
+	var shipments []plannedShipment
+	bySeller := make(map[sql.NullInt64]int)
+	for i, line := range lines {
+		index, ok := bySeller[line.SellerID]
+		if !ok {
+			index = len(shipments)
+			bySeller[line.SellerID] = index
+			shipments = append(shipments, plannedShipment{Shipment: Shipment{SellerID: line.SellerID}})
+		}
+		shipments[index].Lines = append(shipments[index].Lines, i)
+	}
+
+	var deliveredAt sql.NullTime
+	for i := range shipments {
+		shipment := &shipments[i].Shipment
+		shipment.Carrier = faker.Carrier()
+		shipment.TrackingNumber = faker.TrackingNumber()
+		if i == 0 && trackingNumber.Valid {
+			shipment.TrackingNumber = trackingNumber.String
+		}
+
+		// Shipped orders are still in transit
+		if status == "Shipped" {
+			shipment.Status = "Shipped"
+			shipment.ShippedAt = shipTime(createdAt, end)
+			continue
+		}
+
+		arrival := deliveryTime(createdAt, shippingMethod)
+		shipment.ShippedAt = shipTime(createdAt, arrival)
+		if arrival.After(end) {
+			shipment.Status = "Shipped"
+		} else {
+			shipment.Status = "Delivered"
+			shipment.DeliveredAt = sql.NullTime{Time: arrival, Valid: true}
+		}
+		if !deliveredAt.Valid || arrival.After(deliveredAt.Time) {
+			deliveredAt = sql.NullTime{Time: arrival, Valid: true}
+		}
+	}
+
+	if deliveredAt.Valid && deliveredAt.Time.After(end) {
+		return shipments, "Shipped", sql.NullTime{}
+	}
+	return shipments, status, deliveredAt
+}
+
+// shipTime returns when a parcel left the seller, between 2 and 48 hours after the order was
+// placed and never after the given deadline
+func shipTime(createdAt, deadline time.Time) time.Time {
+	shippedAt := createdAt.Add(2*time.Hour + time.Duration(random.Int63n(int64(46*time.Hour))))
+	if shippedAt.After(deadline) {
+		return createdAt.Add(deadline.Sub(createdAt) / 2)
+	}
+	return shippedAt
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"database-test/pkg/faker"
+	"database-test/pkg/timedist"
+
+	gofaker "github.com/go-faker/faker/v4"
+	"github.com/pterm/pterm"
+)
+
+// Staff roles
+const (
+	StaffAdmin     = "admin"
+	StaffSupport   = "support"
+	StaffWarehouse = "warehouse"
+)
+
+// staffTeams lists the teams staff with each role work in
+var staffTeams = map[string][]string{
+	StaffAdmin:     {"Merchandising", "Operations", "Finance"},
+	StaffSupport:   {"Orders", "Returns", "Billing", "General"},
+	StaffWarehouse: {"Picking", "Packing", "Receiving"},
+}
+
+// Staff represents an employee of the store with access to the back office
+type Staff struct {
+	ID        int
+	FirstName string
+	LastName  string
+	Email     string
+	Role      string
+	Team      string
+	HiredAt   time.Time
+	CreatedAt time.Time
+}
+
+// staffMember is an employee who can act on records once hired
+type staffMember struct {
+	ID        int
+	FirstName string
+	HiredAt   time.Time
+}
+
+// GenerateStaff generates n fake staff members with the role and inserts them into the
+// database. Most were hired before the time window, the rest join during it.
+func GenerateStaff(db *sql.DB, role string, count int, timeline *timedist.Distribution) error {
+	teams, ok := staffTeams[role]
+	if !ok {
+		return fmt.Errorf("unknown staff role: %s", role)
+	}
+
+	stmt, err := db.Prepare(`
+		INSERT INTO staff (first_name, last_name, email, role, team, hired_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(count).
+		WithTitle(fmt.Sprintf("Generating %d %s staff...", count, role)).
+		Start()
+
+	for i := 0; i < count; i++ {
+		firstName, lastName := gofaker.FirstName(), gofaker.LastName()
+		email := fmt.Sprintf("%s.%s.%d@staff.example.com", faker.Slug(firstName), faker.Slug(lastName), random.Intn(10000))
+
+		hiredAt := timeline.Start.Add(-time.Duration(random.Intn(3*365)) * 24 * time.Hour)
+		if random.Float64() < 0.3 {
+			hiredAt = timeline.SampleBetween(timeline.Start, timeline.Fraction(0.8))
+		}
+
+		if _, err := stmt.Exec(firstName, lastName, email, role, teams[random.Intn(len(teams))], hiredAt); err != nil {
+			// If it's a duplicate email, try again
+			if err.Error() == "pq: duplicate key value violates unique constraint \"staff_email_key\"" {
+				i--
+				continue
+			}
+			return fmt.Errorf("failed to insert staff member: %w", err)
+		}
+		progressBar.Increment()
+	}
+
+	return nil
+}
+
+// pickStaff returns a random staff member hired by the given time, or nil if there is none
+func pickStaff(staff []staffMember, at time.Time) *staffMember {
+	for attempt := 0; attempt < 10 && len(staff) > 0; attempt++ {
+		member := &staff[random.Intn(len(staff))]
+		if !member.HiredAt.After(at) {
+			return member
+		}
+	}
+	for i := range staff {
+		if !staff[i].HiredAt.After(at) {
+			return &staff[i]
+		}
+	}
+	return nil
+}
+
+// getStaff returns every staff member with the role
+func getStaff(db *sql.DB, role string) ([]staffMember, error) {
+	rows, err := db.Query("SELECT id, first_name, hired_at FROM staff WHERE role = $1", role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get staff: %w", err)
+	}
+	defer rows.Close()
+
+	var staff []staffMember
+	for rows.Next() {
+		var member staffMember
+		if err := rows.Scan(&member.ID, &member.FirstName, &member.HiredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan staff member: %w", err)
+		}
+		staff = append(staff, member)
+	}
+
+	return staff, nil
+}
@@ -0,0 +1,455 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"database-test/pkg/faker"
+	"database-test/pkg/money"
+	"database-test/pkg/timedist"
+
+	"github.com/pterm/pterm"
+)
+
+// Store credit ledger entry types
+const (
+	LedgerGiftCardRedemption = "gift_card_redemption"
+	LedgerRefund             = "refund"
+	LedgerOrderPayment       = "order_payment"
+)
+
+// storeCreditMethod is the payment and refund method backed by store credit
+const storeCreditMethod = "Store Credit"
+
+// storeCreditUseRate is the fraction of orders paid partly with store credit when the
+// customer has some
+const storeCreditUseRate = 0.7
+
+// GiftCard represents a prepaid card redeemed into a store credit account
+type GiftCard struct {
+	ID               int
+	Code             string
+	InitialBalance   money.Amount
+	Currency         string
+	PurchaserUserID  sql.NullInt64
+	RedeemedByUserID sql.NullInt64
+	IssuedAt         time.Time
+	ExpiresAt        time.Time
+	RedeemedAt       sql.NullTime
+	CreatedAt        time.Time
+}
+
+// StoreCreditAccount holds a customer's store credit in one currency
+type StoreCreditAccount struct {
+	ID        int
+	UserID    int
+	Currency  string
+	Balance   money.Amount
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// StoreCreditEntry represents a movement on a store credit account. Credits are positive and
+// debits negative.
+type StoreCreditEntry struct {
+	ID           int
+	AccountID    int
+	EntryType    string
+	Amount       money.Amount
+	BalanceAfter money.Amount
+	GiftCardID   sql.NullInt64
+	OrderID      sql.NullInt64
+	RefundID     sql.NullInt64
+	OccurredAt   time.Time
+	CreatedAt    time.Time
+}
+
+// OrderPayment represents the part of an order paid with one payment method
+type OrderPayment struct {
+	ID            int
+	OrderID       int
+	Method        string
+	Amount        money.Amount
+	LedgerEntryID sql.NullInt64
+	PaidAt        time.Time
+	CreatedAt     time.Time
+}
+
+// giftCardDenominations lists the face values gift cards are sold at, in US dollars
+var giftCardDenominations = []money.Amount{2500, 5000, 10000, 15000, 20000}
+
+// GenerateGiftCards generates n fake gift cards and inserts them into the database. Each card
+// is bought for a customer ahead of one of their orders, in the currency of that order, and
+// most are redeemed into the customer's store credit before the order is placed.
+func GenerateGiftCards(db *sql.DB, count int, timeline *timedist.Distribution, baseCurrency money.Currency) error {
+	rows, err := db.Query(`
+		SELECT user_id, currency, created_at FROM orders
+		WHERE status NOT IN ('Pending', 'Cancelled')
+		ORDER BY RANDOM() LIMIT $1
+	`, count)
+	if err != nil {
+		return fmt.Errorf("failed to get orders: %w", err)
+	}
+	type recipientOrder struct {
+		UserID    int
+		Currency  string
+		CreatedAt time.Time
+	}
+	var orders []recipientOrder
+	for rows.Next() {
+		var order recipientOrder
+		if err := rows.Scan(&order.UserID, &order.Currency, &order.CreatedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+	rows.Close()
+	if len(orders) == 0 {
+		return fmt.Errorf("no orders found to buy gift cards for")
+	}
+
+	purchaserIDs, err := GetRandomUserIDs(db, count)
+	if err != nil {
+		return err
+	}
+	exchangeRates, err := GetExchangeRates(db, baseCurrency)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := db.Prepare(`
+		INSERT INTO gift_cards (
+			code, initial_balance, currency, purchaser_user_id, redeemed_by_user_id,
+			issued_at, expires_at, redeemed_at, created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $6)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(count).
+		WithTitle(fmt.Sprintf("Generating %d gift cards...", count)).
+		Start()
+
+	for i := 0; i < count; i++ {
+		order := orders[i%len(orders)]
+
+		// Face values are converted from dollars at the rate of the order the card pays for,
+		// and rounded to whole units
+		currency, err := money.LookupCurrency(order.Currency)
+		if err != nil {
+			return err
+		}
+		fx, err := exchangeRates.Conversion(currency, order.CreatedAt)
+		if err != nil {
+			return err
+		}
+		denomination := usdConversion(baseCurrency, fx).Apply(giftCardDenominations[random.Intn(len(giftCardDenominations))])
+		denomination = max(100, (denomination+50)/100*100)
+
+		// Cards are bought up to two months before the order, never before the time window
+		issuedAt := order.CreatedAt.Add(-time.Duration(1+random.Intn(60*24)) * time.Hour)
+		if issuedAt.Before(timeline.Start) {
+			issuedAt = timeline.Start
+		}
+		expiresAt := issuedAt.AddDate(2, 0, 0)
+
+		// 20% of cards are bought by guests
+		var purchaserID sql.NullInt64
+		if len(purchaserIDs) > 0 && random.Float64() >= 0.2 {
+			purchaserID = sql.NullInt64{Int64: int64(purchaserIDs[random.Intn(len(purchaserIDs))]), Valid: true}
+		}
+
+		// 75% of cards are redeemed by the time of the order
+		var redeemedBy sql.NullInt64
+		var redeemedAt sql.NullTime
+		if random.Float64() < 0.75 && order.CreatedAt.After(issuedAt) {
+			redeemedBy = sql.NullInt64{Int64: int64(order.UserID), Valid: true}
+			at := issuedAt.Add(time.Duration(random.Int63n(int64(order.CreatedAt.Sub(issuedAt))))).Truncate(time.Second)
+			redeemedAt = sql.NullTime{Time: at, Valid: true}
+		}
+
+		_, err = stmt.Exec(
+			faker.GiftCardCode(), denomination, order.Currency, purchaserID, redeemedBy,
+			issuedAt, expiresAt, redeemedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert gift card: %w", err)
+		}
+		progressBar.Increment()
+	}
+
+	return nil
+}
+
+// creditMovement is an event affecting a store credit balance: a credit from a redeemed gift
+// card or a store credit refund, or an order that may be paid with credit
+type creditMovement struct {
+	At         time.Time
+	UserID     int
+	Currency   string
+	Amount     money.Amount // Credited amount, or order total
+	GiftCardID sql.NullInt64
+	RefundID   sql.NullInt64
+	Order      *payableOrder
+}
+
+// payableOrder holds the order details needed to record its payments
+type payableOrder struct {
+	ID            int
+	PaymentMethod string
+}
+
+// creditAccount is a store credit account and its running balance
+type creditAccount struct {
+	ID      int
+	Balance money.Amount
+	Updated time.Time
+}
+
+// GenerateStoreCredit builds the store credit ledger and the payments of orders that have none.
+// Redeemed gift cards and store credit refunds credit the customer's account in their
+// currency, and later orders in that currency are paid partly or fully with the balance,
+// the rest going to the order's payment method. Movements are applied in chronological
+// order, so balances never go negative.
+func GenerateStoreCredit(db *sql.DB) error {
+	movements, err := getCreditMovements(db)
+	if err != nil {
+		return err
+	}
+	accounts, err := getCreditAccounts(db)
+	if err != nil {
+		return err
+	}
+
+	accountStmt, err := db.Prepare(`
+		INSERT INTO store_credit_accounts (user_id, currency, created_at, updated_at)
+		VALUES ($1, $2, $3, $3)
+		RETURNING id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare account statement: %w", err)
+	}
+	defer accountStmt.Close()
+
+	ledgerStmt, err := db.Prepare(`
+		INSERT INTO store_credit_ledger (
+			account_id, entry_type, amount, balance_after, gift_card_id, order_id, refund_id, occurred_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare ledger statement: %w", err)
+	}
+	defer ledgerStmt.Close()
+
+	paymentStmt, err := db.Prepare(`
+		INSERT INTO order_payments (order_id, method, amount, ledger_entry_id, paid_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare payment statement: %w", err)
+	}
+	defer paymentStmt.Close()
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(len(movements)).
+		WithTitle(fmt.Sprintf("Processing %d store credit movements and payments...", len(movements))).
+		Start()
+
+	for _, movement := range movements {
+		key := fmt.Sprintf("%d/%s", movement.UserID, movement.Currency)
+		account := accounts[key]
+
+		// Credits open the account the first time
+		if movement.Order == nil {
+			if account == nil {
+				account = &creditAccount{}
+				if err := accountStmt.QueryRow(movement.UserID, movement.Currency, movement.At).Scan(&account.ID); err != nil {
+					return fmt.Errorf("failed to insert store credit account: %w", err)
+				}
+				accounts[key] = account
+			}
+
+			entryType := LedgerGiftCardRedemption
+			if movement.RefundID.Valid {
+				entryType = LedgerRefund
+			}
+			account.Balance += movement.Amount
+			account.Updated = movement.At
+			_, err := ledgerStmt.Exec(
+				account.ID, entryType, movement.Amount, account.Balance,
+				movement.GiftCardID, nil, movement.RefundID, movement.At,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to insert ledger entry: %w", err)
+			}
+			progressBar.Increment()
+			continue
+		}
+
+		// Orders draw on the balance when the customer chooses to use it
+		order := movement.Order
+		remaining := movement.Amount
+		if account != nil && account.Balance > 0 && remaining > 0 && random.Float64() < storeCreditUseRate {
+			used := min(account.Balance, remaining)
+			account.Balance -= used
+			account.Updated = movement.At
+
+			var entryID int64
+			err := ledgerStmt.QueryRow(
+				account.ID, LedgerOrderPayment, -used, account.Balance, nil, order.ID, nil, movement.At,
+			).Scan(&entryID)
+			if err != nil {
+				return fmt.Errorf("failed to insert ledger entry: %w", err)
+			}
+			if _, err := paymentStmt.Exec(order.ID, storeCreditMethod, used, entryID, movement.At); err != nil {
+				return fmt.Errorf("failed to insert order payment: %w", err)
+			}
+			remaining -= used
+
+			// Orders paid entirely with credit never touched another method
+			if remaining == 0 {
+				if _, err := db.Exec("UPDATE orders SET payment_method = $1 WHERE id = $2", storeCreditMethod, order.ID); err != nil {
+					return fmt.Errorf("failed to update order payment method: %w", err)
+				}
+			}
+		}
+		if remaining > 0 {
+			if _, err := paymentStmt.Exec(order.ID, order.PaymentMethod, remaining, nil, movement.At); err != nil {
+				return fmt.Errorf("failed to insert order payment: %w", err)
+			}
+		}
+		progressBar.Increment()
+	}
+
+	// Store the final balances
+	for _, account := range accounts {
+		if account.Updated.IsZero() {
+			continue
+		}
+		_, err := db.Exec(
+			"UPDATE store_credit_accounts SET balance = $1, updated_at = $2 WHERE id = $3",
+			account.Balance, account.Updated, account.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update store credit balance: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// getCreditMovements returns the credits missing from the ledger and the paid orders
+// without payments, in chronological order. Credits come first when they happen at the
+// same time as an order.
+func getCreditMovements(db *sql.DB) ([]creditMovement, error) {
+	var movements []creditMovement
+
+	rows, err := db.Query(`
+		SELECT g.id, g.redeemed_by_user_id, g.currency, g.initial_balance, g.redeemed_at
+		FROM gift_cards g
+		WHERE g.redeemed_at IS NOT NULL
+			AND NOT EXISTS (SELECT 1 FROM store_credit_ledger l WHERE l.gift_card_id = g.id)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get redeemed gift cards: %w", err)
+	}
+	for rows.Next() {
+		var movement creditMovement
+		var giftCardID int64
+		if err := rows.Scan(&giftCardID, &movement.UserID, &movement.Currency, &movement.Amount, &movement.At); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan gift card: %w", err)
+		}
+		movement.GiftCardID = sql.NullInt64{Int64: giftCardID, Valid: true}
+		movements = append(movements, movement)
+	}
+	rows.Close()
+
+	rows, err = db.Query(`
+		SELECT r.id, o.user_id, r.currency, r.amount, r.processed_at
+		FROM refunds r
+		JOIN orders o ON o.id = r.order_id
+		WHERE r.method = $1 AND r.amount > 0
+			AND NOT EXISTS (SELECT 1 FROM store_credit_ledger l WHERE l.refund_id = r.id)
+	`, storeCreditMethod)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get store credit refunds: %w", err)
+	}
+	for rows.Next() {
+		var movement creditMovement
+		var refundID int64
+		if err := rows.Scan(&refundID, &movement.UserID, &movement.Currency, &movement.Amount, &movement.At); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan refund: %w", err)
+		}
+		movement.RefundID = sql.NullInt64{Int64: refundID, Valid: true}
+		movements = append(movements, movement)
+	}
+	rows.Close()
+
+	// Pending orders haven't been charged yet, and cancelled ones never were
+	rows, err = db.Query(`
+		SELECT o.id, o.user_id, o.currency, o.total_amount, o.payment_method, o.created_at
+		FROM orders o
+		WHERE o.status NOT IN ('Pending', 'Cancelled')
+			AND NOT EXISTS (SELECT 1 FROM order_payments p WHERE p.order_id = o.id)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		movement := creditMovement{Order: &payableOrder{}}
+		if err := rows.Scan(
+			&movement.Order.ID, &movement.UserID, &movement.Currency, &movement.Amount,
+			&movement.Order.PaymentMethod, &movement.At,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		movements = append(movements, movement)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read orders: %w", err)
+	}
+
+	sort.SliceStable(movements, func(a, b int) bool {
+		if !movements[a].At.Equal(movements[b].At) {
+			return movements[a].At.Before(movements[b].At)
+		}
+		return movements[a].Order == nil && movements[b].Order != nil
+	})
+	return movements, nil
+}
+
+// getCreditAccounts returns the existing store credit accounts keyed by user and currency
+func getCreditAccounts(db *sql.DB) (map[string]*creditAccount, error) {
+	rows, err := db.Query("SELECT id, user_id, currency, balance FROM store_credit_accounts")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get store credit accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := make(map[string]*creditAccount)
+	for rows.Next() {
+		var account creditAccount
+		var userID int
+		var currency string
+		if err := rows.Scan(&account.ID, &userID, &currency, &account.Balance); err != nil {
+			return nil, fmt.Errorf("failed to scan store credit account: %w", err)
+		}
+		accounts[fmt.Sprintf("%d/%s", userID, currency)] = &account
+	}
+
+	return accounts, nil
+}
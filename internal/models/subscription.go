@@ -0,0 +1,419 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"database-test/pkg/faker"
+	"database-test/pkg/money"
+	"database-test/pkg/timedist"
+
+	"github.com/pterm/pterm"
+)
+
+// Subscription statuses
+const (
+	SubscriptionActive    = "Active"
+	SubscriptionPaused    = "Paused"
+	SubscriptionPastDue   = "Past Due"
+	SubscriptionCancelled = "Cancelled"
+)
+
+// Subscription event types, recording the history of a subscription
+const (
+	SubscriptionEventCreated       = "created"
+	SubscriptionEventRenewed       = "renewed"
+	SubscriptionEventPaymentFailed = "payment_failed"
+	SubscriptionEventPaused        = "paused"
+	SubscriptionEventResumed       = "resumed"
+	SubscriptionEventCancelled     = "cancelled"
+)
+
+// Per billing cycle odds of a subscriber cancelling, pausing, or their payment failing. Failed
+// payments are retried a few days apart before the subscription is cancelled.
+const (
+	subscriptionCancelRate  = 0.03
+	subscriptionPauseRate   = 0.04
+	paymentFailureRate      = 0.06
+	paymentRetries          = 3
+	paymentRetrySuccessRate = 0.5
+	paymentRetryDays        = 3
+)
+
+// consumableDepartments lists the top-level categories whose products people subscribe to
+var consumableDepartments = map[string]bool{
+	"Food & Grocery": true, "Pet Supplies": true, "Beauty & Personal Care": true,
+	"Health & Wellness": true, "Baby Products": true, "Office Supplies": true,
+}
+
+// Subscription represents a product delivered on a recurring schedule
+type Subscription struct {
+	ID                int
+	UserID            int
+	ProductID         int
+	VariantID         int
+	Quantity          int
+	Plan              string
+	BillingInterval   string
+	Status            string
+	ShippingAddressID int
+	PaymentMethod     string
+	NextBillingDate   sql.NullTime
+	StartedAt         time.Time
+	CancelledAt       sql.NullTime
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+// SubscriptionEvent represents a change in the life of a subscription
+type SubscriptionEvent struct {
+	ID             int
+	SubscriptionID int
+	EventType      string
+	OrderID        sql.NullInt64
+	OccurredAt     time.Time
+}
+
+// subscriptionPlan is a subscribe-and-save tier
+type subscriptionPlan struct {
+	Name           string
+	BasisPoints    int64 // Discount off the list price, in basis points
+	ShippingMethod string
+}
+
+// subscriptionPlans lists the tiers customers subscribe to
+var subscriptionPlans = []subscriptionPlan{
+	{Name: "Essential", BasisPoints: 500, ShippingMethod: "Standard Shipping"},
+	{Name: "Plus", BasisPoints: 1000, ShippingMethod: "Standard Shipping"},
+	{Name: "Premium", BasisPoints: 1500, ShippingMethod: "Free Shipping"},
+}
+
+// billingInterval is how often a subscription renews
+type billingInterval struct {
+	Name   string
+	Days   int
+	Months int
+}
+
+// billingIntervals lists the renewal schedules customers choose from
+var billingIntervals = []billingInterval{
+	{Name: "weekly", Days: 7},
+	{Name: "biweekly", Days: 14},
+	{Name: "monthly", Months: 1},
+	{Name: "bimonthly", Months: 2},
+	{Name: "quarterly", Months: 3},
+}
+
+// after returns the billing time following t. Renewals are billed by an overnight job.
+func (i billingInterval) after(t time.Time) time.Time {
+	day := t.Truncate(24*time.Hour).AddDate(0, i.Months, i.Days)
+	return day.Add(time.Duration(2+random.Intn(4))*time.Hour + time.Duration(random.Intn(3600))*time.Second)
+}
+
+// subscriptionHistory is the simulated life of a subscription over the time window
+type subscriptionHistory struct {
+	Events          []SubscriptionEvent
+	Status          string
+	NextBillingDate sql.NullTime
+	CancelledAt     sql.NullTime
+}
+
+// simulateSubscription plays out a subscription started at startedAt, billing on the interval
+// until end. Subscribers pause, cancel and have payments fail along the way, and cancel for
+// good once their persona stops shopping at activeUntil. Created and renewed events are
+// the ones spawning an order.
+func simulateSubscription(startedAt, activeUntil, end time.Time, interval billingInterval) subscriptionHistory {
+	history := subscriptionHistory{Status: SubscriptionActive}
+	record := func(eventType string, at time.Time) {
+		history.Events = append(history.Events, SubscriptionEvent{EventType: eventType, OccurredAt: at})
+	}
+	cancel := func(at time.Time) {
+		record(SubscriptionEventCancelled, at)
+		history.Status = SubscriptionCancelled
+		history.CancelledAt = sql.NullTime{Time: at, Valid: true}
+	}
+	between := func(from, to time.Time) time.Time {
+		return from.Add(time.Duration(random.Int63n(int64(to.Sub(from))))).Truncate(time.Second)
+	}
+
+	record(SubscriptionEventCreated, startedAt)
+	billedAt := startedAt
+	for {
+		next := interval.after(billedAt)
+		if next.After(end) {
+			history.NextBillingDate = sql.NullTime{Time: next, Valid: true}
+			return history
+		}
+		if next.After(activeUntil) {
+			cancel(between(billedAt, next))
+			return history
+		}
+
+		switch n := random.Float64(); {
+		case n < subscriptionCancelRate:
+			cancel(between(billedAt, next))
+			return history
+		case n < subscriptionCancelRate+subscriptionPauseRate:
+			// Pausing skips one to three deliveries
+			pausedAt := between(billedAt, next)
+			record(SubscriptionEventPaused, pausedAt)
+			for skipped := 1 + random.Intn(3); skipped > 0; skipped-- {
+				next = interval.after(next)
+			}
+			if next.After(end) {
+				history.Status = SubscriptionPaused
+				history.NextBillingDate = sql.NullTime{Time: next, Valid: true}
+				return history
+			}
+			if next.After(activeUntil) {
+				cancel(between(pausedAt, next))
+				return history
+			}
+			record(SubscriptionEventResumed, between(pausedAt, next))
+		}
+
+		// Failed payments are retried, and the subscription is cancelled when every retry fails
+		paidAt := next
+		if random.Float64() < paymentFailureRate {
+			paid := false
+			for retry := 0; retry <= paymentRetries && !paid; retry++ {
+				attempt := next.AddDate(0, 0, retry*paymentRetryDays)
+				if attempt.After(end) {
+					history.Status = SubscriptionPastDue
+					history.NextBillingDate = sql.NullTime{Time: attempt, Valid: true}
+					return history
+				}
+				if retry > 0 && random.Float64() < paymentRetrySuccessRate {
+					paid, paidAt = true, attempt
+				} else {
+					record(SubscriptionEventPaymentFailed, attempt)
+				}
+			}
+			if !paid {
+				cancel(next.AddDate(0, 0, paymentRetries*paymentRetryDays))
+				return history
+			}
+		}
+		record(SubscriptionEventRenewed, paidAt)
+		billedAt = paidAt
+	}
+}
+
+// GenerateSubscriptions generates n fake subscriptions to consumable products and inserts
+// them into the database, along with their history and the recurring orders they spawn
+// over the time window. Each renewal is billed at the list price of the day less the plan
+// discount, in the local currency of the shipping address.
+func GenerateSubscriptions(db *sql.DB, count int, timeline *timedist.Distribution, baseCurrency money.Currency) error {
+	// Get the users able to subscribe, weighted by how often they order
+	users, err := GetUserPersonas(db)
+	if err != nil {
+		return err
+	}
+	userIDs := make([]int, len(users))
+	for i, user := range users {
+		userIDs[i] = user.UserID
+	}
+	userAddresses, err := GetRandomAddressIDsByUser(db, userIDs)
+	if err != nil {
+		return err
+	}
+
+	eligibleUsers := make([]UserPersona, 0, len(users))
+	frequencies := make([]float64, 0, len(users))
+	for _, user := range users {
+		if _, ok := userAddresses[user.UserID]; !ok {
+			continue
+		}
+		if from, to := user.Persona.ActiveWindow(timeline, user.SignedUpAt); !to.After(from) {
+			continue
+		}
+		eligibleUsers = append(eligibleUsers, user)
+		frequencies = append(frequencies, user.Persona.OrderFrequency)
+	}
+	if len(eligibleUsers) == 0 {
+		return fmt.Errorf("no users with addresses found to subscribe")
+	}
+	userChooser := newWeightedChooser(frequencies)
+
+	addressIDs := make([]int, 0, len(userAddresses))
+	for _, addressID := range userAddresses {
+		addressIDs = append(addressIDs, addressID)
+	}
+	addressRegions, err := GetAddressRegions(db, addressIDs)
+	if err != nil {
+		return err
+	}
+
+	products, err := getSubscribableProducts(db)
+	if err != nil {
+		return err
+	}
+	if len(products) == 0 {
+		return fmt.Errorf("no products with variants found to subscribe to")
+	}
+
+	exchangeRates, err := GetExchangeRates(db, baseCurrency)
+	if err != nil {
+		return err
+	}
+
+	subscriptionStmt, err := db.Prepare(`
+		INSERT INTO subscriptions (
+			user_id, product_id, variant_id, quantity, plan, billing_interval, status,
+			shipping_address_id, payment_method, next_billing_date, started_at, cancelled_at, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $11, $13)
+		RETURNING id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare subscription statement: %w", err)
+	}
+	defer subscriptionStmt.Close()
+
+	eventStmt, err := db.Prepare(`
+		INSERT INTO subscription_events (subscription_id, event_type, order_id, occurred_at)
+		VALUES ($1, $2, $3, $4)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare subscription event statement: %w", err)
+	}
+	defer eventStmt.Close()
+
+	writer, err := newOrderWriter(db)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(count).
+		WithTitle(fmt.Sprintf("Generating %d subscriptions...", count)).
+		Start()
+
+	for i := 0; i < count; i++ {
+		user := eligibleUsers[userChooser.Choose()]
+		addressID := userAddresses[user.UserID]
+		from, activeUntil := user.Persona.ActiveWindow(timeline, user.SignedUpAt)
+		startedAt := timeline.SampleBetween(from, activeUntil)
+
+		product := products[random.Intn(len(products))]
+		variant := product.Variants[random.Intn(len(product.Variants))]
+		quantity := 1 + random.Intn(3)
+		plan := subscriptionPlans[random.Intn(len(subscriptionPlans))]
+		interval := billingIntervals[random.Intn(len(billingIntervals))]
+
+		// Recurring payments need a stored payment method
+		paymentMethod := faker.PaymentMethod()
+		for paymentMethod == "Cash on Delivery" || paymentMethod == "Bank Transfer" {
+			paymentMethod = faker.PaymentMethod()
+		}
+
+		history := simulateSubscription(startedAt, activeUntil, timeline.End, interval)
+		updatedAt := history.Events[len(history.Events)-1].OccurredAt
+
+		var subscriptionID int64
+		err := subscriptionStmt.QueryRow(
+			user.UserID, product.ID, variant.ID, quantity, plan.Name, interval.Name, history.Status,
+			addressID, paymentMethod, history.NextBillingDate, startedAt, history.CancelledAt, updatedAt,
+		).Scan(&subscriptionID)
+		if err != nil {
+			return fmt.Errorf("failed to insert subscription: %w", err)
+		}
+
+		region := addressRegions[addressID]
+		for _, event := range history.Events {
+			var orderID sql.NullInt64
+			if event.EventType == SubscriptionEventCreated || event.EventType == SubscriptionEventRenewed {
+				billedAt := event.OccurredAt
+				fx, err := exchangeRates.Conversion(money.CurrencyForCountry(region.Country, baseCurrency), billedAt)
+				if err != nil {
+					return err
+				}
+
+				unitPrice := product.PriceAt(billedAt) + variant.PriceDelta
+				unitPrice -= unitPrice.BasisPoints(plan.BasisPoints).Round(baseCurrency)
+				lines := []OrderLine{{
+					ProductID:    product.ID,
+					VariantID:    variant.ID,
+					SellerID:     product.SellerID,
+					Quantity:     quantity,
+					PricePerUnit: fx.Apply(unitPrice),
+					BillableKg:   product.BillableKg,
+				}}
+
+				// Orders from the last day are still being processed
+				status := "Delivered"
+				if billedAt.After(timeline.End.Add(-24 * time.Hour)) {
+					status = "Processing"
+				}
+				trackingNumber := sql.NullString{String: faker.TrackingNumber(), Valid: status != "Processing"}
+				shipments, status, deliveredAt := planShipments(lines, billedAt, status, plan.ShippingMethod, trackingNumber, timeline.End)
+
+				id, err := writer.write(orderDraft{
+					UserID:            user.UserID,
+					SubscriptionID:    sql.NullInt64{Int64: subscriptionID, Valid: true},
+					Status:            status,
+					FX:                fx,
+					Totals:            PriceOrder(lines, plan.ShippingMethod, region, nil, baseCurrency, fx),
+					ShippingAddressID: addressID,
+					BillingAddressID:  addressID,
+					PaymentMethod:     paymentMethod,
+					ShippingMethod:    plan.ShippingMethod,
+					TrackingNumber:    trackingNumber,
+					DeliveredAt:       deliveredAt,
+					CreatedAt:         billedAt,
+					Lines:             lines,
+					Shipments:         shipments,
+				})
+				if err != nil {
+					return err
+				}
+				orderID = sql.NullInt64{Int64: int64(id), Valid: true}
+			}
+
+			if _, err := eventStmt.Exec(subscriptionID, event.EventType, orderID, event.OccurredAt); err != nil {
+				return fmt.Errorf("failed to insert subscription event: %w", err)
+			}
+		}
+
+		progressBar.Increment()
+	}
+
+	return nil
+}
+
+// getSubscribableProducts returns catalog products from consumable departments, or from the
+// whole catalog when there are none
+func getSubscribableProducts(db *sql.DB) ([]catalogProduct, error) {
+	productIDs, err := GetRandomProductIDs(db, 200)
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := getCatalogProducts(db, productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	categoryIDs := make([]int, 0, len(catalog))
+	for _, product := range catalog {
+		categoryIDs = append(categoryIDs, product.CategoryID)
+	}
+	categoryPaths, err := GetCategoryPaths(db, categoryIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var all, consumables []catalogProduct
+	for _, product := range catalog {
+		all = append(all, product)
+		if path := categoryPaths[product.CategoryID]; len(path) > 0 && consumableDepartments[path[0]] {
+			consumables = append(consumables, product)
+		}
+	}
+	if len(consumables) == 0 {
+		return all, nil
+	}
+	return consumables, nil
+}
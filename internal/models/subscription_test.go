@@ -0,0 +1,71 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSimulateSubscription plays out many subscriptions and checks their histories are
+// consistent: events in order within the time window, and a final status matching them
+func TestSimulateSubscription(t *testing.T) {
+	startedAt := time.Date(2024, 1, 10, 14, 30, 0, 0, time.UTC)
+	end := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, interval := range billingIntervals {
+		for run := 0; run < 500; run++ {
+			activeUntil := end
+			if run%3 == 0 {
+				activeUntil = startedAt.AddDate(0, 4, 0)
+			}
+			history := simulateSubscription(startedAt, activeUntil, end, interval)
+
+			if len(history.Events) == 0 || history.Events[0].EventType != SubscriptionEventCreated {
+				t.Fatalf("%s: history doesn't start with a created event: %+v", interval.Name, history.Events)
+			}
+			if !history.Events[0].OccurredAt.Equal(startedAt) {
+				t.Fatalf("%s: created at %v, want %v", interval.Name, history.Events[0].OccurredAt, startedAt)
+			}
+			for i, event := range history.Events {
+				if event.OccurredAt.After(end) {
+					t.Fatalf("%s: %s event at %v after the end", interval.Name, event.EventType, event.OccurredAt)
+				}
+				if i > 0 && event.OccurredAt.Before(history.Events[i-1].OccurredAt) {
+					t.Fatalf("%s: events out of order: %+v", interval.Name, history.Events)
+				}
+			}
+
+			last := history.Events[len(history.Events)-1]
+			switch history.Status {
+			case SubscriptionCancelled:
+				if last.EventType != SubscriptionEventCancelled || !history.CancelledAt.Valid || !history.CancelledAt.Time.Equal(last.OccurredAt) {
+					t.Fatalf("%s: cancelled subscription ends with %s at %v, cancelled at %v",
+						interval.Name, last.EventType, last.OccurredAt, history.CancelledAt)
+				}
+				if history.NextBillingDate.Valid {
+					t.Fatalf("%s: cancelled subscription still has a next billing date", interval.Name)
+				}
+			case SubscriptionActive, SubscriptionPaused, SubscriptionPastDue:
+				if history.CancelledAt.Valid {
+					t.Fatalf("%s: %s subscription has a cancellation date", interval.Name, history.Status)
+				}
+				if !history.NextBillingDate.Valid || !history.NextBillingDate.Time.After(end) {
+					t.Fatalf("%s: %s subscription next billed at %v, want after the end",
+						interval.Name, history.Status, history.NextBillingDate)
+				}
+			default:
+				t.Fatalf("%s: unexpected status %q", interval.Name, history.Status)
+			}
+			if history.Status == SubscriptionPaused && last.EventType != SubscriptionEventPaused {
+				t.Fatalf("%s: paused subscription ends with %s", interval.Name, last.EventType)
+			}
+
+			// Orders are only spawned while the subscriber is still shopping
+			for _, event := range history.Events {
+				if event.EventType == SubscriptionEventRenewed && event.OccurredAt.After(activeUntil.AddDate(0, 0, paymentRetries*paymentRetryDays)) {
+					t.Fatalf("%s: renewed at %v after the subscriber stopped shopping at %v",
+						interval.Name, event.OccurredAt, activeUntil)
+				}
+			}
+		}
+	}
+}
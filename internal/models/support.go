@@ -0,0 +1,356 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"database-test/pkg/faker"
+	"database-test/pkg/timedist"
+
+	"github.com/pterm/pterm"
+)
+
+// Support ticket statuses
+const (
+	TicketOpen    = "Open"
+	TicketPending = "Pending"
+	TicketSolved  = "Solved"
+	TicketClosed  = "Closed"
+)
+
+// problematicTicketShare is the fraction of tickets opened about a problematic order, the
+// rest being general questions
+const problematicTicketShare = 0.8
+
+// SupportTicket represents a customer's request for help, often about an order
+type SupportTicket struct {
+	ID              int
+	UserID          int
+	OrderID         sql.NullInt64
+	Subject         string
+	Category        string
+	Priority        string
+	Status          string
+	Channel         string
+	AssignedAgentID sql.NullInt64
+	OpenedAt        time.Time
+	FirstResponseAt sql.NullTime
+	ResolvedAt      sql.NullTime
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// TicketMessage represents a message in a support conversation, from the customer or an agent
+type TicketMessage struct {
+	ID         int
+	TicketID   int
+	AuthorType string
+	AgentID    sql.NullInt64
+	Body       string
+	SentAt     time.Time
+	CreatedAt  time.Time
+}
+
+// ticketOrder holds the order details needed to open a ticket about it
+type ticketOrder struct {
+	ID             int
+	UserID         int
+	FirstName      string
+	Status         string
+	ShippingMethod string
+	ProductName    string
+	SignedUpAt     time.Time
+	CreatedAt      time.Time
+	DeliveredAt    sql.NullTime
+}
+
+// GenerateSupportTickets generates n fake support tickets and their conversations and inserts
+// them into the database. Most tickets are about problematic orders: cancelled and refunded
+// orders, and orders delivered later than their shipping method promised. Each ticket is
+// opened when the problem would be noticed, answered after a delay depending on the
+// channel, and nothing happens after the end of the time window.
+func GenerateSupportTickets(db *sql.DB, count int, timeline *timedist.Distribution) error {
+	orders, err := getTicketOrders(db)
+	if err != nil {
+		return err
+	}
+	if len(orders) == 0 {
+		return fmt.Errorf("no orders found to open tickets about")
+	}
+	agents, err := getStaff(db, StaffSupport)
+	if err != nil {
+		return err
+	}
+
+	// Problematic orders get tickets first
+	var problematic []ticketOrder
+	for _, order := range orders {
+		if ticketTopic(order) != faker.TicketOrderStatus {
+			problematic = append(problematic, order)
+		}
+	}
+	random.Shuffle(len(problematic), func(i, j int) { problematic[i], problematic[j] = problematic[j], problematic[i] })
+
+	ticketStmt, err := db.Prepare(`
+		INSERT INTO support_tickets (
+			user_id, order_id, subject, category, priority, status, channel, assigned_agent_id,
+			opened_at, first_response_at, resolved_at, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $9, $12)
+		RETURNING id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare ticket statement: %w", err)
+	}
+	defer ticketStmt.Close()
+
+	messageStmt, err := db.Prepare(`
+		INSERT INTO ticket_messages (ticket_id, author_type, agent_id, body, sent_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare message statement: %w", err)
+	}
+	defer messageStmt.Close()
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(count).
+		WithTitle(fmt.Sprintf("Generating %d support tickets...", count)).
+		Start()
+
+	for i := 0; i < count; i++ {
+		progressBar.Increment()
+
+		var order ticketOrder
+		if len(problematic) > 0 && random.Float64() < problematicTicketShare {
+			order, problematic = problematic[len(problematic)-1], problematic[:len(problematic)-1]
+		} else {
+			order = orders[random.Intn(len(orders))]
+		}
+
+		// General questions about an order that's fine are sometimes not about the order at
+		// all, and so are tickets about problems that would only be noticed after the time
+		// window. Those are asked any time after the customer signed up.
+		topic := ticketTopic(order)
+		orderID := sql.NullInt64{Int64: int64(order.ID), Valid: true}
+		orderRef := fmt.Sprintf("#%d", order.ID)
+		openedAt := ticketOpenTime(order, topic, timeline)
+		if (topic == faker.TicketOrderStatus && random.Float64() < 0.4) || openedAt.After(timeline.End) {
+			topic = faker.TicketProductQuestion
+			if random.Float64() < 0.4 {
+				topic = faker.TicketAccount
+			}
+			orderID, orderRef = sql.NullInt64{}, ""
+			openedAt = timeline.SampleBetween(order.SignedUpAt, timeline.End)
+		}
+
+		channel := pickChannel()
+		priority := ticketPriority(topic)
+
+		// Assign an agent who worked here at the time
+		agent := pickStaff(agents, openedAt)
+		var agentID sql.NullInt64
+		if agent != nil {
+			agentID = sql.NullInt64{Int64: int64(agent.ID), Valid: true}
+		}
+
+		// Customers open the ticket, agents answer after a delay, and a few messages go back
+		// and forth until the ticket is solved or the time window ends
+		type message struct {
+			FromAgent bool
+			Body      string
+			SentAt    time.Time
+		}
+		messages := []message{{Body: faker.CustomerTicketMessage(topic, orderRef, order.ProductName), SentAt: openedAt}}
+		status := TicketOpen
+		var firstResponseAt, resolvedAt sql.NullTime
+		at := openedAt
+		for exchange := 0; agent != nil; exchange++ {
+			at = at.Add(responseDelay(channel, priority))
+			if at.After(timeline.End) {
+				break
+			}
+			messages = append(messages, message{FromAgent: true, Body: faker.AgentTicketReply(order.FirstName, agent.FirstName, orderRef), SentAt: at})
+			if !firstResponseAt.Valid {
+				firstResponseAt = sql.NullTime{Time: at, Valid: true}
+			}
+			status = TicketPending
+
+			// Most conversations end after an answer or two
+			if exchange >= 2 || random.Float64() < 0.55 {
+				if random.Float64() < 0.9 {
+					status = TicketSolved
+					resolvedAt = sql.NullTime{Time: at, Valid: true}
+				}
+				break
+			}
+
+			at = at.Add(time.Duration(10+random.Intn(24*60)) * time.Minute)
+			if at.After(timeline.End) {
+				break
+			}
+			messages = append(messages, message{Body: faker.CustomerFollowUp(), SentAt: at})
+			status = TicketOpen
+		}
+
+		// Solved tickets close automatically after a week without reply
+		if status == TicketSolved && resolvedAt.Time.AddDate(0, 0, 7).Before(timeline.End) {
+			status = TicketClosed
+		}
+		updatedAt := messages[len(messages)-1].SentAt
+
+		var ticketID int
+		err := ticketStmt.QueryRow(
+			order.UserID, orderID, faker.TicketSubject(topic, orderRef), topic, priority, status, channel, agentID,
+			openedAt, firstResponseAt, resolvedAt, updatedAt,
+		).Scan(&ticketID)
+		if err != nil {
+			return fmt.Errorf("failed to insert support ticket: %w", err)
+		}
+
+		for _, m := range messages {
+			authorType, messageAgentID := "customer", sql.NullInt64{}
+			if m.FromAgent {
+				authorType, messageAgentID = "agent", agentID
+			}
+			if _, err := messageStmt.Exec(ticketID, authorType, messageAgentID, m.Body, m.SentAt); err != nil {
+				return fmt.Errorf("failed to insert ticket message: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isLate reports whether an order was delivered after its shipping method's advertised time
+func (o ticketOrder) isLate() bool {
+	return o.DeliveredAt.Valid && o.DeliveredAt.Time.After(o.expectedBy())
+}
+
+// expectedBy returns the end of the day the order was advertised to arrive
+func (o ticketOrder) expectedBy() time.Time {
+	return o.CreatedAt.Truncate(24*time.Hour).AddDate(0, 0, expectedDeliveryDays[o.ShippingMethod]+1)
+}
+
+// ticketTopic returns what a customer would contact support about for an order
+func ticketTopic(order ticketOrder) string {
+	switch {
+	case order.Status == "Cancelled":
+		return faker.TicketCancellation
+	case order.Status == "Refunded":
+		if random.Float64() < 0.3 {
+			return faker.TicketDamagedItem
+		}
+		return faker.TicketRefund
+	case order.isLate():
+		return faker.TicketLateDelivery
+	default:
+		return faker.TicketOrderStatus
+	}
+}
+
+// ticketOpenTime returns when a customer notices the problem with an order and contacts support
+func ticketOpenTime(order ticketOrder, topic string, timeline *timedist.Distribution) time.Time {
+	after := func(from time.Time, maxHours int) time.Time {
+		return from.Add(time.Duration(10+random.Intn(maxHours*60)) * time.Minute).Truncate(time.Second)
+	}
+
+	switch topic {
+	case faker.TicketLateDelivery:
+		// Between the expected date and the actual delivery
+		expected := order.expectedBy()
+		window := order.DeliveredAt.Time.Sub(expected)
+		return expected.Add(time.Duration(random.Int63n(int64(window)))).Truncate(time.Second)
+	case faker.TicketCancellation:
+		return after(order.CreatedAt, 48)
+	case faker.TicketRefund, faker.TicketDamagedItem:
+		if order.DeliveredAt.Valid {
+			return after(order.DeliveredAt.Time, 10*24)
+		}
+		return after(order.CreatedAt, 5*24)
+	default:
+		return after(order.CreatedAt, 5*24)
+	}
+}
+
+// ticketPriority returns a priority for a ticket on the topic
+func ticketPriority(topic string) string {
+	switch topic {
+	case faker.TicketDamagedItem, faker.TicketLateDelivery:
+		if random.Float64() < 0.2 {
+			return "Urgent"
+		}
+		return "High"
+	case faker.TicketRefund, faker.TicketCancellation:
+		return "High"
+	case faker.TicketAccount:
+		return "Low"
+	default:
+		return "Normal"
+	}
+}
+
+// pickChannel returns how a customer contacts support
+func pickChannel() string {
+	switch n := random.Float64(); {
+	case n < 0.5:
+		return "Email"
+	case n < 0.85:
+		return "Chat"
+	default:
+		return "Phone"
+	}
+}
+
+// responseDelay returns how long an agent takes to answer on a channel. Chat and phone are
+// answered within minutes, email within hours and faster for urgent tickets.
+func responseDelay(channel, priority string) time.Duration {
+	switch channel {
+	case "Phone":
+		return time.Duration(30+random.Intn(300)) * time.Second
+	case "Chat":
+		return time.Duration(1+random.Intn(15)) * time.Minute
+	}
+	maxHours := 48
+	switch priority {
+	case "Urgent":
+		maxHours = 4
+	case "High":
+		maxHours = 12
+	}
+	return time.Duration(15+random.Intn(maxHours*60)) * time.Minute
+}
+
+// getTicketOrders returns every order along with its customer's first name and signup time,
+// and its first product
+func getTicketOrders(db *sql.DB) ([]ticketOrder, error) {
+	rows, err := db.Query(`
+		SELECT o.id, o.user_id, u.first_name, o.status, o.shipping_method, u.created_at, o.created_at, o.delivered_at,
+			COALESCE((
+				SELECT p.name FROM order_items oi JOIN products p ON p.id = oi.product_id
+				WHERE oi.order_id = o.id ORDER BY oi.id LIMIT 1
+			), '')
+		FROM orders o
+		JOIN users u ON u.id = o.user_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []ticketOrder
+	for rows.Next() {
+		var order ticketOrder
+		if err := rows.Scan(
+			&order.ID, &order.UserID, &order.FirstName, &order.Status, &order.ShippingMethod,
+			&order.SignedUpAt, &order.CreatedAt, &order.DeliveredAt, &order.ProductName,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"database-test/pkg/faker"
+
+	"github.com/pterm/pterm"
+)
+
+// Tenant represents a store hosted on the multi-tenant platform
+type Tenant struct {
+	ID        int
+	Name      string
+	Slug      string
+	Plan      string
+	Scale     float64 // Size of the tenant's data relative to the largest tenant, not stored
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// GenerateTenants generates n fake tenants, inserts them into the database and returns them.
+// Tenant sizes follow a Zipf-like distribution: the kth tenant is 1/k^sizeSkew the size of
+// the first, and its plan matches its size.
+func GenerateTenants(db *sql.DB, count int, sizeSkew float64) ([]Tenant, error) {
+	slugs, err := getTenantSlugs(db)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := db.Prepare(`
+		INSERT INTO tenants (name, slug, plan)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(count).
+		WithTitle(fmt.Sprintf("Generating %d tenants...", count)).
+		Start()
+
+	tenants := make([]Tenant, 0, count)
+	for i := 0; i < count; i++ {
+		tenant := Tenant{
+			Name:  faker.CompanyName(),
+			Scale: 1 / math.Pow(float64(i+1), sizeSkew),
+		}
+
+		tenant.Slug = faker.Slug(tenant.Name)
+		for n := 2; slugs[tenant.Slug]; n++ {
+			tenant.Slug = fmt.Sprintf("%s-%d", faker.Slug(tenant.Name), n)
+		}
+		slugs[tenant.Slug] = true
+
+		switch {
+		case tenant.Scale >= 0.5:
+			tenant.Plan = "enterprise"
+		case tenant.Scale >= 0.2:
+			tenant.Plan = "business"
+		default:
+			tenant.Plan = "starter"
+		}
+
+		err := stmt.QueryRow(tenant.Name, tenant.Slug, tenant.Plan).Scan(&tenant.ID, &tenant.CreatedAt, &tenant.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert tenant: %w", err)
+		}
+		tenants = append(tenants, tenant)
+		progressBar.Increment()
+	}
+
+	return tenants, nil
+}
+
+// getTenantSlugs returns the slugs already taken by existing tenants
+func getTenantSlugs(db *sql.DB) (map[string]bool, error) {
+	rows, err := db.Query("SELECT slug FROM tenants")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenant slugs: %w", err)
+	}
+	defer rows.Close()
+
+	slugs := make(map[string]bool)
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return nil, fmt.Errorf("failed to scan tenant slug: %w", err)
+		}
+		slugs[slug] = true
+	}
+
+	return slugs, nil
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"time"
 
+	"database-test/pkg/timedist"
+
 	gofaker "github.com/go-faker/faker/v4"
 	"github.com/pterm/pterm"
 )
@@ -19,15 +21,17 @@ type User struct {
 	FirstName    string
 	LastName     string
 	Phone        string
+	Status       string
+	DeletedAt    sql.NullTime
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 }
 
-// GenerateUsers generates n fake users and inserts them into the database
-func GenerateUsers(db *sql.DB, count int) error {
+// GenerateUsers generates n fake users, assigns each a persona and inserts them into the database
+func GenerateUsers(db *sql.DB, count int, timeline *timedist.Distribution) error {
 	stmt, err := db.Prepare(`
-		INSERT INTO users (email, password_hash, first_name, last_name, phone)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO users (email, password_hash, first_name, last_name, phone, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
 		RETURNING id
 	`)
 	if err != nil {
@@ -35,6 +39,15 @@ func GenerateUsers(db *sql.DB, count int) error {
 	}
 	defer stmt.Close()
 
+	segmentStmt, err := db.Prepare(`
+		INSERT INTO user_segments (user_id, segment, created_at)
+		VALUES ($1, $2, $3)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare segment statement: %w", err)
+	}
+	defer segmentStmt.Close()
+
 	// Create a progress bar
 	progressBar, _ := pterm.DefaultProgressbar.
 		WithTotal(count).
@@ -48,8 +61,12 @@ func GenerateUsers(db *sql.DB, count int) error {
 		lastName := gofaker.LastName()
 		phone := gofaker.Phonenumber()
 
+		// The persona decides when the user signed up, so churned users aren't brand new
+		persona := RandomPersona()
+		createdAt := persona.SignupTime(timeline)
+
 		var id int
-		err := stmt.QueryRow(email, passwordHash, firstName, lastName, phone).Scan(&id)
+		err := stmt.QueryRow(email, passwordHash, firstName, lastName, phone, createdAt).Scan(&id)
 		if err != nil {
 			// If it's a duplicate email, try again
 			if err.Error() == "pq: duplicate key value violates unique constraint \"users_email_key\"" {
@@ -59,15 +76,20 @@ func GenerateUsers(db *sql.DB, count int) error {
 			return fmt.Errorf("failed to insert user: %w", err)
 		}
 
+		// Record the persona that drives this user's purchase behavior
+		if _, err := segmentStmt.Exec(id, persona.Name, createdAt); err != nil {
+			return fmt.Errorf("failed to insert user segment: %w", err)
+		}
+
 		progressBar.Increment()
 	}
 
 	return nil
 }
 
-// GetRandomUserIDs returns n random user IDs from the database
+// GetRandomUserIDs returns n random user IDs from the database, skipping deleted users
 func GetRandomUserIDs(db *sql.DB, count int) ([]int, error) {
-	rows, err := db.Query("SELECT id FROM users ORDER BY RANDOM() LIMIT $1", count)
+	rows, err := db.Query("SELECT id FROM users WHERE deleted_at IS NULL ORDER BY RANDOM() LIMIT $1", count)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get random user IDs: %w", err)
 	}
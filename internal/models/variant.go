@@ -0,0 +1,132 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"database-test/pkg/faker"
+	"database-test/pkg/money"
+
+	"github.com/lib/pq"
+)
+
+// ProductVariant represents a purchasable variation of a product, such as a size and color
+type ProductVariant struct {
+	ID            int
+	ProductID     int
+	SKU           string
+	Name          string
+	Options       map[string]string
+	PriceDelta    money.Amount
+	StockQuantity int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// randomVariants returns up to maxVariants distinct combinations of the category's variant
+// options. Products without options get a single standard variant.
+func randomVariants(category string, maxVariants int, baseCurrency money.Currency) []ProductVariant {
+	combinations := []ProductVariant{{Name: "Standard", Options: map[string]string{}}}
+	for _, option := range faker.VariantOptions(category) {
+		// Products only come in some of the option values
+		values := make([]faker.OptionValue, len(option.Values))
+		copy(values, option.Values)
+		random.Shuffle(len(values), func(i, j int) { values[i], values[j] = values[j], values[i] })
+		values = values[:1+random.Intn(len(values))]
+
+		var next []ProductVariant
+		for _, combination := range combinations {
+			for _, value := range values {
+				options := make(map[string]string, len(combination.Options)+1)
+				for name, v := range combination.Options {
+					options[name] = v
+				}
+				options[option.Name] = value.Value
+				next = append(next, ProductVariant{
+					Options:    options,
+					PriceDelta: combination.PriceDelta + fromUSD(money.FromFloat(value.PriceDelta), baseCurrency),
+				})
+			}
+		}
+		combinations = next
+	}
+
+	random.Shuffle(len(combinations), func(i, j int) { combinations[i], combinations[j] = combinations[j], combinations[i] })
+	if maxVariants < 1 {
+		maxVariants = 1
+	}
+	if len(combinations) > maxVariants {
+		combinations = combinations[:maxVariants]
+	}
+
+	for i := range combinations {
+		if len(combinations[i].Options) > 0 {
+			combinations[i].Name = variantName(category, combinations[i].Options)
+		}
+		combinations[i].StockQuantity = random.Intn(300)
+	}
+	return combinations
+}
+
+// variantName joins a variant's option values in the order the category defines them
+func variantName(category string, options map[string]string) string {
+	var parts []string
+	for _, option := range faker.VariantOptions(category) {
+		if value, ok := options[option.Name]; ok {
+			parts = append(parts, value)
+		}
+	}
+	return strings.Join(parts, " / ")
+}
+
+// insertVariants inserts the variants of a product, numbering their SKUs after the product's
+func insertVariants(stmt *sql.Stmt, productID int, productSKU string, variants []ProductVariant) error {
+	for i, variant := range variants {
+		options, err := json.Marshal(variant.Options)
+		if err != nil {
+			return fmt.Errorf("failed to encode variant options: %w", err)
+		}
+
+		_, err = stmt.Exec(
+			productID, faker.VariantSKU(productSKU, i+1), variant.Name, string(options),
+			variant.PriceDelta, variant.StockQuantity,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert product variant: %w", err)
+		}
+	}
+	return nil
+}
+
+// catalogVariant holds the variant details needed to build order lines
+type catalogVariant struct {
+	ID         int
+	PriceDelta money.Amount
+}
+
+// getCatalogVariants returns the variants of the given products keyed by product ID
+func getCatalogVariants(db *sql.DB, productIDs []int) (map[int][]catalogVariant, error) {
+	rows, err := db.Query(
+		"SELECT id, product_id, price_delta FROM product_variants WHERE product_id = ANY($1) ORDER BY id",
+		pq.Array(productIDs),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product variants: %w", err)
+	}
+	defer rows.Close()
+
+	variants := make(map[int][]catalogVariant)
+	for rows.Next() {
+		var variant catalogVariant
+		var productID int
+		if err := rows.Scan(&variant.ID, &productID, &variant.PriceDelta); err != nil {
+			return nil, fmt.Errorf("failed to scan product variant: %w", err)
+		}
+		variants[productID] = append(variants[productID], variant)
+	}
+
+	return variants, nil
+}
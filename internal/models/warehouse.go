@@ -0,0 +1,342 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"database-test/pkg/geo"
+
+	"github.com/pterm/pterm"
+)
+
+// Warehouse represents a fulfillment center holding stock
+type Warehouse struct {
+	ID        int
+	Code      string
+	Name      string
+	City      string
+	Country   string
+	Latitude  float64
+	Longitude float64
+	CreatedAt time.Time
+}
+
+// WarehouseStock represents the stock of a product or variant held in a warehouse
+type WarehouseStock struct {
+	ID          int
+	WarehouseID int
+	ProductID   int
+	VariantID   sql.NullInt64
+	Quantity    int
+	UpdatedAt   time.Time
+}
+
+// warehouseSite is a location warehouses are opened at
+type warehouseSite struct {
+	Code     string
+	City     string
+	Country  string
+	Location geo.Point
+}
+
+// warehouseSites lists where warehouses are opened, in order, so a handful of warehouses
+// already covers both US coasts and Europe
+var warehouseSites = []warehouseSite{
+	{"EWR1", "Newark", "US", geo.Point{Lat: 40.7357, Lon: -74.1724}},
+	{"RNO1", "Reno", "US", geo.Point{Lat: 39.5296, Lon: -119.8138}},
+	{"LEJ1", "Leipzig", "DE", geo.Point{Lat: 51.3397, Lon: 12.3731}},
+	{"DFW1", "Dallas", "US", geo.Point{Lat: 32.7767, Lon: -96.7970}},
+	{"CVT1", "Coventry", "UK", geo.Point{Lat: 52.4068, Lon: -1.5197}},
+	{"ATL1", "Atlanta", "US", geo.Point{Lat: 33.7490, Lon: -84.3880}},
+	{"YYZ1", "Toronto", "CA", geo.Point{Lat: 43.6532, Lon: -79.3832}},
+	{"NRT1", "Tokyo", "JP", geo.Point{Lat: 35.6762, Lon: 139.6503}},
+	{"SYD1", "Sydney", "AU", geo.Point{Lat: -33.8688, Lon: 151.2093}},
+	{"GRU1", "Sao Paulo", "BR", geo.Point{Lat: -23.5505, Lon: -46.6333}},
+	{"ORD1", "Chicago", "US", geo.Point{Lat: 41.8781, Lon: -87.6298}},
+	{"BOM1", "Mumbai", "IN", geo.Point{Lat: 19.0760, Lon: 72.8777}},
+	{"PVG1", "Shanghai", "CN", geo.Point{Lat: 31.2304, Lon: 121.4737}},
+	{"MEX1", "Mexico City", "MX", geo.Point{Lat: 19.4326, Lon: -99.1332}},
+	{"JNB1", "Johannesburg", "ZA", geo.Point{Lat: -26.2041, Lon: 28.0473}},
+	{"MAD1", "Madrid", "ES", geo.Point{Lat: 40.4168, Lon: -3.7038}},
+}
+
+// GenerateWarehouses opens n warehouses at the first sites of warehouseSites and inserts
+// them into the database. Sites already open are left as they are.
+func GenerateWarehouses(db *sql.DB, count int) error {
+	if count > len(warehouseSites) {
+		return fmt.Errorf("at most %d warehouses are supported, got %d", len(warehouseSites), count)
+	}
+
+	stmt, err := db.Prepare(`
+		INSERT INTO warehouses (code, name, city, country, latitude, longitude)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT ON CONSTRAINT warehouses_code_key DO NOTHING
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, site := range warehouseSites[:count] {
+		name := site.City + " Fulfillment Center"
+		if _, err := stmt.Exec(site.Code, name, site.City, site.Country, site.Location.Lat, site.Location.Lon); err != nil {
+			return fmt.Errorf("failed to insert warehouse: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GenerateWarehouseStock spreads the stock of every product and variant over the
+// warehouses. Each item is carried by a random subset of the warehouses, and some of
+// those have run out of it, so the nearest warehouse doesn't always have stock.
+// Quantities add up to the stock_quantity of the product or variant. Items already
+// stocked keep their levels.
+func GenerateWarehouseStock(db *sql.DB) error {
+	warehouses, err := getFulfillmentWarehouses(db)
+	if err != nil {
+		return err
+	}
+	if len(warehouses) == 0 {
+		return fmt.Errorf("no warehouses found to hold stock")
+	}
+
+	rows, err := db.Query(`
+		SELECT p.id, v.id, COALESCE(v.stock_quantity, p.stock_quantity)
+		FROM products p
+		LEFT JOIN product_variants v ON v.product_id = p.id
+		WHERE NOT EXISTS (
+			SELECT 1 FROM warehouse_stock ws
+			WHERE ws.product_id = p.id AND ws.variant_id IS NOT DISTINCT FROM v.id
+		)
+		ORDER BY p.id, v.id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to get product stock: %w", err)
+	}
+	var items []stockKey
+	var quantities []int
+	for rows.Next() {
+		var item stockKey
+		var quantity int
+		if err := rows.Scan(&item.ProductID, &item.VariantID, &quantity); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan product stock: %w", err)
+		}
+		items = append(items, item)
+		quantities = append(quantities, quantity)
+	}
+	rows.Close()
+
+	stmt, err := db.Prepare(`
+		INSERT INTO warehouse_stock (warehouse_id, product_id, variant_id, quantity)
+		VALUES ($1, $2, $3, $4)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(len(items)).
+		WithTitle(fmt.Sprintf("Stocking %d products and variants in %d warehouses...", len(items), len(warehouses))).
+		Start()
+
+	for i, item := range items {
+		carriers := random.Perm(len(warehouses))[:1+random.Intn(len(warehouses))]
+
+		// One in five other carrying warehouses has sold out of the item
+		weights := make([]float64, len(carriers))
+		for j := range weights {
+			if j == 0 || random.Float64() >= 0.2 {
+				weights[j] = 0.2 + random.Float64()
+			}
+		}
+		shares := apportion(quantities[i], weights)
+
+		for j, w := range carriers {
+			if _, err := stmt.Exec(warehouses[w].ID, item.ProductID, item.VariantID, shares[j]); err != nil {
+				return fmt.Errorf("failed to insert warehouse stock: %w", err)
+			}
+		}
+		progressBar.Increment()
+	}
+
+	return nil
+}
+
+// stockKey identifies a product or one of its variants
+type stockKey struct {
+	ProductID int
+	VariantID sql.NullInt64
+}
+
+// fulfillmentWarehouse is a warehouse with its location
+type fulfillmentWarehouse struct {
+	ID       int
+	Location geo.Point
+}
+
+// AssignFulfillment assigns the items of every order being fulfilled to a warehouse: the
+// nearest one to the shipping address with enough stock of the item, falling back to the
+// nearest one with any stock, then to the nearest one carrying it at all. Allocated items
+// draw down the stock left for later orders, so busy items spill over to farther
+// warehouses. Pending and cancelled orders are never allocated and keep no warehouse.
+func AssignFulfillment(db *sql.DB) error {
+	warehouses, err := getFulfillmentWarehouses(db)
+	if err != nil {
+		return err
+	}
+	// Stores without warehouses ship everything from a single stock level
+	if len(warehouses) == 0 {
+		return nil
+	}
+	stock, err := getWarehouseStock(db)
+	if err != nil {
+		return err
+	}
+	items, err := getFulfillmentItems(db)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := db.Prepare("UPDATE order_items SET warehouse_id = $2 WHERE id = $1")
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	// Create a progress bar
+	progressBar, _ := pterm.DefaultProgressbar.
+		WithTotal(len(items)).
+		WithTitle(fmt.Sprintf("Assigning %d order items to warehouses...", len(items))).
+		Start()
+
+	nearest := make([]int, len(warehouses))
+	for _, item := range items {
+		progressBar.Increment()
+
+		for i := range nearest {
+			nearest[i] = i
+		}
+		if item.Destination != nil {
+			sort.SliceStable(nearest, func(a, b int) bool {
+				return geo.Distance(*item.Destination, warehouses[nearest[a]].Location) <
+					geo.Distance(*item.Destination, warehouses[nearest[b]].Location)
+			})
+		}
+
+		levels := stock[item.stockKey]
+		chosen := -1
+		for _, minimum := range []int{item.Quantity, 1, 0} {
+			for _, w := range nearest {
+				if quantity, carried := levels[warehouses[w].ID]; carried && quantity >= minimum {
+					chosen = w
+					break
+				}
+			}
+			if chosen >= 0 {
+				break
+			}
+		}
+		if chosen < 0 {
+			chosen = nearest[0]
+		}
+		if quantity, carried := levels[warehouses[chosen].ID]; carried {
+			levels[warehouses[chosen].ID] = max(0, quantity-item.Quantity)
+		}
+
+		if _, err := stmt.Exec(item.ID, warehouses[chosen].ID); err != nil {
+			return fmt.Errorf("failed to assign order item to a warehouse: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// fulfillmentItem is an order item to ship, with where it's going
+type fulfillmentItem struct {
+	ID int
+	stockKey
+	Quantity    int
+	Destination *geo.Point
+}
+
+// getFulfillmentItems returns the items of orders being fulfilled with the location of
+// their shipping address, if it has one
+func getFulfillmentItems(db *sql.DB) ([]fulfillmentItem, error) {
+	rows, err := db.Query(`
+		SELECT oi.id, oi.product_id, oi.variant_id, oi.quantity, a.latitude, a.longitude
+		FROM order_items oi
+		JOIN orders o ON o.id = oi.order_id
+		JOIN addresses a ON a.id = o.shipping_address_id
+		WHERE o.status NOT IN ('Pending', 'Cancelled') AND oi.warehouse_id IS NULL
+		ORDER BY oi.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []fulfillmentItem
+	for rows.Next() {
+		var item fulfillmentItem
+		var lat, lon sql.NullFloat64
+		if err := rows.Scan(&item.ID, &item.ProductID, &item.VariantID, &item.Quantity, &lat, &lon); err != nil {
+			return nil, fmt.Errorf("failed to scan order item: %w", err)
+		}
+		if lat.Valid && lon.Valid {
+			item.Destination = &geo.Point{Lat: lat.Float64, Lon: lon.Float64}
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// getFulfillmentWarehouses returns every warehouse with its location
+func getFulfillmentWarehouses(db *sql.DB) ([]fulfillmentWarehouse, error) {
+	rows, err := db.Query("SELECT id, latitude, longitude FROM warehouses ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get warehouses: %w", err)
+	}
+	defer rows.Close()
+
+	var warehouses []fulfillmentWarehouse
+	for rows.Next() {
+		var warehouse fulfillmentWarehouse
+		if err := rows.Scan(&warehouse.ID, &warehouse.Location.Lat, &warehouse.Location.Lon); err != nil {
+			return nil, fmt.Errorf("failed to scan warehouse: %w", err)
+		}
+		warehouses = append(warehouses, warehouse)
+	}
+
+	return warehouses, nil
+}
+
+// getWarehouseStock returns the quantity each warehouse holds of every item it carries
+func getWarehouseStock(db *sql.DB) (map[stockKey]map[int]int, error) {
+	rows, err := db.Query("SELECT warehouse_id, product_id, variant_id, quantity FROM warehouse_stock")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get warehouse stock: %w", err)
+	}
+	defer rows.Close()
+
+	stock := make(map[stockKey]map[int]int)
+	for rows.Next() {
+		var warehouseID, quantity int
+		var key stockKey
+		if err := rows.Scan(&warehouseID, &key.ProductID, &key.VariantID, &quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan warehouse stock: %w", err)
+		}
+		if stock[key] == nil {
+			stock[key] = make(map[int]int)
+		}
+		stock[key][warehouseID] = quantity
+	}
+
+	return stock, nil
+}
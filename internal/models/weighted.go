@@ -0,0 +1,64 @@
+package models
+
+import "sort"
+
+// weightedChooser picks indexes with probability proportional to their weights
+type weightedChooser struct {
+	cumulative []float64
+}
+
+// newWeightedChooser builds a chooser over the given non-negative weights
+func newWeightedChooser(weights []float64) *weightedChooser {
+	cumulative := make([]float64, len(weights))
+	total := 0.0
+	for i, weight := range weights {
+		if weight > 0 {
+			total += weight
+		}
+		cumulative[i] = total
+	}
+	return &weightedChooser{cumulative: cumulative}
+}
+
+// Choose returns a random index, or -1 if every weight is zero
+func (c *weightedChooser) Choose() int {
+	if len(c.cumulative) == 0 || c.cumulative[len(c.cumulative)-1] <= 0 {
+		return -1
+	}
+	target := random.Float64() * c.cumulative[len(c.cumulative)-1]
+	return sort.Search(len(c.cumulative), func(i int) bool {
+		return c.cumulative[i] > target
+	})
+}
+
+// apportion splits count into whole shares proportional to the given non-negative weights,
+// using largest remainder rounding so the shares add up to count
+func apportion(count int, weights []float64) []int {
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+
+	shares := make([]int, len(weights))
+	if total <= 0 {
+		return shares
+	}
+
+	remainders := make([]float64, len(weights))
+	order := make([]int, len(weights))
+	assigned := 0
+	for i, weight := range weights {
+		exact := float64(count) * weight / total
+		shares[i] = int(exact)
+		remainders[i] = exact - float64(shares[i])
+		order[i] = i
+		assigned += shares[i]
+	}
+
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for i := 0; assigned < count; i++ {
+		shares[order[i]]++
+		assigned++
+	}
+	return shares
+}
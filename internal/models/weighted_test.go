@@ -0,0 +1,48 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApportion(t *testing.T) {
+	tests := []struct {
+		name    string
+		count   int
+		weights []float64
+		want    []int
+	}{
+		{"even split", 9, []float64{1, 1, 1}, []int{3, 3, 3}},
+		{"proportional split", 10, []float64{3, 1, 1}, []int{6, 2, 2}},
+		{"largest remainders get the leftovers", 10, []float64{1, 1, 1}, []int{4, 3, 3}},
+		{"largest remainder beats a larger weight", 7, []float64{0.1, 0.45, 0.45}, []int{1, 3, 3}},
+		{"zero weights get nothing", 5, []float64{0, 2, 0, 3}, []int{0, 2, 0, 3}},
+		{"every weight zero", 5, []float64{0, 0}, []int{0, 0}},
+		{"nothing to split", 0, []float64{1, 2}, []int{0, 0}},
+		{"no weights", 5, nil, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := apportion(tt.count, tt.weights); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("apportion(%d, %v) = %v, want %v", tt.count, tt.weights, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApportionAddsUp(t *testing.T) {
+	for count := 0; count <= 100; count++ {
+		weights := []float64{0.17, 3.2, 0, 1.05, 9.9, 0.33}
+		total := 0
+		for _, share := range apportion(count, weights) {
+			if share < 0 {
+				t.Fatalf("apportion(%d) gave a negative share", count)
+			}
+			total += share
+		}
+		if total != count {
+			t.Errorf("apportion(%d) shares add up to %d", count, total)
+		}
+	}
+}
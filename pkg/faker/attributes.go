@@ -0,0 +1,188 @@
+package faker
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// OptionValue is one choice of a variant option, such as size "XL"
+type OptionValue struct {
+	Value      string
+	PriceDelta float64 // Added to the product's base price, in US dollars
+}
+
+// Option is a dimension products vary along, such as size or color
+type Option struct {
+	Name   string
+	Values []OptionValue
+}
+
+// attributeSet describes the spec sheet and variant options of a kind of product
+type attributeSet struct {
+	Specs   map[string]func() interface{}
+	Options []Option
+}
+
+// pick returns a generator choosing one of the given values
+func pick(values ...interface{}) func() interface{} {
+	return func() interface{} { return values[rand.Intn(len(values))] }
+}
+
+// between returns a generator of integers between min and max inclusive
+func between(min, max int) func() interface{} {
+	return func() interface{} { return min + rand.Intn(max-min+1) }
+}
+
+// values builds option values that don't change the price
+func values(names ...string) []OptionValue {
+	optionValues := make([]OptionValue, len(names))
+	for i, name := range names {
+		optionValues[i] = OptionValue{Value: name}
+	}
+	return optionValues
+}
+
+var (
+	colorOption = Option{Name: "color", Values: values("Black", "White", "Silver", "Blue", "Red", "Green")}
+	sizeOption  = Option{Name: "size", Values: []OptionValue{
+		{Value: "XS"}, {Value: "S"}, {Value: "M"}, {Value: "L"}, {Value: "XL"}, {Value: "XXL", PriceDelta: 2},
+	}}
+)
+
+// attributeSets holds the attribute set of each top-level category
+var attributeSets = map[string]attributeSet{
+	"Electronics": {
+		Specs: map[string]func() interface{}{
+			"brand":            pick("Voltix", "Nexon", "Auralis", "Kinetic", "Lumio"),
+			"warranty_months":  pick(6, 12, 24, 36),
+			"battery_hours":    between(4, 40),
+			"connectivity":     pick("Bluetooth 5.3", "Wi-Fi 6", "USB-C", "Wi-Fi 6E and Bluetooth"),
+			"energy_rating":    pick("A", "B", "C"),
+			"power_watts":      between(5, 450),
+			"water_resistance": pick("none", "IPX4", "IP67", "IP68"),
+		},
+		Options: []Option{
+			colorOption,
+			{Name: "storage", Values: []OptionValue{
+				{Value: "64GB"}, {Value: "128GB", PriceDelta: 50}, {Value: "256GB", PriceDelta: 100}, {Value: "512GB", PriceDelta: 200},
+			}},
+		},
+	},
+	"Clothing": {
+		Specs: map[string]func() interface{}{
+			"material": pick("100% cotton", "polyester blend", "merino wool", "linen", "organic cotton"),
+			"fit":      pick("slim", "regular", "relaxed", "oversized"),
+			"care":     pick("machine wash cold", "hand wash", "dry clean only"),
+			"gender":   pick("men", "women", "unisex"),
+		},
+		Options: []Option{sizeOption, colorOption},
+	},
+	"Books": {
+		Specs: map[string]func() interface{}{
+			"format":    pick("hardcover", "paperback", "ebook", "audiobook"),
+			"pages":     between(80, 1200),
+			"language":  pick("English", "Spanish", "French", "German"),
+			"publisher": pick("Northwind Press", "Bluebird Books", "Harbor House", "Quill & Co"),
+		},
+	},
+	"Home & Kitchen": {
+		Specs: map[string]func() interface{}{
+			"material":        pick("stainless steel", "cast iron", "ceramic", "bamboo", "glass"),
+			"capacity_liters": pick(0.5, 1, 1.5, 2, 4, 6),
+			"dishwasher_safe": pick(true, false),
+			"assembly":        pick("none", "minimal", "required"),
+		},
+		Options: []Option{colorOption},
+	},
+	"Sports & Outdoors": {
+		Specs: map[string]func() interface{}{
+			"material":     pick("nylon", "aluminum", "carbon fiber", "neoprene"),
+			"weatherproof": pick(true, false),
+			"skill_level":  pick("beginner", "intermediate", "advanced"),
+		},
+		Options: []Option{sizeOption, colorOption},
+	},
+	"Beauty & Personal Care": {
+		Specs: map[string]func() interface{}{
+			"skin_type":         pick("all", "dry", "oily", "sensitive", "combination"),
+			"cruelty_free":      pick(true, false),
+			"fragrance":         pick("unscented", "citrus", "lavender", "vanilla", "sandalwood"),
+			"volume_ml":         pick(30, 50, 100, 250, 500),
+			"vegan":             pick(true, false),
+			"spf":               pick(0, 15, 30, 50),
+			"shelf_life_months": between(6, 36),
+		},
+		Options: []Option{{Name: "volume", Values: []OptionValue{
+			{Value: "50ml"}, {Value: "100ml", PriceDelta: 6}, {Value: "250ml", PriceDelta: 14},
+		}}},
+	},
+	"Toys & Games": {
+		Specs: map[string]func() interface{}{
+			"min_age":            pick(0, 3, 6, 8, 12, 14),
+			"players":            pick("1", "1-2", "2-4", "2-6", "3-8"),
+			"batteries_included": pick(true, false),
+			"playtime_minutes":   between(10, 180),
+		},
+		Options: []Option{colorOption},
+	},
+	"Jewelry": {
+		Specs: map[string]func() interface{}{
+			"finish":   pick("polished", "brushed", "hammered", "matte"),
+			"gemstone": pick("none", "diamond", "sapphire", "emerald", "pearl"),
+			"hallmark": pick(true, false),
+		},
+		Options: []Option{{Name: "metal", Values: []OptionValue{
+			{Value: "Silver"}, {Value: "Gold", PriceDelta: 120}, {Value: "Rose Gold", PriceDelta: 90},
+		}}},
+	},
+	"Tools & Home Improvement": {
+		Specs: map[string]func() interface{}{
+			"power_source":  pick("corded", "cordless 18V", "cordless 20V", "manual"),
+			"voltage":       pick(12, 18, 20, 120, 230),
+			"case_included": pick(true, false),
+		},
+		Options: []Option{{Name: "kit", Values: []OptionValue{
+			{Value: "Tool only"}, {Value: "With battery", PriceDelta: 60}, {Value: "Full kit", PriceDelta: 110},
+		}}},
+	},
+}
+
+// defaultAttributeSet is used for categories without a dedicated attribute set
+var defaultAttributeSet = attributeSet{
+	Specs: map[string]func() interface{}{
+		"brand":           pick("Acme", "Everyday", "Northstar", "Simply", "Evergreen"),
+		"country_origin":  pick("USA", "China", "Germany", "Japan", "Mexico", "Vietnam"),
+		"warranty_months": pick(0, 6, 12),
+	},
+	Options: []Option{colorOption},
+}
+
+// attributeSetFor returns the attribute set of a top-level category
+func attributeSetFor(category string) attributeSet {
+	if set, ok := attributeSets[category]; ok {
+		return set
+	}
+	return defaultAttributeSet
+}
+
+// ProductAttributes returns a random spec sheet for a product in the top-level category
+func ProductAttributes(category string) map[string]interface{} {
+	attributes := make(map[string]interface{})
+	for name, generate := range attributeSetFor(category).Specs {
+		// Spec sheets are rarely complete
+		if rand.Float64() < 0.85 {
+			attributes[name] = generate()
+		}
+	}
+	return attributes
+}
+
+// VariantOptions returns the options products in the top-level category vary along
+func VariantOptions(category string) []Option {
+	return attributeSetFor(category).Options
+}
+
+// VariantSKU returns the SKU of the nth variant of a product
+func VariantSKU(productSKU string, n int) string {
+	return fmt.Sprintf("%s-%02d", productSKU, n)
+}
@@ -2,7 +2,9 @@ package faker
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
+	"strings"
 	"time"
 )
 
@@ -60,38 +62,31 @@ func CountryAbbr() string {
 	return countries[rand.Intn(len(countries))]
 }
 
-// ProductName returns a random product name
-func ProductName() string {
-	adjectives := []string{
+// productAdjectives and productNouns make up product names
+var (
+	productAdjectives = []string{
 		"Premium", "Deluxe", "Luxury", "Basic", "Essential", "Professional",
 		"Advanced", "Smart", "Ultra", "Super", "Mega", "Compact", "Portable",
 		"Wireless", "Digital", "Analog", "Classic", "Modern", "Vintage", "Retro",
 	}
-
-	nouns := []string{
+	productNouns = []string{
 		"Laptop", "Smartphone", "Tablet", "Headphones", "Speaker", "Camera",
 		"Watch", "TV", "Monitor", "Keyboard", "Mouse", "Printer", "Scanner",
 		"Router", "Charger", "Cable", "Adapter", "Case", "Stand", "Holder",
 	}
+)
 
-	return adjectives[rand.Intn(len(adjectives))] + " " + nouns[rand.Intn(len(nouns))]
+// ProductName returns a random product name
+func ProductName() string {
+	return productAdjectives[rand.Intn(len(productAdjectives))] + " " + productNouns[rand.Intn(len(productNouns))]
 }
 
-// ProductDescription returns a random product description
-func ProductDescription() string {
-	descriptions := []string{
-		"This high-quality product is designed to meet all your needs.",
-		"Experience the ultimate performance with this innovative product.",
-		"A reliable solution for everyday use with exceptional durability.",
-		"Combining style and functionality in a compact design.",
-		"The perfect balance of quality, performance, and value.",
-		"Engineered for maximum efficiency and user satisfaction.",
-		"A versatile product suitable for various applications.",
-		"Featuring cutting-edge technology for superior results.",
-		"Designed with user comfort and convenience in mind.",
-		"A must-have addition to your collection of premium products.",
-	}
-	return descriptions[rand.Intn(len(descriptions))]
+// ProductDescription returns a random description of the named product in its category
+func ProductDescription(product, category string) string {
+	return productDescriptionGrammar.Paragraph("sentence", textLengths.ProductDescription, Vars{
+		"product":  product,
+		"category": category,
+	})
 }
 
 // SKU generates a random SKU (Stock Keeping Unit)
@@ -114,9 +109,9 @@ func SKU() string {
 	return string(sku)
 }
 
-// Price returns a random price between min and max
+// Price returns a random price between min and max, rounded to the cent
 func Price(min, max float64) float64 {
-	return min + rand.Float64()*(max-min)
+	return math.Round((min+rand.Float64()*(max-min))*100) / 100
 }
 
 // OrderStatus returns a random order status
@@ -136,6 +131,22 @@ func PaymentMethod() string {
 	return methods[rand.Intn(len(methods))]
 }
 
+// ReturnReason returns a random reason a customer gives for returning items
+func ReturnReason() string {
+	reasons := []string{
+		"Defective or not working", "Damaged in transit", "Wrong item sent", "Item not as described",
+		"Wrong size or fit", "No longer needed", "Found a better price", "Arrived too late",
+		"Ordered by mistake", "Missing parts",
+	}
+	return reasons[rand.Intn(len(reasons))]
+}
+
+// ReturnCondition returns a random condition a returned item arrives back in
+func ReturnCondition() string {
+	conditions := []string{"Unopened", "Opened", "Used", "Damaged"}
+	return conditions[rand.Intn(len(conditions))]
+}
+
 // ShippingMethod returns a random shipping method
 func ShippingMethod() string {
 	methods := []string{
@@ -155,60 +166,186 @@ func TrackingNumber() string {
 	return prefix + number
 }
 
-// ReviewTitle returns a random review title
-func ReviewTitle() string {
-	titles := []string{
-		"Great product!", "Highly recommended", "Excellent value",
-		"Not what I expected", "Could be better", "Amazing quality",
-		"Disappointed", "Perfect for my needs", "Good but overpriced",
-		"Exceeded expectations", "Just okay", "Very satisfied",
+// GiftCardCode returns a random gift card code formatted as four groups of four characters
+func GiftCardCode() string {
+	const alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // No look-alike characters
+	groups := make([]string, 4)
+	for i := range groups {
+		group := make([]byte, 4)
+		for j := range group {
+			group[j] = alphabet[rand.Intn(len(alphabet))]
+		}
+		groups[i] = string(group)
 	}
-	return titles[rand.Intn(len(titles))]
+	return strings.Join(groups, "-")
 }
 
-// ReviewContent returns a random review content
-func ReviewContent() string {
-	contents := []string{
-		"I've been using this product for a few weeks now and I'm very satisfied with its performance and quality.",
-		"This product exceeded my expectations in every way. The build quality is excellent and it works perfectly.",
-		"While the product is good overall, I think it's a bit overpriced for what you get.",
-		"I was disappointed with this purchase. The quality is not what I expected and it doesn't work as advertised.",
-		"This is exactly what I was looking for. It's well-made, easy to use, and does the job perfectly.",
-		"The product is okay, but there are better options available at this price point.",
-		"I've tried many similar products, but this one is by far the best. Highly recommended!",
-		"Great value for money. It's not perfect, but it gets the job done and is very affordable.",
-		"I bought this as a gift and the recipient loved it. Great quality and nice packaging.",
-		"The product arrived damaged, but customer service was excellent and sent a replacement right away.",
+// Rating returns a random 1-5 star rating, skewed towards the extremes like real reviews
+func Rating() int {
+	weights := []int{13, 7, 10, 25, 45} // 1 through 5 stars, out of 100
+	n := rand.Intn(100)
+	for i, weight := range weights {
+		if n < weight {
+			return i + 1
+		}
+		n -= weight
 	}
-	return contents[rand.Intn(len(contents))]
+	return 5
 }
 
-// CategoryName returns a random category name
+// sentiment groups a star rating into negative, neutral or positive
+func sentiment(rating int) string {
+	switch {
+	case rating <= 2:
+		return "negative"
+	case rating == 3:
+		return "neutral"
+	default:
+		return "positive"
+	}
+}
+
+// ReviewTitle returns a random review title matching the sentiment of the rating
+func ReviewTitle(rating int) string {
+	titles := map[string][]string{
+		"negative": {
+			"Not what I expected", "Disappointed", "Would not buy again",
+			"Stopped working", "Poor quality", "Save your money",
+		},
+		"neutral": {
+			"Could be better", "Good but overpriced", "Just okay",
+			"Does the job", "Mixed feelings", "Average at best",
+		},
+		"positive": {
+			"Great product!", "Highly recommended", "Excellent value",
+			"Amazing quality", "Perfect for my needs", "Exceeded expectations",
+			"Very satisfied",
+		},
+	}[sentiment(rating)]
+	return titles[rand.Intn(len(titles))]
+}
+
+// ReviewContent returns a random review of the named product matching the sentiment of the rating
+func ReviewContent(rating int, product, category string) string {
+	return reviewGrammars[sentiment(rating)].Paragraph("sentence", textLengths.Review, Vars{
+		"product":  product,
+		"category": category,
+	})
+}
+
+// ReviewReply returns a seller's reply to a customer's review of the named product,
+// matching the sentiment of the review's rating
+func ReviewReply(rating int, customer, product string) string {
+	return reviewReplyGrammars[sentiment(rating)].Letter(textLengths.ReviewReply, Vars{
+		"customer": customer,
+		"product":  product,
+	})
+}
+
+// ReviewImageURL returns the URL of a photo uploaded with a review
+func ReviewImageURL(reviewID, position int) string {
+	extensions := []string{".jpg", ".jpeg", ".png", ".heic"}
+	return fmt.Sprintf("https://cdn.example.net/reviews/%d/%d%s", reviewID, position, extensions[rand.Intn(len(extensions))])
+}
+
+// CategoryName returns a random top-level category name
 func CategoryName() string {
-	categories := []string{
-		"Electronics", "Clothing", "Home & Kitchen", "Books", "Sports & Outdoors",
-		"Beauty & Personal Care", "Toys & Games", "Automotive", "Health & Wellness",
-		"Jewelry", "Office Supplies", "Pet Supplies", "Food & Grocery", "Garden & Outdoor",
-		"Baby Products", "Tools & Home Improvement", "Musical Instruments", "Arts & Crafts",
-	}
-	return categories[rand.Intn(len(categories))]
-}
-
-// CategoryDescription returns a random category description
-func CategoryDescription() string {
-	descriptions := []string{
-		"Find everything you need for your home and daily life.",
-		"Quality products at affordable prices.",
-		"The latest trends and innovations in this category.",
-		"Essential items for every household.",
-		"Premium selection of top-rated products.",
-		"Discover new and exciting products in this category.",
-		"Handpicked items to meet your specific needs.",
-		"A wide range of products for every budget.",
-		"Specialized products for enthusiasts and professionals.",
-		"Everything you need in one convenient category.",
-	}
-	return descriptions[rand.Intn(len(descriptions))]
+	return Taxonomy[rand.Intn(len(Taxonomy))].Name
+}
+
+// CategoryDescription returns a random description of the named category
+func CategoryDescription(category string) string {
+	return categoryDescriptionGrammar.Paragraph("sentence", textLengths.CategoryDescription, Vars{
+		"category": category,
+	})
+}
+
+// OrderNote returns random delivery instructions a customer could leave at checkout
+func OrderNote() string {
+	return orderNoteGrammar.Paragraph("sentence", textLengths.OrderNote, nil)
+}
+
+// PromotionName returns a random name for a promotion on the category, or a sitewide
+// promotion if the category is empty
+func PromotionName(category string) string {
+	if category == "" {
+		names := []string{
+			"Sitewide Sale", "Flash Sale", "Weekend Deals", "Summer Sale", "Spring Savings",
+			"Anniversary Sale", "End of Season Sale", "Holiday Savings", "Member Appreciation Days",
+		}
+		return names[rand.Intn(len(names))]
+	}
+
+	templates := []string{
+		"%s Sale", "%s Week", "%s Flash Deals", "Save Big on %s", "%s Clearance", "%s Spotlight",
+	}
+	return fmt.Sprintf(templates[rand.Intn(len(templates))], category)
+}
+
+// Device returns a random device type a visitor browses from, mostly phones
+func Device() string {
+	switch n := rand.Float64(); {
+	case n < 0.55:
+		return "mobile"
+	case n < 0.9:
+		return "desktop"
+	default:
+		return "tablet"
+	}
+}
+
+// TrafficChannel returns a random marketing channel a visit came from
+func TrafficChannel() string {
+	channels := []string{
+		"direct", "direct", "organic_search", "organic_search", "organic_search",
+		"paid_search", "paid_search", "email", "social", "referral",
+	}
+	return channels[rand.Intn(len(channels))]
+}
+
+// CompanyName returns a random name for a business
+func CompanyName() string {
+	prefixes := []string{
+		"Northwind", "Blue Harbor", "Summit", "Lakeside", "Evergreen", "Copperline", "Redwood",
+		"Silverleaf", "Brightside", "Ironbridge", "Maple & Oak", "Crescent", "Pinecrest", "Harborview",
+	}
+	suffixes := []string{
+		"Outfitters", "Goods", "Supply Co", "Trading", "Market", "Emporium", "Collective",
+		"Store", "Direct", "Mercantile",
+	}
+	return prefixes[rand.Intn(len(prefixes))] + " " + suffixes[rand.Intn(len(suffixes))]
+}
+
+// BrandName returns a random, made-up brand name
+func BrandName() string {
+	stems := []string{
+		"Vel", "Nor", "Aur", "Kin", "Lum", "Zep", "Cor", "Sol", "Tera", "Mav", "Oli", "Bex",
+		"Qui", "Dax", "Ryn", "Fen", "Ost", "Ivo",
+	}
+	endings := []string{"ora", "ex", "ix", "alis", "etic", "io", "on", "ra", "ova", "ium", "a", "ly"}
+	return stems[rand.Intn(len(stems))] + endings[rand.Intn(len(endings))]
+}
+
+// Carrier returns a random parcel carrier
+func Carrier() string {
+	carriers := []string{"UPS", "FedEx", "USPS", "DHL", "Royal Mail", "Canada Post"}
+	return carriers[rand.Intn(len(carriers))]
+}
+
+// Slug returns a lowercase, URL-safe version of a name
+func Slug(name string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			slug.WriteRune(r)
+			dash = false
+		} else if !dash && slug.Len() > 0 {
+			slug.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(slug.String(), "-")
 }
 
 // Dimensions returns random product dimensions
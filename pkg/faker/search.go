@@ -0,0 +1,117 @@
+package faker
+
+import (
+	"math/rand"
+	"strings"
+)
+
+// searchQualifiers are words shoppers add around what they're looking for
+var searchQualifiers = []string{"best", "cheap", "buy", "sale", "new", "for kids", "gift", "near me", "2 pack"}
+
+// unsoldSearches are things shoppers look for that the store doesn't sell
+var unsoldSearches = []string{
+	"lawn mower", "car tires", "concert tickets", "gift wrapping service", "pet insurance",
+	"prescription glasses", "motorcycle helmet", "hot tub", "plane tickets", "fishing license",
+	"used iphone", "store hours", "return policy", "track my order", "coupon code",
+}
+
+// keyboardNeighbors maps each letter to the keys around it, for realistic typos
+var keyboardNeighbors = map[rune]string{
+	'q': "wa", 'w': "qes", 'e': "wrd", 'r': "etf", 't': "ryg", 'y': "tuh", 'u': "yij",
+	'i': "uok", 'o': "ipl", 'p': "ol", 'a': "qsz", 's': "adwx", 'd': "sfec", 'f': "dgrv",
+	'g': "fhtb", 'h': "gjyn", 'j': "hkum", 'k': "jlim", 'l': "kop", 'z': "asx", 'x': "zsdc",
+	'c': "xdfv", 'v': "cfgb", 'b': "vghn", 'n': "bhjm", 'm': "njk",
+}
+
+// taxonomyLeaves returns the product type names at the bottom of the taxonomy
+func taxonomyLeaves(nodes []TaxonomyNode) []string {
+	var names []string
+	for _, n := range nodes {
+		if len(n.Children) == 0 {
+			names = append(names, n.Name)
+			continue
+		}
+		names = append(names, taxonomyLeaves(n.Children)...)
+	}
+	return names
+}
+
+// productTypes lists the product type names searched for, from the taxonomy
+var productTypes = taxonomyLeaves(Taxonomy)
+
+// CatalogSearchQuery returns a query a shopper could type in the store's search box,
+// drawn from the product and category vocabulary. A few look for things the store
+// doesn't sell, and some are misspelled.
+func CatalogSearchQuery() string {
+	var query string
+	switch n := rand.Float64(); {
+	case n < 0.05:
+		return unsoldSearches[rand.Intn(len(unsoldSearches))]
+	case n < 0.35:
+		query = productNouns[rand.Intn(len(productNouns))]
+	case n < 0.55:
+		query = productAdjectives[rand.Intn(len(productAdjectives))] + " " + productNouns[rand.Intn(len(productNouns))]
+	default:
+		query = productTypes[rand.Intn(len(productTypes))]
+	}
+	return shopperQuery(strings.ToLower(query))
+}
+
+// ProductSearchQuery returns a query a shopper could type looking for the named product.
+// Shoppers usually search for the kind of product rather than its full name.
+func ProductSearchQuery(product string) string {
+	words := strings.Fields(strings.ToLower(product))
+	if len(words) == 0 {
+		return ""
+	}
+	if len(words) > 1 && rand.Float64() < 0.6 {
+		words = words[len(words)-1:]
+	}
+	return shopperQuery(strings.Join(words, " "))
+}
+
+// shopperQuery returns the query with the qualifiers and typos shoppers add to some searches
+func shopperQuery(query string) string {
+	if rand.Float64() < 0.15 {
+		if rand.Float64() < 0.5 {
+			query = searchQualifiers[rand.Intn(len(searchQualifiers))] + " " + query
+		} else {
+			query = query + " " + searchQualifiers[rand.Intn(len(searchQualifiers))]
+		}
+	}
+	if rand.Float64() < 0.12 {
+		query = Misspell(query)
+	}
+	return query
+}
+
+// Misspell returns the text with a typo: a letter dropped, doubled, swapped with the
+// next one, or replaced by a neighboring key
+func Misspell(text string) string {
+	letters := []rune(text)
+	var positions []int
+	for i, r := range letters {
+		if _, ok := keyboardNeighbors[r]; ok {
+			positions = append(positions, i)
+		}
+	}
+	if len(positions) == 0 {
+		return text
+	}
+
+	i := positions[rand.Intn(len(positions))]
+	switch rand.Intn(4) {
+	case 0:
+		letters = append(letters[:i], letters[i+1:]...)
+	case 1:
+		letters = append(letters[:i+1], letters[i:]...)
+	case 2:
+		if i+1 < len(letters) {
+			letters[i], letters[i+1] = letters[i+1], letters[i]
+		}
+	default:
+		neighbors := []rune(keyboardNeighbors[letters[i]])
+		letters[i] = neighbors[rand.Intn(len(neighbors))]
+	}
+	return string(letters)
+}
@@ -0,0 +1,175 @@
+package faker
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Support ticket topics
+const (
+	TicketLateDelivery    = "Late Delivery"
+	TicketCancellation    = "Cancellation"
+	TicketRefund          = "Refund"
+	TicketDamagedItem     = "Damaged Item"
+	TicketOrderStatus     = "Order Status"
+	TicketProductQuestion = "Product Question"
+	TicketAccount         = "Account"
+)
+
+// customerTicketGrammars generate what customers write to support, for each topic
+var customerTicketGrammars = map[string]Grammar{
+	TicketLateDelivery: {
+		"sentence": {
+			"my order {order} was supposed to arrive {when} and it still hasn't shown up.",
+			"the tracking page hasn't updated in {days}.",
+			"I {need} it for {occasion}, can you tell me where it is?",
+			"{frustration}",
+		},
+		"when":        {"on Monday", "last week", "three days ago", "by the weekend"},
+		"days":        {"two days", "almost a week", "several days"},
+		"occasion":    {"a birthday", "a trip on Friday", "work", "a party this weekend"},
+		"need":        {"really need", "was counting on having", "need"},
+		"frustration": {"this is the second time this has happened.", "I paid for faster shipping for a reason.", "please let me know what's going on."},
+	},
+	TicketCancellation: {
+		"sentence": {
+			"I'd like to know why order {order} was cancelled.",
+			"I never asked to cancel order {order}.",
+			"can I still get the {product} some other way?",
+			"was I charged for the cancelled order?",
+			"{frustration}",
+		},
+		"frustration": {"I was really looking forward to it.", "nobody told me anything.", "please sort this out."},
+	},
+	TicketRefund: {
+		"sentence": {
+			"I sent back order {order} and haven't seen my refund yet.",
+			"the refund for {order} doesn't match what I paid.",
+			"how long does a refund usually take to show up?",
+			"can I get store credit instead of a refund?",
+			"{frustration}",
+		},
+		"frustration": {"it's been over a week.", "my bank says nothing has come through.", "please check on this."},
+	},
+	TicketDamagedItem: {
+		"sentence": {
+			"the {product} in order {order} arrived {damage}.",
+			"I've attached photos of the {product}.",
+			"I'd like a {remedy}.",
+			"the box itself was {box}.",
+		},
+		"damage": {"cracked", "with a broken part", "scratched all over", "not working at all"},
+		"remedy": {"replacement", "refund", "replacement as soon as possible"},
+		"box":    {"crushed", "soaked", "torn open", "fine, so it must have been packed badly"},
+	},
+	TicketOrderStatus: {
+		"sentence": {
+			"can you tell me when order {order} will ship?",
+			"is it possible to change the delivery address on {order}?",
+			"I'd like to add an item to order {order} before it ships.",
+			"the order page says {status} for {order}, is that right?",
+		},
+		"status": {"processing", "shipped", "pending"},
+	},
+	TicketProductQuestion: {
+		"sentence": {
+			"does the {product} come with a warranty?",
+			"is the {product} going to be back in stock soon?",
+			"what's the difference between the sizes of the {product}?",
+			"can the {product} be shipped {where}?",
+		},
+		"where": {"internationally", "to a PO box", "to my office"},
+	},
+	TicketAccount: {
+		"sentence": {
+			"I can't log in to my account.",
+			"I'd like to update the email on my account.",
+			"please remove my old card from my account.",
+			"I keep getting emails I didn't sign up for.",
+		},
+	},
+}
+
+// agentTicketGrammar generates support agent replies, written as a letter
+var agentTicketGrammar = Grammar{
+	"greeting": {
+		"hi {customer}, thanks for reaching out.",
+		"hi {customer}, thanks for your patience.",
+		"hello {customer}, thanks for getting in touch.",
+	},
+	"sentence": {
+		"I've {checked} and {finding}.",
+		"{apology}",
+		"I've {action} for you.",
+	},
+	"sign_off": {
+		"{closing}, {agent}",
+		"please let me know if there's anything else I can help with. {closing}, {agent}",
+	},
+	"checked": {"looked into {order}", "checked with our {team} team", "reviewed your account"},
+	"finding": {"everything looks in order on our side", "it looks like there was a delay at the warehouse", "the carrier has confirmed a delay", "I can see what happened"},
+	"apology": {"I'm sorry for the trouble.", "apologies for the inconvenience.", "I completely understand your frustration."},
+	"action":  {"escalated this", "issued a replacement", "processed a refund", "added a note to your account", "requested an update from the carrier"},
+	"team":    {"shipping", "returns", "billing", "warehouse"},
+	"closing": {"Best regards", "Kind regards", "Thanks", "Cheers"},
+}
+
+// customerFollowUps are short replies customers send after an agent answers
+var customerFollowUps = []string{
+	"Thanks, that helps.",
+	"Any update on this?",
+	"That's not what I was told last time.",
+	"Great, thank you for the quick reply!",
+	"Okay, I'll wait a few more days.",
+	"Still nothing on my end, can you check again?",
+}
+
+// TicketSubject returns a subject line for a support ticket on the topic
+func TicketSubject(topic, order string) string {
+	subjects := map[string][]string{
+		TicketLateDelivery:    {"Where is my order %s?", "Order %s is late", "Still waiting for %s"},
+		TicketCancellation:    {"Order %s was cancelled", "Why was %s cancelled?"},
+		TicketRefund:          {"Refund for order %s", "Missing refund on %s"},
+		TicketDamagedItem:     {"Damaged item in order %s", "Order %s arrived broken"},
+		TicketOrderStatus:     {"Question about order %s", "Change to order %s"},
+		TicketProductQuestion: {"Product question", "Question before buying"},
+		TicketAccount:         {"Account help", "Problem with my account"},
+	}
+	options := subjects[topic]
+	if len(options) == 0 {
+		return "Help needed"
+	}
+	subject := options[rand.Intn(len(options))]
+	if order == "" {
+		return subject
+	}
+	return fmt.Sprintf(subject, order)
+}
+
+// CustomerTicketMessage returns the message a customer opens a ticket on the topic with
+func CustomerTicketMessage(topic, order, product string) string {
+	grammar, ok := customerTicketGrammars[topic]
+	if !ok {
+		grammar = customerTicketGrammars[TicketAccount]
+	}
+	return grammar.Paragraph("sentence", textLengths.TicketMessage, Vars{"order": order, "product": product})
+}
+
+// CustomerFollowUp returns a short reply from a customer to a support agent
+func CustomerFollowUp() string {
+	return customerFollowUps[rand.Intn(len(customerFollowUps))]
+}
+
+// AgentTicketReply returns a support agent's reply to a customer
+func AgentTicketReply(customer, agent, order string) string {
+	if order == "" {
+		order = "your order"
+	} else {
+		order = "order " + order
+	}
+	return agentTicketGrammar.Letter(textLengths.TicketMessage, Vars{
+		"customer": customer,
+		"agent":    agent,
+		"order":    order,
+	})
+}
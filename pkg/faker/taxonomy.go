@@ -0,0 +1,228 @@
+package faker
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// TaxonomyNode is a category name along with the names that fit beneath it
+type TaxonomyNode struct {
+	Name     string
+	Children []TaxonomyNode
+}
+
+// node builds a taxonomy node
+func node(name string, children ...TaxonomyNode) TaxonomyNode {
+	return TaxonomyNode{Name: name, Children: children}
+}
+
+// leaves builds taxonomy nodes without children
+func leaves(names ...string) []TaxonomyNode {
+	nodes := make([]TaxonomyNode, len(names))
+	for i, name := range names {
+		nodes[i] = node(name)
+	}
+	return nodes
+}
+
+// Taxonomy is the hierarchical category vocabulary, from departments down to product types
+var Taxonomy = []TaxonomyNode{
+	node("Electronics",
+		node("Computers", leaves("Laptops", "Desktops", "Monitors", "Keyboards", "Mice")...),
+		node("Phones & Tablets", leaves("Smartphones", "Tablets", "Cases", "Chargers", "Screen Protectors")...),
+		node("Audio", leaves("Headphones", "Speakers", "Soundbars", "Microphones")...),
+		node("Cameras", leaves("Mirrorless Cameras", "Action Cameras", "Lenses", "Tripods")...),
+		node("TV & Video", leaves("Televisions", "Projectors", "Streaming Devices")...),
+		node("Networking", leaves("Routers", "Mesh Systems", "Network Switches")...),
+	),
+	node("Clothing",
+		node("Women", leaves("Dresses", "Tops", "Jeans", "Outerwear", "Activewear")...),
+		node("Men", leaves("Shirts", "Trousers", "Suits", "Jackets", "Sportswear")...),
+		node("Kids", leaves("Baby Clothing", "Boys", "Girls", "School Uniforms")...),
+		node("Shoes", leaves("Sneakers", "Boots", "Sandals", "Formal Shoes")...),
+		node("Accessories", leaves("Hats", "Belts", "Scarves", "Bags")...),
+	),
+	node("Home & Kitchen",
+		node("Cookware", leaves("Pots & Pans", "Bakeware", "Knives", "Utensils")...),
+		node("Small Appliances", leaves("Coffee Makers", "Blenders", "Toasters", "Air Fryers")...),
+		node("Furniture", leaves("Sofas", "Tables", "Chairs", "Beds", "Storage")...),
+		node("Bedding", leaves("Sheets", "Pillows", "Duvets", "Blankets")...),
+		node("Home Decor", leaves("Lighting", "Rugs", "Wall Art", "Candles")...),
+	),
+	node("Books",
+		node("Fiction", leaves("Mystery", "Science Fiction", "Fantasy", "Romance", "Literary Fiction")...),
+		node("Non-Fiction", leaves("Biographies", "History", "Self-Help", "Science", "Cookbooks")...),
+		node("Children's Books", leaves("Picture Books", "Early Readers", "Young Adult")...),
+		node("Education", leaves("Textbooks", "Test Prep", "Language Learning")...),
+		node("Comics & Graphic Novels"),
+	),
+	node("Sports & Outdoors",
+		node("Fitness", leaves("Yoga", "Weights", "Cardio Machines", "Resistance Bands")...),
+		node("Camping & Hiking", leaves("Tents", "Backpacks", "Sleeping Bags", "Trekking Poles")...),
+		node("Cycling", leaves("Bikes", "Helmets", "Bike Parts", "Cycling Apparel")...),
+		node("Team Sports", leaves("Soccer", "Basketball", "Baseball", "Volleyball")...),
+		node("Water Sports", leaves("Swimming", "Surfing", "Kayaking")...),
+	),
+	node("Beauty & Personal Care",
+		node("Skin Care", leaves("Cleansers", "Moisturizers", "Serums", "Sunscreen")...),
+		node("Hair Care", leaves("Shampoo", "Conditioner", "Styling Tools", "Hair Color")...),
+		node("Makeup", leaves("Face", "Eyes", "Lips", "Brushes")...),
+		node("Fragrance", leaves("Perfume", "Cologne", "Body Mists")...),
+		node("Shaving & Grooming"),
+	),
+	node("Toys & Games",
+		node("Board Games", leaves("Strategy Games", "Family Games", "Party Games")...),
+		node("Puzzles", leaves("Jigsaw Puzzles", "Brain Teasers", "3D Puzzles")...),
+		node("Building Toys", leaves("Construction Sets", "Magnetic Tiles", "Model Kits")...),
+		node("Dolls & Figures"),
+		node("Outdoor Play", leaves("Ride-Ons", "Water Toys", "Playhouses")...),
+	),
+	node("Automotive",
+		node("Car Electronics", leaves("Dash Cams", "Car Audio", "GPS Units")...),
+		node("Car Care", leaves("Cleaning", "Waxes & Polishes", "Detailing Tools")...),
+		node("Parts & Accessories", leaves("Wipers", "Filters", "Brakes", "Lighting")...),
+		node("Tires & Wheels"),
+	),
+	node("Health & Wellness",
+		node("Vitamins & Supplements", leaves("Multivitamins", "Protein", "Minerals", "Herbal Supplements")...),
+		node("Medical Supplies", leaves("First Aid", "Monitors", "Mobility Aids")...),
+		node("Personal Care", leaves("Oral Care", "Feminine Care", "Sleep Aids")...),
+	),
+	node("Jewelry",
+		node("Necklaces", leaves("Pendants", "Chains", "Chokers")...),
+		node("Rings", leaves("Engagement Rings", "Wedding Bands", "Fashion Rings")...),
+		node("Earrings", leaves("Studs", "Hoops", "Drops")...),
+		node("Bracelets"),
+		node("Watches", leaves("Smartwatches", "Analog Watches", "Watch Bands")...),
+	),
+	node("Office Supplies",
+		node("Paper Products", leaves("Notebooks", "Printer Paper", "Sticky Notes")...),
+		node("Writing Instruments", leaves("Pens", "Pencils", "Markers")...),
+		node("Office Furniture", leaves("Desks", "Office Chairs", "Filing Cabinets")...),
+		node("Organization"),
+	),
+	node("Pet Supplies",
+		node("Dogs", leaves("Dog Food", "Dog Toys", "Leashes & Collars", "Dog Beds")...),
+		node("Cats", leaves("Cat Food", "Litter", "Scratchers", "Cat Toys")...),
+		node("Fish & Aquatics", leaves("Aquariums", "Filters", "Fish Food")...),
+		node("Small Animals"),
+		node("Birds"),
+	),
+	node("Food & Grocery",
+		node("Pantry", leaves("Pasta & Grains", "Canned Goods", "Spices", "Baking")...),
+		node("Beverages", leaves("Coffee", "Tea", "Juice", "Sparkling Water")...),
+		node("Snacks", leaves("Chips", "Cookies", "Nuts", "Candy")...),
+		node("Breakfast", leaves("Cereal", "Oatmeal", "Spreads")...),
+	),
+	node("Garden & Outdoor",
+		node("Gardening", leaves("Seeds", "Planters", "Soil", "Garden Tools")...),
+		node("Outdoor Furniture", leaves("Patio Sets", "Hammocks", "Umbrellas")...),
+		node("Grills & Outdoor Cooking", leaves("Gas Grills", "Charcoal Grills", "Smokers")...),
+		node("Lawn Care", leaves("Mowers", "Trimmers", "Sprinklers")...),
+	),
+	node("Baby Products",
+		node("Nursery", leaves("Cribs", "Changing Tables", "Baby Monitors")...),
+		node("Feeding", leaves("Bottles", "High Chairs", "Bibs")...),
+		node("Diapering", leaves("Diapers", "Wipes", "Diaper Bags")...),
+		node("Strollers & Car Seats"),
+	),
+	node("Tools & Home Improvement",
+		node("Power Tools", leaves("Drills", "Saws", "Sanders", "Impact Drivers")...),
+		node("Hand Tools", leaves("Wrenches", "Screwdrivers", "Hammers", "Pliers")...),
+		node("Electrical", leaves("Light Bulbs", "Switches", "Extension Cords")...),
+		node("Plumbing", leaves("Faucets", "Pipes & Fittings", "Water Heaters")...),
+		node("Paint", leaves("Interior Paint", "Exterior Paint", "Brushes & Rollers")...),
+	),
+	node("Musical Instruments",
+		node("Guitars", leaves("Acoustic Guitars", "Electric Guitars", "Bass Guitars", "Amplifiers")...),
+		node("Keyboards & Pianos", leaves("Digital Pianos", "Synthesizers", "MIDI Controllers")...),
+		node("Drums & Percussion", leaves("Drum Kits", "Cymbals", "Hand Percussion")...),
+		node("Studio Equipment", leaves("Audio Interfaces", "Studio Monitors", "Mixers")...),
+	),
+	node("Arts & Crafts",
+		node("Painting", leaves("Acrylics", "Watercolors", "Oil Paints", "Canvases")...),
+		node("Drawing", leaves("Sketchbooks", "Colored Pencils", "Charcoal")...),
+		node("Sewing", leaves("Fabric", "Sewing Machines", "Thread")...),
+		node("Scrapbooking"),
+	),
+}
+
+// extraDepartments are top-level names used once the taxonomy's departments run out
+var extraDepartments = []string{
+	"Seasonal", "Clearance", "Gifts", "New Arrivals", "Luxury", "Eco Friendly",
+	"Travel", "Party Supplies", "Collectibles", "Smart Home", "Industrial", "Wedding",
+}
+
+// subcategoryQualifiers build child names from a parent once the vocabulary runs out
+var subcategoryQualifiers = []string{
+	"%s Accessories", "%s Bundles", "Premium %s", "Budget %s", "%s Parts", "Refurbished %s",
+	"Kids' %s", "%s Sets", "Eco %s", "Travel %s", "%s Gifts", "Vintage %s", "Professional %s",
+}
+
+// TaxonomyChildren returns the vocabulary names beneath a category path, starting from the
+// departments for an empty path. Unknown paths have no vocabulary names.
+func TaxonomyChildren(path ...string) []string {
+	nodes := Taxonomy
+	for _, name := range path {
+		var next []TaxonomyNode
+		for _, n := range nodes {
+			if n.Name == name {
+				next = n.Children
+				break
+			}
+		}
+		nodes = next
+	}
+
+	names := make([]string, len(nodes))
+	for i, n := range nodes {
+		names[i] = n.Name
+	}
+	return names
+}
+
+// UniqueCategoryName returns a random name fitting beneath the category path that isn't
+// already taken by a sibling. Vocabulary names are preferred, then names derived from the
+// parent, then numbered names.
+func UniqueCategoryName(path []string, taken map[string]bool) string {
+	var candidates []string
+	for _, name := range TaxonomyChildren(path...) {
+		if !taken[name] {
+			candidates = append(candidates, name)
+		}
+	}
+
+	if len(candidates) == 0 {
+		if len(path) == 0 {
+			for _, name := range extraDepartments {
+				if !taken[name] {
+					candidates = append(candidates, name)
+				}
+			}
+		} else {
+			parent := path[len(path)-1]
+			for _, qualifier := range subcategoryQualifiers {
+				name := fmt.Sprintf(qualifier, parent)
+				if !taken[name] && !strings.Contains(parent, strings.TrimSpace(strings.ReplaceAll(qualifier, "%s", ""))) {
+					candidates = append(candidates, name)
+				}
+			}
+		}
+	}
+
+	if len(candidates) > 0 {
+		return candidates[rand.Intn(len(candidates))]
+	}
+
+	base := "Department"
+	if len(path) > 0 {
+		base = path[len(path)-1]
+	}
+	for n := 2; ; n++ {
+		name := fmt.Sprintf("%s %d", base, n)
+		if !taken[name] {
+			return name
+		}
+	}
+}
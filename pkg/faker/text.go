@@ -0,0 +1,384 @@
+package faker
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Grammar maps each symbol to its possible expansions. Expansions may reference other
+// symbols, or interpolated variables, as {name}.
+type Grammar map[string][]string
+
+// Vars holds values interpolated into expansions, such as {product} and {category}
+type Vars map[string]string
+
+// Length bounds the number of words in generated text
+type Length struct {
+	Min int
+	Max int
+}
+
+// TextLengths holds the lengths used for each kind of generated text
+type TextLengths struct {
+	ProductDescription  Length
+	CategoryDescription Length
+	Review              Length
+	ReviewReply         Length
+	OrderNote           Length
+	TicketMessage       Length
+}
+
+// TextLengthPresets lists the named text length presets
+var TextLengthPresets = map[string]TextLengths{
+	"short": {
+		ProductDescription:  Length{Min: 8, Max: 25},
+		CategoryDescription: Length{Min: 5, Max: 15},
+		Review:              Length{Min: 5, Max: 20},
+		ReviewReply:         Length{Min: 5, Max: 15},
+		OrderNote:           Length{Min: 3, Max: 10},
+		TicketMessage:       Length{Min: 5, Max: 20},
+	},
+	"medium": {
+		ProductDescription:  Length{Min: 30, Max: 80},
+		CategoryDescription: Length{Min: 10, Max: 30},
+		Review:              Length{Min: 15, Max: 60},
+		ReviewReply:         Length{Min: 12, Max: 40},
+		OrderNote:           Length{Min: 5, Max: 20},
+		TicketMessage:       Length{Min: 15, Max: 50},
+	},
+	"long": {
+		ProductDescription:  Length{Min: 120, Max: 300},
+		CategoryDescription: Length{Min: 40, Max: 90},
+		Review:              Length{Min: 60, Max: 200},
+		ReviewReply:         Length{Min: 40, Max: 100},
+		OrderNote:           Length{Min: 10, Max: 40},
+		TicketMessage:       Length{Min: 40, Max: 120},
+	},
+}
+
+// textLengths is the preset used by the text generating functions
+var textLengths = TextLengthPresets["medium"]
+
+// UseTextLength selects the named text length preset
+func UseTextLength(name string) error {
+	lengths, ok := TextLengthPresets[name]
+	if !ok {
+		names := make([]string, 0, len(TextLengthPresets))
+		for presetName := range TextLengthPresets {
+			names = append(names, presetName)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown text length %q (available: %v)", name, names)
+	}
+	textLengths = lengths
+	return nil
+}
+
+// Expand returns a random expansion of the symbol, recursively expanding nested symbols
+func (g Grammar) Expand(symbol string, vars Vars) string {
+	return g.expand(symbol, vars, 0)
+}
+
+func (g Grammar) expand(symbol string, vars Vars, depth int) string {
+	if value, ok := vars[symbol]; ok {
+		return value
+	}
+	rules, ok := g[symbol]
+	if !ok || depth > 20 {
+		return symbol
+	}
+	rule := rules[rand.Intn(len(rules))]
+
+	var out strings.Builder
+	for {
+		open := strings.IndexByte(rule, '{')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(rule[open:], '}')
+		if end < 0 {
+			break
+		}
+		out.WriteString(rule[:open])
+		out.WriteString(g.expand(rule[open+1:open+end], vars, depth+1))
+		rule = rule[open+end+1:]
+	}
+	out.WriteString(rule)
+	return out.String()
+}
+
+// Paragraph joins sentences expanded from the symbol until the text holds between
+// length.Min and length.Max words
+func (g Grammar) Paragraph(symbol string, length Length, vars Vars) string {
+	var sentences []string
+	used := make(map[string]bool)
+	words := 0
+	for attempt := 0; words < length.Min && attempt < 100; attempt++ {
+		sentence := capitalize(strings.Join(strings.Fields(g.Expand(symbol, vars)), " "))
+		count := len(strings.Fields(sentence))
+		// A sentence longer than the maximum on its own is only taken as a last resort
+		if (words+count > length.Max && (words > 0 || attempt < 50)) || (used[sentence] && attempt < 50) {
+			continue
+		}
+		sentences = append(sentences, sentence)
+		used[sentence] = true
+		words += count
+	}
+
+	// Text over the maximum loses whole trailing sentences, and only a single sentence
+	// longer than the maximum is cut short
+	for len(sentences) > 1 && words > length.Max {
+		words -= len(strings.Fields(sentences[len(sentences)-1]))
+		sentences = sentences[:len(sentences)-1]
+	}
+	text := strings.Join(sentences, " ")
+	if fields := strings.Fields(text); len(fields) > length.Max {
+		text = strings.TrimRight(strings.Join(fields[:length.Max], " "), ",;:") + "."
+	}
+	return text
+}
+
+// Letter returns a message opening with an expansion of the "greeting" symbol, followed by
+// a paragraph of "sentence" expansions between length.Min and length.Max words, and closing
+// with a single expansion of the "sign_off" symbol
+func (g Grammar) Letter(length Length, vars Vars) string {
+	parts := []string{
+		capitalize(g.Expand("greeting", vars)),
+		g.Paragraph("sentence", length, vars),
+		capitalize(g.Expand("sign_off", vars)),
+	}
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
+
+// capitalize upper-cases the first letter of a sentence
+func capitalize(s string) string {
+	for i, r := range s {
+		return s[:i] + string(unicode.ToUpper(r)) + s[i+len(string(r)):]
+	}
+	return s
+}
+
+// productDescriptionGrammar generates marketing copy for a product
+var productDescriptionGrammar = Grammar{
+	"sentence": {
+		"{opener}", "{feature}", "{feature}", "{benefit}", "{audience}", "{closer}",
+	},
+	"opener": {
+		"the {product} is {praise} addition to any {category} collection.",
+		"meet the {product}, {praise} choice for {people}.",
+		"introducing the {product}, built to {verb} {expectation}.",
+		"looking for the best in {category}? The {product} delivers.",
+	},
+	"feature": {
+		"it features {material} construction and {quality} {component}.",
+		"with its {quality} {component}, the {product} handles {task} with ease.",
+		"the {material} finish gives it {look} look that lasts.",
+		"{quality} {component} and {quality} {component} come standard.",
+		"its {size} design makes it easy to {use}.",
+	},
+	"benefit": {
+		"you'll {verb} {expectation} every single day.",
+		"say goodbye to {problem} and hello to {outcome}.",
+		"it saves you time on {task} so you can focus on what matters.",
+		"designed to reduce {problem}, it brings {outcome} to your routine.",
+	},
+	"audience": {
+		"perfect for {people} and {people} alike.",
+		"a favorite among {people} who care about {value}.",
+		"ideal for {people} looking for {value}.",
+	},
+	"closer": {
+		"backed by our {guarantee}.",
+		"order yours today and discover why customers love our {category} range.",
+		"available in limited quantities, so don't wait.",
+		"it makes {praise} gift for {people}.",
+	},
+	"praise": {"a stylish", "a reliable", "an essential", "a versatile", "an outstanding", "a thoughtful"},
+	"people": {
+		"beginners", "professionals", "families", "students", "travelers",
+		"home cooks", "gamers", "outdoor enthusiasts", "busy parents", "creatives",
+	},
+	"verb":        {"exceed", "meet", "surpass", "redefine"},
+	"expectation": {"your expectations", "everyday demands", "the highest standards", "what you thought possible"},
+	"material":    {"aluminum", "stainless steel", "recycled plastic", "bamboo", "tempered glass", "premium leather", "carbon fiber"},
+	"quality":     {"durable", "high-performance", "precision-engineered", "lightweight", "ergonomic", "energy-efficient", "reinforced"},
+	"component":   {"controls", "battery", "hinges", "stitching", "sensors", "grip", "housing", "display"},
+	"task":        {"daily chores", "long trips", "heavy workloads", "quick fixes", "weekend projects", "everyday use"},
+	"look":        {"a sleek", "a timeless", "a modern", "an understated", "a bold"},
+	"size":        {"compact", "slim", "foldable", "lightweight", "space-saving"},
+	"use":         {"carry anywhere", "store away", "set up in minutes", "clean", "use with one hand"},
+	"problem":     {"clutter", "wasted time", "tangled cables", "constant replacements", "guesswork"},
+	"outcome":     {"peace of mind", "better results", "a tidier space", "effortless convenience", "more free time"},
+	"value":       {"quality", "value for money", "sustainability", "performance", "simplicity"},
+	"guarantee":   {"two-year warranty", "30-day money-back guarantee", "lifetime support", "hassle-free returns"},
+}
+
+// categoryDescriptionGrammar generates a blurb for a category page
+var categoryDescriptionGrammar = Grammar{
+	"sentence": {
+		"discover {range} of {category} {products}.",
+		"shop {category} from {brands}, with {perk}.",
+		"our {category} department has everything from {item} to {item}.",
+		"whether you're {shopper}, our {category} selection has you covered.",
+		"browse {range} of {category} {products} at {prices}.",
+	},
+	"range":    {"a wide range", "hundreds", "our curated selection", "the latest arrivals", "best-selling picks"},
+	"products": {"essentials", "favorites", "must-haves", "products", "deals"},
+	"brands":   {"top brands", "independent makers", "trusted names", "award-winning designers"},
+	"perk":     {"free shipping on qualifying orders", "easy returns", "new arrivals every week", "exclusive member discounts"},
+	"item":     {"everyday basics", "premium upgrades", "gift ideas", "seasonal specials", "professional gear"},
+	"shopper":  {"a first-time buyer", "a seasoned pro", "shopping for a gift", "upgrading your setup"},
+	"prices":   {"great prices", "every budget", "unbeatable value", "prices you'll love"},
+}
+
+// reviewGrammars generate review text for each sentiment
+var reviewGrammars = map[string]Grammar{
+	"positive": {
+		"sentence": {
+			"I {love} this {product}.",
+			"the {aspect} is {good} and it arrived {arrival}.",
+			"{time} in and it still works {good_adverb}.",
+			"I'd {recommend} it to anyone shopping for {category}.",
+			"worth every penny, the {aspect} alone makes it {good}.",
+			"my {person} is a big fan too.",
+		},
+		"love":        {"love", "really like", "am impressed by", "can't stop using"},
+		"good":        {"excellent", "fantastic", "better than expected", "top notch", "great"},
+		"good_adverb": {"perfectly", "like new", "flawlessly", "great"},
+		"recommend":   {"recommend", "happily recommend", "definitely recommend"},
+		"arrival":     {"quickly", "ahead of schedule", "well packaged", "right on time"},
+	},
+	"neutral": {
+		"sentence": {
+			"the {product} is {ok}.",
+			"the {aspect} is {good} but the {aspect} is {bad}.",
+			"it does the job, though other {category} products offer more at this price.",
+			"{time} in and it's holding up {ok_adverb}.",
+			"not bad, not great, the {aspect} could be improved.",
+			"my {person} thinks it's {ok}.",
+		},
+		"ok":        {"okay", "fine", "decent", "average", "alright for the price"},
+		"ok_adverb": {"reasonably well", "so far", "fine"},
+		"good":      {"nice", "solid", "good"},
+		"bad":       {"disappointing", "mediocre", "a bit flimsy", "overpriced"},
+	},
+	"negative": {
+		"sentence": {
+			"the {product} {failed} after {time}.",
+			"the {aspect} is {bad} and it arrived {arrival}.",
+			"I {regret} buying this, there are better {category} options.",
+			"customer service was {service} when I reported the {aspect} issue.",
+			"would not recommend, the {aspect} is {bad}.",
+			"my {person} returned theirs too.",
+		},
+		"failed":  {"stopped working", "broke", "fell apart", "started malfunctioning"},
+		"bad":     {"terrible", "cheaply made", "nothing like the pictures", "disappointing", "flimsy"},
+		"arrival": {"late", "damaged", "with missing parts", "in a crushed box"},
+		"regret":  {"regret", "really regret", "am annoyed about"},
+		"service": {"unhelpful", "slow to respond", "polite but useless"},
+	},
+}
+
+// reviewCommon holds symbols shared by every review sentiment
+var reviewCommon = Grammar{
+	"aspect": {"build quality", "battery life", "finish", "size", "packaging", "price", "performance", "design", "instructions"},
+	"time":   {"two weeks", "a month", "three months", "half a year", "a few days"},
+	"person": {"partner", "son", "daughter", "roommate", "coworker", "mom"},
+}
+
+// orderNoteGrammar generates delivery instructions left at checkout
+var orderNoteGrammar = Grammar{
+	"sentence": {
+		"please {action} {place}.",
+		"{action} {place} if nobody answers.",
+		"call me {timing} before delivery.",
+		"the {entrance} is around the back.",
+		"{gift}",
+		"buzzer code is {code}.",
+		"please avoid {avoid}.",
+	},
+	"action":   {"leave the package", "deliver", "drop it off", "hand it to the concierge or leave it"},
+	"place":    {"at the front door", "with a neighbor", "in the parcel locker", "at the reception", "behind the gate", "on the porch"},
+	"timing":   {"30 minutes", "an hour", "shortly"},
+	"entrance": {"entrance", "side door", "loading dock", "mailbox"},
+	"gift":     {"this is a gift, please don't include the invoice.", "gift wrap if possible.", "it's a surprise, please be discreet."},
+	"code":     {"1234", "4521", "0906", "7788", "3310"},
+	"avoid":    {"ringing the bell, the baby is sleeping", "leaving it in the rain", "weekend deliveries"},
+}
+
+// reviewReplyGrammars generate seller replies to reviews for each sentiment of the review,
+// written as a greeting, a body and a sign-off
+var reviewReplyGrammars = map[string]Grammar{
+	"negative": {
+		"greeting": {
+			"hi {customer}, {sorry} the {product} {let_down}.",
+			"hello {customer}, thank you for letting us know.",
+		},
+		"sentence": {
+			"this isn't the experience we want anyone to have.",
+			"{sorry} the {product} {let_down}.",
+			"we've shared your feedback with our {team} team.",
+		},
+		"sign_off": {
+			"please {contact} so we can {fix}.",
+			"please {contact} and we'll {fix}.",
+		},
+		"sorry":    {"we're sorry", "we're really sorry to hear", "apologies that"},
+		"let_down": {"didn't meet your expectations", "gave you trouble", "wasn't up to our usual standard"},
+		"contact":  {"reach out to our support team", "reply to your order confirmation email", "get in touch through your account page"},
+		"fix":      {"arrange a replacement", "make this right", "sort out a refund or exchange"},
+		"team":     {"quality", "product", "warehouse"},
+	},
+	"neutral": {
+		"greeting": {
+			"thanks for the honest review, {customer}.",
+			"hi {customer}, thanks for taking the time to share your thoughts.",
+		},
+		"sentence": {
+			"we're always looking to improve the {product}.",
+			"your feedback helps other shoppers too.",
+		},
+		"sign_off": {
+			"if anything could be better, {contact}.",
+			"{contact} if you have any questions.",
+		},
+		"contact": {"let us know", "our support team is happy to help", "drop us a message"},
+	},
+	"positive": {
+		"greeting": {
+			"thank you so much, {customer}!",
+			"hi {customer}, thanks for the kind words!",
+		},
+		"sentence": {
+			"we're {glad} you're enjoying the {product}.",
+			"reviews like yours {mean}.",
+		},
+		"sign_off": {
+			"enjoy, and thanks for shopping with us.",
+			"happy shopping, and thanks again.",
+		},
+		"glad": {"thrilled", "so happy", "glad"},
+		"mean": {"mean a lot to our team", "make our day", "help other customers decide"},
+	},
+}
+
+// withCommon returns a grammar extended with the shared symbols
+func withCommon(g, common Grammar) Grammar {
+	merged := make(Grammar, len(g)+len(common))
+	for symbol, rules := range common {
+		merged[symbol] = rules
+	}
+	for symbol, rules := range g {
+		merged[symbol] = rules
+	}
+	return merged
+}
+
+func init() {
+	for name, grammar := range reviewGrammars {
+		reviewGrammars[name] = withCommon(grammar, reviewCommon)
+	}
+}
@@ -0,0 +1,64 @@
+package geo
+
+import "math"
+
+// earthRadiusKm is the mean radius of the Earth
+const earthRadiusKm = 6371.0
+
+// Point is a location in decimal degrees
+type Point struct {
+	Lat float64
+	Lon float64
+}
+
+// Distance returns the great-circle distance between two points in kilometers
+func Distance(a, b Point) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// countryCentroids holds a central point of each country code used in addresses
+var countryCentroids = map[string]Point{
+	"US": {39.8, -98.6}, "CA": {56.1, -106.3}, "MX": {23.6, -102.6}, "UK": {54.0, -2.0},
+	"FR": {46.2, 2.2}, "DE": {51.2, 10.5}, "IT": {41.9, 12.6}, "ES": {40.5, -3.7},
+	"JP": {36.2, 138.3}, "CN": {35.9, 104.2}, "AU": {-25.3, 133.8}, "NZ": {-40.9, 174.9},
+	"BR": {-14.2, -51.9}, "AR": {-38.4, -63.6}, "CL": {-35.7, -71.5}, "RU": {61.5, 105.3},
+	"IN": {20.6, 79.0}, "ZA": {-30.6, 22.9}, "NG": {9.1, 8.7}, "EG": {26.8, 30.8},
+}
+
+// stateCentroids holds a central point of each US state
+var stateCentroids = map[string]Point{
+	"Alabama": {32.8, -86.8}, "Alaska": {61.4, -152.3}, "Arizona": {34.2, -111.7},
+	"Arkansas": {34.9, -92.4}, "California": {37.2, -119.4}, "Colorado": {39.0, -105.5},
+	"Connecticut": {41.6, -72.7}, "Delaware": {39.0, -75.5}, "Florida": {28.6, -82.4},
+	"Georgia": {32.7, -83.4}, "Hawaii": {20.8, -156.3}, "Idaho": {44.4, -114.6},
+	"Illinois": {40.0, -89.2}, "Indiana": {39.9, -86.3}, "Iowa": {42.1, -93.5},
+	"Kansas": {38.5, -98.4}, "Kentucky": {37.5, -85.3}, "Louisiana": {31.1, -92.0},
+	"Maine": {45.4, -69.2}, "Maryland": {39.0, -76.8}, "Massachusetts": {42.3, -71.8},
+	"Michigan": {44.3, -85.4}, "Minnesota": {46.3, -94.3}, "Mississippi": {32.7, -89.7},
+	"Missouri": {38.4, -92.5}, "Montana": {47.0, -109.6}, "Nebraska": {41.5, -99.8},
+	"Nevada": {39.3, -116.6}, "New Hampshire": {43.7, -71.6}, "New Jersey": {40.2, -74.7},
+	"New Mexico": {34.4, -106.1}, "New York": {42.9, -75.5}, "North Carolina": {35.6, -79.4},
+	"North Dakota": {47.5, -100.5}, "Ohio": {40.3, -82.8}, "Oklahoma": {35.6, -97.5},
+	"Oregon": {43.9, -120.6}, "Pennsylvania": {40.9, -77.8}, "Rhode Island": {41.7, -71.5},
+	"South Carolina": {33.9, -80.9}, "South Dakota": {44.4, -100.2}, "Tennessee": {35.9, -86.4},
+	"Texas": {31.5, -99.3}, "Utah": {39.3, -111.7}, "Vermont": {44.1, -72.7},
+	"Virginia": {37.5, -78.9}, "Washington": {47.4, -120.5}, "West Virginia": {38.6, -80.6},
+	"Wisconsin": {44.6, -89.9}, "Wyoming": {43.0, -107.5},
+}
+
+// Locate returns a central point of the region an address is in: the state for US
+// addresses and the country otherwise. ok is false for regions it doesn't know.
+func Locate(country, state string) (p Point, ok bool) {
+	if country == "US" {
+		if p, ok = stateCentroids[state]; ok {
+			return p, true
+		}
+	}
+	p, ok = countryCentroids[country]
+	return p, ok
+}
@@ -0,0 +1,92 @@
+package money
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Currency describes an ISO 4217 currency. Amounts are always held in hundredths, so
+// only currencies with up to two minor units are supported.
+type Currency struct {
+	Code       string
+	MinorUnits int
+}
+
+// Currencies lists the supported currencies keyed by ISO 4217 code
+var Currencies = map[string]Currency{
+	"USD": {Code: "USD", MinorUnits: 2},
+	"EUR": {Code: "EUR", MinorUnits: 2},
+	"GBP": {Code: "GBP", MinorUnits: 2},
+	"CAD": {Code: "CAD", MinorUnits: 2},
+	"MXN": {Code: "MXN", MinorUnits: 2},
+	"JPY": {Code: "JPY", MinorUnits: 0},
+	"CNY": {Code: "CNY", MinorUnits: 2},
+	"AUD": {Code: "AUD", MinorUnits: 2},
+	"NZD": {Code: "NZD", MinorUnits: 2},
+	"BRL": {Code: "BRL", MinorUnits: 2},
+	"ARS": {Code: "ARS", MinorUnits: 2},
+	"CLP": {Code: "CLP", MinorUnits: 0},
+	"RUB": {Code: "RUB", MinorUnits: 2},
+	"INR": {Code: "INR", MinorUnits: 2},
+	"ZAR": {Code: "ZAR", MinorUnits: 2},
+	"NGN": {Code: "NGN", MinorUnits: 2},
+	"EGP": {Code: "EGP", MinorUnits: 2},
+}
+
+// countryCurrencies maps the country codes used in addresses to their local currency
+var countryCurrencies = map[string]string{
+	"US": "USD", "CA": "CAD", "MX": "MXN", "UK": "GBP", "FR": "EUR", "DE": "EUR", "IT": "EUR",
+	"ES": "EUR", "JP": "JPY", "CN": "CNY", "AU": "AUD", "NZ": "NZD", "BR": "BRL", "AR": "ARS",
+	"CL": "CLP", "RU": "RUB", "IN": "INR", "ZA": "ZAR", "NG": "NGN", "EG": "EGP",
+}
+
+// LookupCurrency returns the currency with the given ISO 4217 code
+func LookupCurrency(code string) (Currency, error) {
+	currency, ok := Currencies[code]
+	if !ok {
+		codes := make([]string, 0, len(Currencies))
+		for c := range Currencies {
+			codes = append(codes, c)
+		}
+		sort.Strings(codes)
+		return Currency{}, fmt.Errorf("unsupported currency %q (available: %v)", code, codes)
+	}
+	return currency, nil
+}
+
+// CurrencyForCountry returns the local currency of a country, falling back to the given currency
+func CurrencyForCountry(country string, fallback Currency) Currency {
+	if code, ok := countryCurrencies[country]; ok {
+		return Currencies[code]
+	}
+	return fallback
+}
+
+// Round rounds the amount half away from zero to the currency's minor units
+func (a Amount) Round(c Currency) Amount {
+	if c.MinorUnits >= 2 {
+		return a
+	}
+	step := Amount(math.Pow10(2 - c.MinorUnits))
+	if a < 0 {
+		return -((-a + step/2) / step * step)
+	}
+	return (a + step/2) / step * step
+}
+
+// Conversion converts amounts into a currency at a fixed exchange rate
+type Conversion struct {
+	Rate float64
+	To   Currency
+}
+
+// Identity returns a conversion that keeps amounts in the given currency
+func Identity(c Currency) Conversion {
+	return Conversion{Rate: 1, To: c}
+}
+
+// Apply converts an amount and rounds it to the target currency's minor units
+func (c Conversion) Apply(a Amount) Amount {
+	return Amount(math.Round(float64(a) * c.Rate)).Round(c.To)
+}
@@ -0,0 +1,104 @@
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount is a monetary amount in cents. Arithmetic on amounts is exact, and it reads
+// from and writes to DECIMAL columns as a decimal string.
+type Amount int64
+
+// FromFloat converts a float to an amount, rounding half away from zero to the nearest cent
+func FromFloat(f float64) Amount {
+	return Amount(math.Round(f * 100))
+}
+
+// Parse converts a decimal string such as "12.34" to an amount
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	if len(fraction) > 2 {
+		if strings.Trim(fraction[2:], "0") != "" {
+			return 0, fmt.Errorf("amount %q has more than two decimal places", s)
+		}
+		fraction = fraction[:2]
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+
+	units, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q: %w", s, err)
+	}
+	if negative {
+		units = -units
+	}
+	return Amount(units), nil
+}
+
+// Mul returns the amount multiplied by a quantity
+func (a Amount) Mul(quantity int) Amount {
+	return a * Amount(quantity)
+}
+
+// BasisPoints returns the given number of basis points (hundredths of a percent) of
+// the amount, rounded half away from zero to the nearest cent
+func (a Amount) BasisPoints(bp int64) Amount {
+	product := int64(a) * bp
+	if product < 0 {
+		return Amount(-((-product + 5000) / 10000))
+	}
+	return Amount((product + 5000) / 10000)
+}
+
+// Float returns the amount as a float, for use in weights and comparisons only
+func (a Amount) Float() float64 {
+	return float64(a) / 100
+}
+
+// String formats the amount as a decimal string with two decimal places
+func (a Amount) String() string {
+	sign := ""
+	units := int64(a)
+	if units < 0 {
+		sign = "-"
+		units = -units
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, units/100, units%100)
+}
+
+// Value implements driver.Valuer so amounts can be written to DECIMAL columns
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// Scan implements sql.Scanner so amounts can be read from DECIMAL columns
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		parsed, err := Parse(string(v))
+		if err != nil {
+			return err
+		}
+		*a = parsed
+	case string:
+		parsed, err := Parse(v)
+		if err != nil {
+			return err
+		}
+		*a = parsed
+	case int64:
+		*a = Amount(v * 100)
+	case float64:
+		*a = FromFloat(v)
+	default:
+		return fmt.Errorf("cannot scan %T into money.Amount", src)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package money
+
+import "testing"
+
+func TestRound(t *testing.T) {
+	usd, jpy := Currencies["USD"], Currencies["JPY"]
+	tests := []struct {
+		name     string
+		amount   Amount
+		currency Currency
+		want     Amount
+	}{
+		{"cents are kept in two minor unit currencies", 1234, usd, 1234},
+		{"negative cents are kept in two minor unit currencies", -1234, usd, -1234},
+		{"rounds down below half", 12349, jpy, 12300},
+		{"rounds half away from zero", 12350, jpy, 12400},
+		{"rounds negative half away from zero", -12350, jpy, -12400},
+		{"rounds negative down below half", -12349, jpy, -12300},
+		{"whole units are kept", 500, jpy, 500},
+		{"zero stays zero", 0, jpy, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.amount.Round(tt.currency); got != tt.want {
+				t.Errorf("Round(%v) = %v, want %v", tt.amount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConversionApply(t *testing.T) {
+	usd, eur, jpy := Currencies["USD"], Currencies["EUR"], Currencies["JPY"]
+	tests := []struct {
+		name       string
+		conversion Conversion
+		amount     Amount
+		want       Amount
+	}{
+		{"identity keeps the amount", Identity(usd), 1999, 1999},
+		{"converts to the nearest cent", Conversion{Rate: 0.92, To: eur}, 1999, 1839},
+		{"rounds half cents away from zero", Conversion{Rate: 0.5, To: eur}, 1, 1},
+		{"rounds to whole yen", Conversion{Rate: 150.2, To: jpy}, 1999, 300300},
+		{"converts negative amounts", Conversion{Rate: 150.2, To: jpy}, -1999, -300300},
+		{"zero stays zero", Conversion{Rate: 150.2, To: jpy}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.conversion.Apply(tt.amount); got != tt.want {
+				t.Errorf("Apply(%v) = %v, want %v", tt.amount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBasisPoints(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		bp     int64
+		want   Amount
+	}{
+		{10000, 825, 825},
+		{1999, 825, 165},
+		{200, 2500, 50},
+		{2, 2500, 1},
+		{-2, 2500, -1},
+		{1999, 0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.amount.BasisPoints(tt.bp); got != tt.want {
+			t.Errorf("%v.BasisPoints(%d) = %v, want %v", tt.amount, tt.bp, got, tt.want)
+		}
+	}
+}
+
+func TestParseString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+		out  string
+	}{
+		{"12.34", 1234, "12.34"},
+		{"12.3", 1230, "12.30"},
+		{"12", 1200, "12.00"},
+		{"-0.05", -5, "-0.05"},
+		{"7.5000", 750, "7.50"},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+		if s := got.String(); s != tt.out {
+			t.Errorf("String() of %q = %q, want %q", tt.in, s, tt.out)
+		}
+	}
+
+	if _, err := Parse("1.234"); err == nil {
+		t.Error("Parse(\"1.234\") succeeded, want an error for sub-cent amounts")
+	}
+}
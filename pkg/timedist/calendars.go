@@ -0,0 +1,108 @@
+package timedist
+
+import (
+	"fmt"
+	"time"
+)
+
+// Event is a recurring date range whose traffic is multiplied
+type Event struct {
+	Name       string
+	Multiplier float64
+	Matches    func(day time.Time) bool
+}
+
+// Calendar is a named set of traffic events
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// Multiplier returns the combined traffic multiplier of every event on the given day
+func (c Calendar) Multiplier(day time.Time) float64 {
+	multiplier := 1.0
+	for _, event := range c.Events {
+		if event.Matches(day) {
+			multiplier *= event.Multiplier
+		}
+	}
+	return multiplier
+}
+
+// Calendars lists the named holiday calendars
+var Calendars = map[string]Calendar{
+	"none": {Name: "none"},
+	"us-retail": {
+		Name: "us-retail",
+		Events: []Event{
+			{Name: "Valentine's Day", Multiplier: 1.3, Matches: dateRange(time.February, 7, time.February, 14)},
+			{Name: "Mother's Day", Multiplier: 1.3, Matches: daysBefore(nthWeekday(time.May, time.Sunday, 2), 7)},
+			{Name: "Summer Sale", Multiplier: 1.6, Matches: daysAfter(nthWeekday(time.July, time.Tuesday, 2), 2)},
+			{Name: "Back to School", Multiplier: 1.2, Matches: dateRange(time.August, 1, time.August, 31)},
+			{Name: "Black Friday", Multiplier: 3.5, Matches: daysAfter(nthWeekdayOffset(time.November, time.Thursday, 4, 1), 1)},
+			{Name: "Cyber Monday", Multiplier: 3.0, Matches: daysAfter(nthWeekdayOffset(time.November, time.Thursday, 4, 4), 1)},
+			{Name: "Holiday Season", Multiplier: 1.6, Matches: dateRange(time.December, 1, time.December, 22)},
+			{Name: "Christmas", Multiplier: 0.4, Matches: dateRange(time.December, 24, time.December, 25)},
+			{Name: "Boxing Week", Multiplier: 1.5, Matches: dateRange(time.December, 26, time.December, 31)},
+		},
+	},
+	"eu-retail": {
+		Name: "eu-retail",
+		Events: []Event{
+			{Name: "Winter Sales", Multiplier: 1.5, Matches: dateRange(time.January, 2, time.January, 20)},
+			{Name: "Summer Sales", Multiplier: 1.4, Matches: dateRange(time.July, 1, time.July, 21)},
+			{Name: "August Holidays", Multiplier: 0.7, Matches: dateRange(time.August, 1, time.August, 20)},
+			{Name: "Black Friday", Multiplier: 3.0, Matches: daysAfter(nthWeekdayOffset(time.November, time.Thursday, 4, 1), 1)},
+			{Name: "Christmas Shopping", Multiplier: 1.7, Matches: dateRange(time.December, 1, time.December, 23)},
+			{Name: "Christmas", Multiplier: 0.3, Matches: dateRange(time.December, 24, time.December, 26)},
+		},
+	},
+}
+
+// LookupCalendar returns the named calendar
+func LookupCalendar(name string) (Calendar, error) {
+	calendar, ok := Calendars[name]
+	if !ok {
+		return Calendar{}, fmt.Errorf("unknown calendar %q (available: %v)", name, sortedKeys(Calendars))
+	}
+	return calendar, nil
+}
+
+// dateRange matches every day between two month/day pairs of the same year, inclusive
+func dateRange(fromMonth time.Month, fromDay int, toMonth time.Month, toDay int) func(time.Time) bool {
+	return func(day time.Time) bool {
+		from := time.Date(day.Year(), fromMonth, fromDay, 0, 0, 0, 0, day.Location())
+		to := time.Date(day.Year(), toMonth, toDay, 0, 0, 0, 0, day.Location())
+		return !day.Before(from) && !day.After(to)
+	}
+}
+
+// nthWeekday returns the date of the nth given weekday of a month in a year
+func nthWeekday(month time.Month, weekday time.Weekday, n int) func(year int, loc *time.Location) time.Time {
+	return nthWeekdayOffset(month, weekday, n, 0)
+}
+
+// nthWeekdayOffset returns the date a number of days after the nth given weekday of a month
+func nthWeekdayOffset(month time.Month, weekday time.Weekday, n, offset int) func(year int, loc *time.Location) time.Time {
+	return func(year int, loc *time.Location) time.Time {
+		first := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+		shift := (int(weekday) - int(first.Weekday()) + 7) % 7
+		return first.AddDate(0, 0, shift+(n-1)*7+offset)
+	}
+}
+
+// daysAfter matches a number of days starting at an anchor date
+func daysAfter(anchor func(int, *time.Location) time.Time, days int) func(time.Time) bool {
+	return func(day time.Time) bool {
+		start := anchor(day.Year(), day.Location())
+		return !day.Before(start) && day.Before(start.AddDate(0, 0, days))
+	}
+}
+
+// daysBefore matches a number of days leading up to and including an anchor date
+func daysBefore(anchor func(int, *time.Location) time.Time, days int) func(time.Time) bool {
+	return func(day time.Time) bool {
+		end := anchor(day.Year(), day.Location())
+		return day.After(end.AddDate(0, 0, -days)) && !day.After(end)
+	}
+}
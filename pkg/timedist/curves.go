@@ -0,0 +1,71 @@
+package timedist
+
+import (
+	"fmt"
+	"sort"
+)
+
+// HourlyCurve holds the relative traffic for each hour of the day, starting at midnight
+type HourlyCurve [24]float64
+
+// WeeklyPattern holds the relative traffic for each day of the week, starting on Sunday
+type WeeklyPattern [7]float64
+
+// HourlyCurves lists the named intraday traffic curves
+var HourlyCurves = map[string]HourlyCurve{
+	// Flat traffic around the clock
+	"flat": {
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+	},
+	// Consumer retail: quiet nights, a lunchtime bump and an evening peak
+	"retail": {
+		0.30, 0.18, 0.10, 0.07, 0.06, 0.09, 0.20, 0.40, 0.60, 0.75, 0.85, 0.95,
+		1.10, 1.05, 0.90, 0.85, 0.90, 1.00, 1.15, 1.35, 1.45, 1.30, 0.95, 0.55,
+	},
+	// Business purchasing concentrated in office hours
+	"office": {
+		0.05, 0.03, 0.02, 0.02, 0.02, 0.05, 0.15, 0.50, 1.10, 1.40, 1.45, 1.30,
+		1.00, 1.25, 1.35, 1.25, 1.00, 0.60, 0.30, 0.20, 0.15, 0.12, 0.10, 0.07,
+	},
+	// Late-night heavy traffic, typical of gaming and entertainment stores
+	"night-owl": {
+		1.10, 0.95, 0.70, 0.45, 0.25, 0.15, 0.15, 0.20, 0.30, 0.40, 0.50, 0.60,
+		0.65, 0.70, 0.70, 0.75, 0.80, 0.90, 1.00, 1.15, 1.30, 1.40, 1.45, 1.30,
+	},
+}
+
+// WeeklyPatterns lists the named weekday/weekend traffic patterns
+var WeeklyPatterns = map[string]WeeklyPattern{
+	"flat":   {1, 1, 1, 1, 1, 1, 1},
+	"retail": {1.25, 0.90, 0.92, 0.95, 1.00, 1.10, 1.35},
+	"office": {0.25, 1.20, 1.25, 1.25, 1.20, 1.05, 0.30},
+}
+
+// LookupHourlyCurve returns the named hourly curve
+func LookupHourlyCurve(name string) (HourlyCurve, error) {
+	curve, ok := HourlyCurves[name]
+	if !ok {
+		return HourlyCurve{}, fmt.Errorf("unknown traffic curve %q (available: %v)", name, sortedKeys(HourlyCurves))
+	}
+	return curve, nil
+}
+
+// LookupWeeklyPattern returns the named weekly pattern
+func LookupWeeklyPattern(name string) (WeeklyPattern, error) {
+	pattern, ok := WeeklyPatterns[name]
+	if !ok {
+		return WeeklyPattern{}, fmt.Errorf("unknown weekly pattern %q (available: %v)", name, sortedKeys(WeeklyPatterns))
+	}
+	return pattern, nil
+}
+
+// sortedKeys returns the keys of a named lookup table in alphabetical order
+func sortedKeys[T any](table map[string]T) []string {
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
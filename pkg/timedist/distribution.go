@@ -0,0 +1,162 @@
+package timedist
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Config holds the settings used to build a Distribution
+type Config struct {
+	Start         time.Time
+	End           time.Time
+	HourlyCurve   string
+	WeeklyPattern string
+	Calendar      string
+	YearlyGrowth  float64 // Year-over-year traffic growth, e.g. 0.2 for 20%
+}
+
+// DefaultConfig returns a one-year retail-shaped window ending today
+func DefaultConfig() Config {
+	end := time.Now().UTC().Truncate(24 * time.Hour)
+	return Config{
+		Start:         end.AddDate(-1, 0, 0),
+		End:           end,
+		HourlyCurve:   "retail",
+		WeeklyPattern: "retail",
+		Calendar:      "us-retail",
+		YearlyGrowth:  0.2,
+	}
+}
+
+// Distribution samples timestamps shaped like real traffic over a time window
+type Distribution struct {
+	Start time.Time
+	End   time.Time
+
+	days             []time.Time
+	dayCumulative    []float64
+	hourCumulative   []float64
+	calendar         Calendar
+	hourlyCurve      HourlyCurve
+	weeklyPattern    WeeklyPattern
+	yearlyGrowthRate float64
+}
+
+// New builds a Distribution from the given configuration
+func New(config Config) (*Distribution, error) {
+	if !config.End.After(config.Start) {
+		return nil, fmt.Errorf("end of time window %s must be after its start %s",
+			config.End.Format(time.DateOnly), config.Start.Format(time.DateOnly))
+	}
+
+	hourlyCurve, err := LookupHourlyCurve(config.HourlyCurve)
+	if err != nil {
+		return nil, err
+	}
+	weeklyPattern, err := LookupWeeklyPattern(config.WeeklyPattern)
+	if err != nil {
+		return nil, err
+	}
+	calendar, err := LookupCalendar(config.Calendar)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Distribution{
+		Start:            config.Start,
+		End:              config.End,
+		calendar:         calendar,
+		hourlyCurve:      hourlyCurve,
+		weeklyPattern:    weeklyPattern,
+		yearlyGrowthRate: config.YearlyGrowth,
+	}
+
+	// Precompute cumulative weights so sampling is a binary search
+	total := 0.0
+	for day := startOfDay(config.Start); day.Before(config.End); day = day.AddDate(0, 0, 1) {
+		total += d.DayWeight(day)
+		d.days = append(d.days, day)
+		d.dayCumulative = append(d.dayCumulative, total)
+	}
+
+	total = 0.0
+	for _, weight := range hourlyCurve {
+		total += weight
+		d.hourCumulative = append(d.hourCumulative, total)
+	}
+
+	return d, nil
+}
+
+// DayWeight returns the relative traffic of a day, combining the weekly pattern,
+// the holiday calendar and year-over-year growth
+func (d *Distribution) DayWeight(day time.Time) float64 {
+	years := day.Sub(d.Start).Hours() / (24 * 365.25)
+	growth := math.Pow(1+d.yearlyGrowthRate, years)
+	return d.weeklyPattern[day.Weekday()] * d.calendar.Multiplier(day) * growth
+}
+
+// Sample returns a random timestamp within the whole time window
+func (d *Distribution) Sample() time.Time {
+	return d.SampleBetween(d.Start, d.End)
+}
+
+// SampleBetween returns a random timestamp within [from, to), clamped to the time window
+func (d *Distribution) SampleBetween(from, to time.Time) time.Time {
+	if from.Before(d.Start) {
+		from = d.Start
+	}
+	if to.After(d.End) {
+		to = d.End
+	}
+	if !to.After(from) {
+		return from
+	}
+
+	// Restrict the cumulative weights to the days overlapping [from, to)
+	first := sort.Search(len(d.days), func(i int) bool { return !d.days[i].AddDate(0, 0, 1).Before(from) })
+	last := sort.Search(len(d.days), func(i int) bool { return !d.days[i].Before(to) }) - 1
+	if first > last {
+		return from
+	}
+	low := 0.0
+	if first > 0 {
+		low = d.dayCumulative[first-1]
+	}
+	high := d.dayCumulative[last]
+
+	for attempt := 0; attempt < 10; attempt++ {
+		target := low + rand.Float64()*(high-low)
+		index := sort.SearchFloat64s(d.dayCumulative[first:last+1], target) + first
+		if index > last {
+			index = last
+		}
+
+		hour := sort.SearchFloat64s(d.hourCumulative, rand.Float64()*d.hourCumulative[23])
+		if hour > 23 {
+			hour = 23
+		}
+		offset := time.Duration(hour)*time.Hour + time.Duration(rand.Int63n(int64(time.Hour)))
+		sample := d.days[index].Add(offset).Truncate(time.Second)
+
+		// Partial days at the edges of the range can produce out of range samples
+		if !sample.Before(from) && sample.Before(to) {
+			return sample
+		}
+	}
+
+	return from.Add(time.Duration(rand.Int63n(int64(to.Sub(from))))).Truncate(time.Second)
+}
+
+// Fraction returns the time at the given fraction of the way through the window
+func (d *Distribution) Fraction(f float64) time.Time {
+	return d.Start.Add(time.Duration(f * float64(d.End.Sub(d.Start))))
+}
+
+// startOfDay truncates a time to midnight in its own location
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}